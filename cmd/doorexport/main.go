@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/b4ckspace/members/internal/doorexport"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+)
+
+type (
+	Args struct {
+		LdapServer string
+		LdapPort   int
+		LdapUser   string
+		LdapPass   string
+		Key        string
+		Out        string
+		GenKey     bool
+	}
+)
+
+// doorexport writes a signed snapshot of all active members for the door
+// controller to snapshot.json, and the changes since the previous run to
+// diff.json
+func main() {
+	args := Args{}
+	flag.StringVar(&args.LdapServer, "server", "ldap.example.com", "ldap server")
+	flag.StringVar(&args.LdapUser, "user", "uid=user,dc=example", "ldap user")
+	flag.IntVar(&args.LdapPort, "port", 389, "ldap port")
+	flag.StringVar(&args.Key, "key", "door.key", "ed25519 signing key")
+	flag.StringVar(&args.Out, "out", ".", "output directory")
+	flag.BoolVar(&args.GenKey, "genkey", false, "generate a signing key and print the public key")
+	flag.Parse()
+
+	if args.GenKey {
+		private, public, err := doorexport.GenerateKey()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		err = os.WriteFile(args.Key, private, 0600)
+		if err != nil {
+			log.Fatalf("unable to write key: %s", err)
+		}
+		fmt.Print(string(public))
+		return
+	}
+
+	key, err := doorexport.LoadKey(args.Key)
+	if err != nil {
+		log.Fatalf("unable to load signing key: %s", err)
+	}
+
+	var ok bool
+	args.LdapPass, ok = os.LookupEnv("LDAP_PASSWORD")
+	if !ok {
+		log.Fatalf("unable to load LDAP_PASSWORD from environment")
+	}
+	ld, err := ldapwrap.New(ldapwrap.NewLdapConnFactory(
+		args.LdapServer,
+		args.LdapPort,
+		args.LdapUser,
+		args.LdapPass,
+	))
+	if err != nil {
+		log.Fatalf("unable to connect to ldap: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := ld.Dial(ctx)
+	if err != nil {
+		log.Fatalf("unable to connect to ldap: %s", err)
+	}
+	members, err := l.DoorMembers()
+	if err != nil {
+		log.Fatalf("unable to load members: %s", err)
+	}
+
+	snapshot, err := doorexport.NewSnapshot(members, time.Now())
+	if err != nil {
+		log.Fatalf("unable to create snapshot: %s", err)
+	}
+
+	snapshotFile := filepath.Join(args.Out, "snapshot.json")
+	previous := doorexport.Snapshot{}
+	err = readSigned(snapshotFile, key, &previous)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("unable to read previous snapshot: %s", err)
+	}
+
+	// both files are complete before either is replaced, the snapshot goes
+	// first so the diff is never ahead of it
+	diffFile := filepath.Join(args.Out, "diff.json")
+	snapshotTmp, err := writeSigned(snapshotFile, key, snapshot)
+	if err != nil {
+		log.Fatalf("unable to write snapshot: %s", err)
+	}
+	diffTmp, err := writeSigned(diffFile, key, doorexport.NewDiff(previous, snapshot))
+	if err != nil {
+		log.Fatalf("unable to write diff: %s", err)
+	}
+	err = os.Rename(snapshotTmp, snapshotFile)
+	if err != nil {
+		log.Fatalf("unable to write snapshot: %s", err)
+	}
+	err = os.Rename(diffTmp, diffFile)
+	if err != nil {
+		log.Fatalf("unable to write diff: %s", err)
+	}
+	log.Printf("exported %d members, snapshot %s", len(snapshot.Members), snapshot.ID)
+}
+
+func readSigned(file string, key ed25519.PrivateKey, v interface{}) (err error) {
+	c, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	signed := doorexport.Signed{}
+	err = json.Unmarshal(c, &signed)
+	if err != nil {
+		return fmt.Errorf("unable to decode %s: %s", file, err)
+	}
+	return doorexport.Open(key.Public().(ed25519.PublicKey), signed, v)
+}
+
+// writeSigned writes v next to file and returns the name of the temporary
+// file. Renaming it is left to the caller, so the door controller never
+// reads half a file. The hashes inside are only readable by the owner.
+func writeSigned(file string, key ed25519.PrivateKey, v interface{}) (tmp string, err error) {
+	signed, err := doorexport.Sign(key, v)
+	if err != nil {
+		return "", err
+	}
+	// no indention, the payload has to stay byte for byte as signed
+	c, err := json.Marshal(signed)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode %s: %s", file, err)
+	}
+	// a leftover from an older run may have other permissions
+	tmp = file + ".tmp"
+	err = os.Remove(tmp)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	err = os.WriteFile(tmp, c, 0600)
+	if err != nil {
+		return "", err
+	}
+	return tmp, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/offboarding"
+)
+
+type (
+	Args struct {
+		LdapServer  string
+		LdapPort    int
+		LdapUser    string
+		LdapPass    string
+		MailmanURL  string
+		MailmanUser string
+		MailmanPass string
+		AuditLog    string
+		Retention   time.Duration
+		Actor       string
+		Nickname    string
+		Reason      string
+		Purge       bool
+	}
+)
+
+// offboard revokes all credentials of a leaving member and moves the entry to
+// the archive. With -purge it deletes archived members whose retention period
+// ended, run it daily from cron.
+func main() {
+	args := Args{}
+	flag.StringVar(&args.LdapServer, "server", "ldap.example.com", "ldap server")
+	flag.StringVar(&args.LdapUser, "user", "uid=user,dc=example", "ldap user")
+	flag.IntVar(&args.LdapPort, "port", 389, "ldap port")
+	flag.StringVar(&args.MailmanURL, "mailman-url", "", "mailman 3 rest api, e.g. http://localhost:8001/3.1")
+	flag.StringVar(&args.MailmanUser, "mailman-user", "restadmin", "mailman rest api user")
+	flag.StringVar(&args.AuditLog, "audit-log", "audit.log", "file actions are appended to")
+	flag.DurationVar(&args.Retention, "retention", 2*365*24*time.Hour, "time offboarded members are kept in the archive")
+	flag.StringVar(&args.Actor, "actor", os.Getenv("USER"), "name recorded in the audit log")
+	flag.StringVar(&args.Nickname, "nickname", "", "member to offboard")
+	flag.StringVar(&args.Reason, "reason", "", "reason recorded in the membership history")
+	flag.BoolVar(&args.Purge, "purge", false, "delete archived members after the retention period")
+	flag.Parse()
+
+	if !args.Purge && (args.Nickname == "" || args.Reason == "") {
+		log.Fatalf("either -purge or -nickname and -reason are required")
+	}
+
+	var ok bool
+	args.LdapPass, ok = os.LookupEnv("LDAP_PASSWORD")
+	if !ok {
+		log.Fatalf("unable to load LDAP_PASSWORD from environment")
+	}
+	ld, err := ldapwrap.New(ldapwrap.NewLdapConnFactory(
+		args.LdapServer,
+		args.LdapPort,
+		args.LdapUser,
+		args.LdapPass,
+	))
+	if err != nil {
+		log.Fatalf("unable to connect to ldap: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := ld.Dial(ctx)
+	if err != nil {
+		log.Fatalf("unable to connect to ldap: %s", err)
+	}
+
+	var ml core.MailingLists
+	if args.MailmanURL != "" {
+		args.MailmanPass = os.Getenv("MAILMAN_PASSWORD")
+		ml = mailinglist.NewMailman(args.MailmanURL, args.MailmanUser, args.MailmanPass)
+	}
+	o := offboarding.New(ml, audit.NewFile(args.AuditLog), args.Retention)
+
+	if args.Purge {
+		deleted, err := o.Purge(l, args.Actor)
+		if err != nil {
+			log.Fatalf("unable to purge archive: %s", err)
+		}
+		log.Printf("deleted %d archived members: %v", len(deleted), deleted)
+		return
+	}
+	err = o.Offboard(l, args.Nickname, args.Actor, args.Reason)
+	if err != nil {
+		log.Fatalf("unable to offboard %s: %s", args.Nickname, err)
+	}
+	log.Printf("offboarded %s", args.Nickname)
+}
@@ -3,14 +3,25 @@ module github.com/b4ckspace/members
 go 1.22.4
 
 require (
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/go-asn1-ber/asn1-ber v1.5.5
 	github.com/go-ldap/ldap/v3 v3.4.8
+	github.com/go-webauthn/webauthn v0.9.4
 	github.com/golang/mock v1.6.0
+	github.com/nbutton23/zxcvbn-go v0.0.0-20210217022336-fa2cb2858354
 	github.com/rakyll/statik v0.1.7
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/crypto v0.21.0
+	rsc.io/qr v0.2.0
 )
 
 require (
 	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
-	github.com/go-asn1-ber/asn1-ber v1.5.5 // indirect
+	github.com/go-webauthn/x v0.1.5 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
+	github.com/google/go-tpm v0.9.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.18.0 // indirect
 )
@@ -0,0 +1,109 @@
+// Package audit records who changed what about a member
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	Event struct {
+		Time    time.Time `json:"time"`
+		Actor   string    `json:"actor"`
+		Subject string    `json:"subject"`
+		Action  string    `json:"action"`
+		Detail  string    `json:"detail,omitempty"`
+	}
+
+	// File appends events as json lines
+	File struct {
+		path string
+		m    sync.Mutex
+	}
+
+	Memory struct {
+		m      sync.Mutex
+		events []Event
+	}
+)
+
+func NewFile(path string) (f *File) {
+	return &File{path: path}
+}
+
+func (f *File) Record(e Event) (err error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %s", err)
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	fh, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %s", err)
+	}
+	defer fh.Close()
+	_, err = fh.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("unable to write audit log: %s", err)
+	}
+	return nil
+}
+
+// Events returns all events about subject, oldest first
+func (f *File) Events(subject string) (events []Event, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	fh, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audit log: %s", err)
+	}
+	defer fh.Close()
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		e := Event{}
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode audit log: %s", err)
+		}
+		if e.Subject == subject {
+			events = append(events, e)
+		}
+	}
+	return events, scanner.Err()
+}
+
+func NewMemory() (m *Memory) {
+	return &Memory{}
+}
+
+func (m *Memory) Record(e Event) (err error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *Memory) Events(subject string) (events []Event, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, e := range m.events {
+		if e.Subject == subject {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,31 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	f := NewFile(filepath.Join(t.TempDir(), "audit.log"))
+	events, err := f.Events("member")
+	if err != nil || len(events) != 0 {
+		t.Fatalf("unexpected events in missing log: %v %s", events, err)
+	}
+	for _, e := range []Event{
+		{Actor: "admin", Subject: "member", Action: "offboard"},
+		{Actor: "admin", Subject: "other", Action: "offboard"},
+		{Actor: "admin", Subject: "member", Action: "archive", Detail: "delete after 2028-10-19"},
+	} {
+		err = f.Record(e)
+		if err != nil {
+			t.Fatalf("unable to record: %s", err)
+		}
+	}
+	events, err = f.Events("member")
+	if err != nil {
+		t.Fatalf("unable to read events: %s", err)
+	}
+	if len(events) != 2 || events[1].Action != "archive" || events[1].Time.IsZero() {
+		t.Fatalf("invalid events: %+v", events)
+	}
+}
@@ -0,0 +1,117 @@
+// Package authz maps the LDAP groups of a member to roles and the roles to
+// the permissions checked by the admin pages
+package authz
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Role is the cn of a groupOfNames or posixGroup in ou=groups
+	Role       string
+	Permission string
+	Policy     map[Role][]Permission
+
+	// Cache remembers the roles of members, so not every request has to
+	// search the groups
+	Cache struct {
+		ttl time.Duration
+		now func() time.Time
+
+		m          sync.Mutex
+		byNickname map[string]cached
+	}
+	cached struct {
+		roles   []Role
+		expires time.Time
+	}
+)
+
+const (
+	Board     Role = "board"
+	Treasurer Role = "treasurer"
+	DoorAdmin Role = "door-admin"
+)
+
+const (
+	ManageServices   Permission = "services"
+	ManageMembership Permission = "membership"
+	Offboard         Permission = "offboarding"
+	ReadDirectory    Permission = "directory"
+	ExportDirectory  Permission = "directory-export"
+	EnrollBadges     Permission = "badges"
+	ManageGroups     Permission = "groups"
+	PreviewMails     Permission = "mails"
+)
+
+// DefaultPolicy lets the board do everything, the treasurer read the member
+// directory and door admins enroll badges for other members
+func DefaultPolicy() Policy {
+	return Policy{
+		Board: {
+			ManageServices, ManageMembership, Offboard,
+			ReadDirectory, ExportDirectory, EnrollBadges, ManageGroups,
+			PreviewMails,
+		},
+		Treasurer: {ReadDirectory, ExportDirectory},
+		DoorAdmin: {EnrollBadges},
+	}
+}
+
+// Has reports whether the policy knows role. Membership in such a group
+// grants permissions, so only members with ManageGroups may change it.
+func (p Policy) Has(role Role) bool {
+	_, ok := p[role]
+	return ok
+}
+
+func (p Policy) Allows(roles []Role, permission Permission) bool {
+	return p.Permissions(roles)[permission]
+}
+
+// Permissions returns everything the roles are allowed to do
+func (p Policy) Permissions(roles []Role) (permissions map[Permission]bool) {
+	permissions = map[Permission]bool{}
+	for _, role := range roles {
+		for _, permission := range p[role] {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+func NewCache(ttl time.Duration) (c *Cache) {
+	return &Cache{
+		ttl:        ttl,
+		now:        time.Now,
+		byNickname: map[string]cached{},
+	}
+}
+
+func (c *Cache) Get(nickname string) (roles []Role, ok bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	entry, ok := c.byNickname[nickname]
+	if !ok || c.now().After(entry.expires) {
+		delete(c.byNickname, nickname)
+		return nil, false
+	}
+	return entry.roles, true
+}
+
+func (c *Cache) Set(nickname string, roles []Role) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.byNickname[nickname] = cached{
+		roles:   roles,
+		expires: c.now().Add(c.ttl),
+	}
+}
+
+// Invalidate drops the cached roles, e.g. after group memberships changed
+func (c *Cache) Invalidate(nickname string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.byNickname, nickname)
+}
@@ -0,0 +1,51 @@
+package authz
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	p := DefaultPolicy()
+	policyOpts := []struct {
+		roles      []Role
+		permission Permission
+		want       bool
+	}{
+		{nil, ReadDirectory, false},
+		{[]Role{"laser"}, ReadDirectory, false},
+		{[]Role{Treasurer}, ExportDirectory, true},
+		{[]Role{Treasurer}, Offboard, false},
+		{[]Role{DoorAdmin}, EnrollBadges, true},
+		{[]Role{DoorAdmin, Treasurer}, ReadDirectory, true},
+		{[]Role{Board}, ManageMembership, true},
+	}
+	for _, o := range policyOpts {
+		if p.Allows(o.roles, o.permission) != o.want {
+			t.Fatalf("%v allowed %s: want %t", o.roles, o.permission, o.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := NewCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("member", []Role{Board})
+	roles, ok := c.Get("member")
+	if !ok || len(roles) != 1 {
+		t.Fatalf("roles not cached")
+	}
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get("member")
+	if ok {
+		t.Fatalf("roles not expired")
+	}
+	c.Set("member", nil)
+	c.Invalidate("member")
+	_, ok = c.Get("member")
+	if ok {
+		t.Fatalf("roles not invalidated")
+	}
+}
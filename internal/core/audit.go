@@ -0,0 +1,13 @@
+//go:generate mockgen -source=$GOFILE -destination=$PWD/mocks/${GOFILE} -package=mocks
+package core
+
+import (
+	"github.com/b4ckspace/members/internal/audit"
+)
+
+type (
+	AuditLog interface {
+		Record(e audit.Event) error
+		Events(subject string) (events []audit.Event, err error)
+	}
+)
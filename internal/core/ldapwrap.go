@@ -3,8 +3,12 @@ package core
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/b4ckspace/members/internal/membership"
 )
 
 type (
@@ -12,15 +16,131 @@ type (
 		Add(*ldap.AddRequest) error
 		Modify(*ldap.ModifyRequest) error
 		Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
+		ModifyDN(*ldap.ModifyDNRequest) error
+		Del(*ldap.DelRequest) error
 		Close() error
 	}
 	LdapDialer interface {
 		Dial(context.Context) (LdapWrap, error)
 	}
 	LdapWrap interface {
-		RegisterMember(user, email, mlEmail string) (token string, err error)
+		RegisterMember(user, email, mlEmail string, services []string) (token string, err error)
 		SetPassword(token, password, doorpass string) error
 		MemberExists(uid string) (exists bool, err error)
-		PasswordReset(nickname string) (token, email string, err error)
+		PasswordReset(nicknameOrEmail string) (resets []PasswordResetToken, err error)
+		Authenticate(uid, password string) (nickname string, ok bool, err error)
+		LoginEnabled(uid string) (nickname string, enabled bool, err error)
+		RequestEmailChange(uid, newEmail string) (confirmToken, revertToken, oldEmail string, err error)
+		ConfirmEmailChange(token string) (nickname, oldEmail, email string, err error)
+		RevertEmailChange(token string) (nickname, replacedEmail, email string, err error)
+		SetDoorPassword(uid, doorpass string) error
+		InvalidateDoorPassword(uid string) error
+		DoorMembers() (members []DoorMember, err error)
+		AddBadge(uid, badgeUID, label string) (badge Badge, err error)
+		Badges(uid string) (badges []Badge, err error)
+		RevokeBadge(uid, badgeID string) error
+		SSHKeys(uid string) (keys []string, err error)
+		AddSSHKey(uid, key string) error
+		DeleteSSHKey(uid, key string) error
+		Services(uid string) (enabled, requested []string, err error)
+		EnableService(uid, service string) error
+		DisableService(uid, service string) error
+		RequestService(uid, service string) error
+		DeclineService(uid, service string) error
+		ServiceRequests() (requests []ServiceRequest, err error)
+		MlAddress(uid string) (mlAddress, email string, err error)
+		SetMlAddress(uid, mlAddress string) error
+		Membership(uid string) (state membership.State, transitions []membership.Transition, err error)
+		ChangeMembership(uid string, t membership.Transition, services []string) error
+		DisableLogin(uid string) error
+		Archive(uid string, deleteAfter time.Time) error
+		ExpiredArchives(now time.Time) (archives []Archive, err error)
+		DeleteArchived(uid string) error
+		MemberData(uid string) (data map[string][]string, err error)
+		Directory(q DirectoryQuery) (entries []DirectoryEntry, more bool, err error)
+		MemberGroups(uid string) (groups []string, err error)
+		Groups() (groups []Group, err error)
+		Group(cn string) (group Group, err error)
+		CreateGroup(cn, description string) (group Group, err error)
+		DeleteGroup(cn string) error
+		RenameGroup(cn, newCN string) error
+		AddGroupMember(cn, uid string) error
+		RemoveGroupMember(cn, uid string) error
+		AddGroupOwner(cn, uid string) error
+		RemoveGroupOwner(cn, uid string) error
+		LeaveGroups(uid string) (groups []string, err error)
+		TOTP(uid string) (secret string, recoveryCodes int, err error)
+		EnableTOTP(uid, secret string, recoveryCodes []string) error
+		DisableTOTP(uid string) error
+		UseTOTP(uid string, counter int64) (ok bool, err error)
+		UseRecoveryCode(uid, code string) (ok bool, err error)
+		Passkeys(uid string) (passkeys []Passkey, err error)
+		AddPasskey(uid, label string, credential webauthn.Credential) (passkey Passkey, err error)
+		UpdatePasskey(uid string, credential webauthn.Credential) error
+		RevokePasskey(uid, passkeyID string) error
+	}
+
+	DoorMember struct {
+		Nickname     string
+		DoorPassword string
+		// Badges holds the hashed badge UIDs
+		Badges []string
+	}
+	Badge struct {
+		ID      string
+		Label   string
+		Hash    string
+		Created time.Time
+	}
+	// Passkey is a registered WebAuthn credential, the ID is the base64url
+	// encoded credential id
+	Passkey struct {
+		ID         string
+		Label      string
+		Created    time.Time
+		Credential webauthn.Credential
+	}
+
+	DirectoryQuery struct {
+		OU       string
+		Service  string
+		State    membership.State
+		Search   string
+		Page     int
+		PageSize int
+	}
+	DirectoryEntry struct {
+		Nickname       string
+		OU             string
+		State          membership.State
+		Email          string
+		AlternateEmail string
+		MlAddress      string
+		Services       []string
+	}
+
+	Group struct {
+		Name        string
+		GidNumber   int
+		Description string
+		Members     []string
+		// Owners are the nicknames of members allowed to manage the group
+		Owners []string
+	}
+
+	Archive struct {
+		Nickname    string
+		DeleteAfter time.Time
+	}
+
+	ServiceRequest struct {
+		Nickname string
+		Service  string
+	}
+
+	PasswordResetToken struct {
+		Nickname string
+		Email    string
+		Token    string
 	}
 )
@@ -1,8 +1,63 @@
 //go:generate mockgen -source=$GOFILE -destination=$PWD/mocks/${GOFILE} -package=mocks
 package core
 
+import (
+	"context"
+	"time"
+)
+
+// names of the mail templates, see web/templates/mail
+const (
+	MailRegistration    = "registration"
+	MailNicknameTaken   = "nickname_taken"
+	MailPasswordReset   = "password_reset"
+	MailEmailConfirm    = "email_confirm"
+	MailEmailRevert     = "email_revert"
+	MailDoorCompromised = "door_compromised"
+	MailDataExport      = "data_export"
+	MailSecurityNotice  = "security_notice"
+)
+
 type (
 	Mailer interface {
-		SendPassword(to, nickname, token string) error
+		// Send renders the named template with data and delivers it to to,
+		// the locale is taken from the context
+		Send(ctx context.Context, to, templateName string, data interface{}) error
+	}
+
+	// MailData is passed to all mail templates, each template uses the
+	// fields it needs
+	MailData struct {
+		Nickname string
+		EMail    string
+		Token    string
+		Notice   SecurityNotice
+	}
+
+	// SecurityNotice describes a change of credentials or contact data, the
+	// request details help the member to tell whether it was them
+	SecurityNotice struct {
+		Change     string
+		Time       time.Time
+		RemoteAddr string
+		UserAgent  string
+	}
+
+	// Mailbox keeps mails instead of delivering them, e.g. in development
+	// mode
+	Mailbox interface {
+		// Mails returns the received mails, newest first
+		Mails() (mails []CapturedMail)
+	}
+	CapturedMail struct {
+		Received time.Time
+		From     string
+		To       []string
+		Subject  string
+		Text     string
+		// Links found in the text, links to the portal are made relative so
+		// they lead to the local instance
+		Links []string
+		Raw   string
 	}
 )
@@ -0,0 +1,17 @@
+//go:generate mockgen -source=$GOFILE -destination=$PWD/mocks/${GOFILE} -package=mocks
+package core
+
+type (
+	MailingLists interface {
+		Lists() (lists []MailingList, err error)
+		Subscriptions(address string) (listIDs []string, err error)
+		Subscribe(listID, address string) error
+		Unsubscribe(listID, address string) error
+	}
+
+	MailingList struct {
+		ID          string
+		Name        string
+		Description string
+	}
+)
@@ -0,0 +1,73 @@
+package devmode
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/mailer"
+)
+
+func TestMain(m *testing.M) {
+	// mail templates are loaded relative to the repository root
+	_ = os.Chdir("../../")
+	os.Exit(m.Run())
+}
+
+func TestDirectory(t *testing.T) {
+	dir, err := Directory()
+	if err != nil {
+		t.Fatalf("unable to seed directory: %s", err)
+	}
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+	conn, _ := ld.Dial(context.Background())
+
+	for _, s := range samples {
+		_, ok, err := conn.Authenticate(s.nickname, Password)
+		if err != nil || !ok {
+			t.Fatalf("unable to log in as %s: %s", s.nickname, err)
+		}
+	}
+	groups, err := conn.MemberGroups("board")
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("invalid groups of board: %v %s", groups, err)
+	}
+	token, err := conn.RegisterMember("new", "new@example.com", "new@example.com", nil)
+	if err != nil || token == "" {
+		t.Fatalf("unable to register member: %s", err)
+	}
+}
+
+func TestMailbox(t *testing.T) {
+	mb := NewMailbox()
+	m, err := mailer.New(mb.ConnFactory())
+	if err != nil {
+		t.Fatalf("unable to create mailer: %s", err)
+	}
+	for _, name := range []string{core.MailRegistration, core.MailPasswordReset} {
+		err = m.Send(context.Background(), "member@example.com", name, core.MailData{
+			Nickname: "member",
+			Token:    "t0k3n",
+		})
+		if err != nil {
+			t.Fatalf("unable to send %s: %s", name, err)
+		}
+	}
+
+	mails := mb.Mails()
+	if len(mails) != 2 {
+		t.Fatalf("invalid mails: %+v", mails)
+	}
+	reset := mails[0]
+	if reset.Subject != "Hackerspace Bamberg - Passwort zurücksetzen" || reset.To[0] != "member@example.com" {
+		t.Fatalf("invalid mail: %+v", reset)
+	}
+	if len(reset.Links) != 1 || reset.Links[0] != "/password?t=t0k3n" {
+		t.Fatalf("invalid links: %v", reset.Links)
+	}
+	if mails[1].Links[0] != "/confirm?t=t0k3n" {
+		t.Fatalf("invalid links: %v", mails[1].Links)
+	}
+}
@@ -0,0 +1,75 @@
+// Package devmode provides the in-memory stand-ins for LDAP and SMTP used
+// when running the portal with -dev
+package devmode
+
+import (
+	"fmt"
+
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/membership"
+	"github.com/b4ckspace/members/internal/ssha"
+)
+
+// Password is the password and door password of all sample members
+const Password = "members-dev"
+
+// sample members, each nickname is also the name of the group granting the
+// admin role if there is one
+var samples = []struct {
+	nickname string
+	state    membership.State
+	services []string
+	group    string
+}{
+	{"member", membership.Active, []string{"htaccess", "mail", "redmine"}, ""},
+	{"trial", membership.Trial, []string{"htaccess"}, ""},
+	{"board", membership.Active, []string{"htaccess", "mail", "redmine", "wiki"}, "board"},
+	{"treasurer", membership.Active, []string{"htaccess", "mail"}, "treasurer"},
+	{"dooradmin", membership.Active, []string{"htaccess"}, "door-admin"},
+}
+
+// Directory returns a fake directory seeded with sample members, see Password
+func Directory() (dir *fakeldap.Directory, err error) {
+	password, err := ssha.Hash(Password, ssha.SSHA)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash password: %s", err)
+	}
+	doorpass, err := ssha.Hash(Password, ssha.SSHA512)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash door password: %s", err)
+	}
+
+	dir = fakeldap.New()
+	for i, s := range samples {
+		dn := fmt.Sprintf("uid=%s,ou=member,dc=backspace", s.nickname)
+		dir.Seed(dn, map[string][]string{
+			"objectClass":     {"backspaceMember"},
+			"uid":             {s.nickname},
+			"uidNumber":       {fmt.Sprintf("%d", 2001+i)},
+			"gidNumber":       {"1212"},
+			"email":           {s.nickname + "@hackerspace-bamberg.de"},
+			"alternateEmail":  {s.nickname + "@example.com"},
+			"mlAddress":       {s.nickname + "@example.com"},
+			"membershipState": {string(s.state)},
+			"serviceEnabled":  s.services,
+			"userPassword":    {password},
+			"doorPassword":    {doorpass},
+		})
+		if s.group != "" {
+			dir.Seed(fmt.Sprintf("cn=%s,ou=groups,dc=backspace", s.group), map[string][]string{
+				"objectClass": {"groupOfNames"},
+				"cn":          {s.group},
+				"member":      {dn},
+			})
+		}
+	}
+	dir.Seed("cn=laser,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"laser"},
+		"gidNumber":   {"3001"},
+		"description": {"Lasercutter Einweisung"},
+		"memberUid":   {"member", "board"},
+		"owner":       {"uid=member,ou=member,dc=backspace"},
+	})
+	return dir, nil
+}
@@ -0,0 +1,135 @@
+package devmode
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/mailer"
+)
+
+// the mail templates link to the production portal
+const portalURL = "https://members.hackerspace-bamberg.de"
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+type (
+	// Mailbox keeps all mails sent through its ConnFactory
+	Mailbox struct {
+		m     sync.Mutex
+		mails []core.CapturedMail
+		now   func() time.Time
+	}
+
+	smtpConn struct {
+		mailbox *Mailbox
+		mail    core.CapturedMail
+	}
+	dataWriter struct {
+		bytes.Buffer
+		conn *smtpConn
+	}
+)
+
+func NewMailbox() *Mailbox {
+	return &Mailbox{now: time.Now}
+}
+
+func (mb *Mailbox) ConnFactory() mailer.ConnFactory {
+	return func() (core.SmtpConn, error) {
+		return &smtpConn{mailbox: mb}, nil
+	}
+}
+
+// Mails returns the received mails, newest first
+func (mb *Mailbox) Mails() (mails []core.CapturedMail) {
+	mb.m.Lock()
+	defer mb.m.Unlock()
+	for i := len(mb.mails) - 1; i >= 0; i-- {
+		mails = append(mails, mb.mails[i])
+	}
+	return
+}
+
+func (mb *Mailbox) deliver(m core.CapturedMail) {
+	mb.m.Lock()
+	defer mb.m.Unlock()
+	m.Received = mb.now()
+	mb.mails = append(mb.mails, m)
+}
+
+func (c *smtpConn) StartTLS(*tls.Config) error {
+	return nil
+}
+
+func (c *smtpConn) Mail(from string) error {
+	c.mail.From = from
+	return nil
+}
+
+func (c *smtpConn) Rcpt(to string) error {
+	c.mail.To = append(c.mail.To, to)
+	return nil
+}
+
+func (c *smtpConn) Data() (io.WriteCloser, error) {
+	return &dataWriter{conn: c}, nil
+}
+
+func (c *smtpConn) Close() error {
+	return nil
+}
+
+func (w *dataWriter) Close() (err error) {
+	m := w.conn.mail
+	m.Raw = w.String()
+	m.Subject, m.Text, err = parseMessage(m.Raw)
+	if err != nil {
+		return err
+	}
+	for _, link := range linkPattern.FindAllString(m.Text, -1) {
+		if strings.HasPrefix(link, portalURL+"/") {
+			link = strings.TrimPrefix(link, portalURL)
+		}
+		m.Links = append(m.Links, link)
+	}
+	w.conn.mailbox.deliver(m)
+	return nil
+}
+
+// parseMessage returns the decoded subject and the text part of a mail
+func parseMessage(raw string) (subject, text string, err error) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse mail: %s", err)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to decode subject: %s", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(msg.Body)
+		return subject, string(body), err
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			return subject, "", fmt.Errorf("no text part: %s", err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			body, err := io.ReadAll(part)
+			return subject, strings.ReplaceAll(string(body), "\r\n", "\n"), err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package doorexport
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+const doorHashPrefix = "{SSHA512}"
+
+type (
+	// Snapshot is the complete list of members known to the door
+	// controller. Members are sorted by nickname, so unchanged member data
+	// always results in the same ID.
+	Snapshot struct {
+		ID        string    `json:"id"`
+		Generated time.Time `json:"generated"`
+		Members   []Member  `json:"members"`
+	}
+	Member struct {
+		Nickname     string   `json:"nickname"`
+		DoorPassword string   `json:"doorPassword"`
+		Badges       []string `json:"badges"`
+		Access       bool     `json:"access"`
+	}
+
+	// Diff contains the changes between two snapshots
+	Diff struct {
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+		Generated time.Time `json:"generated"`
+		Upsert    []Member  `json:"upsert"`
+		Remove    []string  `json:"remove"`
+	}
+
+	// Signed wraps a snapshot or diff with an ed25519 signature over the
+	// exact payload bytes
+	Signed struct {
+		Payload   json.RawMessage `json:"payload"`
+		Signature string          `json:"signature"`
+	}
+)
+
+func NewSnapshot(members []core.DoorMember, now time.Time) (s Snapshot, err error) {
+	s = Snapshot{
+		Generated: now.UTC(),
+		Members:   []Member{},
+	}
+	for _, m := range members {
+		member := Member{
+			Nickname: m.Nickname,
+			Badges:   []string{},
+		}
+		if strings.HasPrefix(m.DoorPassword, doorHashPrefix) {
+			member.DoorPassword = m.DoorPassword
+		}
+		for _, badge := range m.Badges {
+			if strings.HasPrefix(badge, doorHashPrefix) {
+				member.Badges = append(member.Badges, badge)
+			}
+		}
+		sort.Strings(member.Badges)
+		member.Access = member.DoorPassword != "" || len(member.Badges) > 0
+		s.Members = append(s.Members, member)
+	}
+	sort.Slice(s.Members, func(i, j int) bool {
+		return s.Members[i].Nickname < s.Members[j].Nickname
+	})
+
+	membersJSON, err := json.Marshal(s.Members)
+	if err != nil {
+		return s, fmt.Errorf("unable to encode members: %s", err)
+	}
+	sum := sha256.Sum256(membersJSON)
+	s.ID = hex.EncodeToString(sum[:])
+	return s, nil
+}
+
+// NewDiff returns the changes needed to turn old into new
+func NewDiff(old, new Snapshot) (d Diff) {
+	d = Diff{
+		From:      old.ID,
+		To:        new.ID,
+		Generated: new.Generated,
+		Upsert:    []Member{},
+		Remove:    []string{},
+	}
+	oldMembers := map[string]Member{}
+	for _, m := range old.Members {
+		oldMembers[m.Nickname] = m
+	}
+	for _, m := range new.Members {
+		if oldMember, ok := oldMembers[m.Nickname]; !ok || !reflect.DeepEqual(oldMember, m) {
+			d.Upsert = append(d.Upsert, m)
+		}
+		delete(oldMembers, m.Nickname)
+	}
+	for nickname := range oldMembers {
+		d.Remove = append(d.Remove, nickname)
+	}
+	sort.Strings(d.Remove)
+	return d
+}
+
+func Sign(key ed25519.PrivateKey, v interface{}) (signed Signed, err error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return signed, fmt.Errorf("unable to encode payload: %s", err)
+	}
+	return Signed{
+		Payload:   payload,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}, nil
+}
+
+// Open verifies the signature and decodes the payload into v
+func Open(key ed25519.PublicKey, signed Signed, v interface{}) (err error) {
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return fmt.Errorf("unable to decode signature: %s", err)
+	}
+	if !ed25519.Verify(key, signed.Payload, signature) {
+		return errors.New("invalid signature")
+	}
+	err = json.Unmarshal(signed.Payload, v)
+	if err != nil {
+		return fmt.Errorf("unable to decode payload: %s", err)
+	}
+	return nil
+}
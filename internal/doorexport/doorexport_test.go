@@ -0,0 +1,79 @@
+package doorexport
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	old, err := NewSnapshot([]core.DoorMember{
+		{Nickname: "member", DoorPassword: "{SSHA512}aaaa"},
+		{Nickname: "leaving", DoorPassword: "{SSHA512}bbbb"},
+		{Nickname: "new", DoorPassword: "-", Badges: []string{"{SSHA512}dddd"}},
+	}, now)
+	if err != nil {
+		t.Fatalf("unable to create snapshot: %s", err)
+	}
+	if old.Members[0].Nickname != "leaving" || !old.Members[2].Access ||
+		old.Members[2].DoorPassword != "" {
+		t.Fatalf("invalid snapshot: %+v", old.Members)
+	}
+
+	new, err := NewSnapshot([]core.DoorMember{
+		{Nickname: "new", DoorPassword: "{SSHA512}cccc"},
+		{Nickname: "member", DoorPassword: "{SSHA512}aaaa"},
+	}, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to create snapshot: %s", err)
+	}
+	d := NewDiff(old, new)
+	if d.From != old.ID || d.To != new.ID || old.ID == new.ID {
+		t.Fatalf("invalid diff ids: %+v", d)
+	}
+	wantUpsert := []Member{
+		{Nickname: "new", DoorPassword: "{SSHA512}cccc", Badges: []string{}, Access: true},
+	}
+	if !reflect.DeepEqual(d.Upsert, wantUpsert) {
+		t.Fatalf("invalid upserts: %+v", d.Upsert)
+	}
+	if !reflect.DeepEqual(d.Remove, []string{"leaving"}) {
+		t.Fatalf("invalid removals: %+v", d.Remove)
+	}
+
+	same, _ := NewSnapshot([]core.DoorMember{
+		{Nickname: "member", DoorPassword: "{SSHA512}aaaa"},
+		{Nickname: "new", DoorPassword: "{SSHA512}cccc"},
+	}, now.Add(2*time.Hour))
+	if same.ID != new.ID {
+		t.Fatalf("snapshot id is not stable")
+	}
+}
+
+func TestSign(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signed, err := Sign(priv, Snapshot{ID: "1234"})
+	if err != nil {
+		t.Fatalf("unable to sign: %s", err)
+	}
+	c, _ := json.Marshal(signed)
+	decoded := Signed{}
+	_ = json.Unmarshal(c, &decoded)
+
+	s := Snapshot{}
+	err = Open(pub, decoded, &s)
+	if err != nil || s.ID != "1234" {
+		t.Fatalf("unable to open: %s", err)
+	}
+	decoded.Payload = json.RawMessage(`{"id":"4321"}`)
+	err = Open(pub, decoded, &s)
+	if err == nil {
+		t.Fatalf("tampered payload accepted")
+	}
+}
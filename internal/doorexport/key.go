@@ -0,0 +1,49 @@
+package doorexport
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+func GenerateKey() (private, public []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate key: %s", err)
+	}
+	privDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode private key: %s", err)
+	}
+	pubDer, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode public key: %s", err)
+	}
+	private = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer})
+	public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer})
+	return private, public, nil
+}
+
+func LoadKey(file string) (key ed25519.PrivateKey, err error) {
+	c, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key: %s", err)
+	}
+	block, _ := pem.Decode(c)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key: %s", err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is no ed25519 key")
+	}
+	return key, nil
+}
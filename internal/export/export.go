@@ -0,0 +1,104 @@
+// Package export bundles everything we store about a member, so they can
+// download it as demanded by the GDPR
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/b4ckspace/members/internal/audit"
+)
+
+type (
+	Data struct {
+		Generated    time.Time           `json:"generated"`
+		Nickname     string              `json:"nickname"`
+		Attributes   map[string][]string `json:"attributes"`
+		MailingLists []string            `json:"mailingLists"`
+		AuditEvents  []audit.Event       `json:"auditEvents"`
+	}
+)
+
+// Archive creates a zip file with the data as data.json and as readable
+// text in data.txt
+func Archive(d Data) (archive []byte, err error) {
+	js, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode data: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"data.json", js},
+		{"data.txt", Text(d)},
+	}
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: d.Generated,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to add %s: %s", file.name, err)
+		}
+		_, err = w.Write(file.content)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write %s: %s", file.name, err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to finish archive: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Text renders the data for humans
+func Text(d Data) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Gespeicherte Daten von %s\n", d.Nickname)
+	fmt.Fprintf(buf, "Erstellt am %s\n\n", d.Generated.Format("02.01.2006 15:04"))
+
+	fmt.Fprintf(buf, "Verzeichnis-Eintrag\n-------------------\n")
+	names := make([]string, 0, len(d.Attributes))
+	for name := range d.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		for _, value := range d.Attributes[name] {
+			fmt.Fprintf(tw, "%s\t%s\n", name, strings.ReplaceAll(value, "\n", " "))
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(buf, "\nMailinglisten\n-------------\n")
+	if len(d.MailingLists) == 0 {
+		fmt.Fprintf(buf, "keine\n")
+	}
+	for _, list := range d.MailingLists {
+		fmt.Fprintf(buf, "%s\n", list)
+	}
+
+	fmt.Fprintf(buf, "\nProtokoll\n---------\n")
+	if len(d.AuditEvents) == 0 {
+		fmt.Fprintf(buf, "keine Einträge\n")
+	}
+	tw = tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	for _, e := range d.AuditEvents {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Time.Format("02.01.2006 15:04"), e.Actor, e.Action, e.Detail)
+	}
+	tw.Flush()
+	return buf.Bytes()
+}
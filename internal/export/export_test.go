@@ -0,0 +1,80 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b4ckspace/members/internal/audit"
+)
+
+func TestArchive(t *testing.T) {
+	d := Data{
+		Generated: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Nickname:  "member",
+		Attributes: map[string][]string{
+			"uid":            {"member"},
+			"alternateEmail": {"member@example.com"},
+		},
+		MailingLists: []string{"intern.example.com"},
+		AuditEvents: []audit.Event{
+			{Actor: "admin", Subject: "member", Action: "membership", Detail: "active: welcome"},
+		},
+	}
+	archive, err := Archive(d)
+	if err != nil {
+		t.Fatalf("unable to create archive: %s", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("invalid archive: %s", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		fh, err := f.Open()
+		if err != nil {
+			t.Fatalf("unable to open %s: %s", f.Name, err)
+		}
+		c, _ := io.ReadAll(fh)
+		files[f.Name] = string(c)
+	}
+
+	decoded := Data{}
+	err = json.Unmarshal([]byte(files["data.json"]), &decoded)
+	if err != nil || decoded.Attributes["alternateEmail"][0] != "member@example.com" {
+		t.Fatalf("invalid data.json: %s %s", files["data.json"], err)
+	}
+	for _, want := range []string{"member@example.com", "intern.example.com", "active: welcome"} {
+		if !strings.Contains(files["data.txt"], want) {
+			t.Fatalf("%s missing in data.txt: %s", want, files["data.txt"])
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.Now()
+	s := NewStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	token, err := s.Put("member", []byte("zip"))
+	if err != nil {
+		t.Fatalf("unable to store: %s", err)
+	}
+	_, err = s.Get(token, "other")
+	if err != ErrNotFound {
+		t.Fatalf("archive handed to other member: %s", err)
+	}
+	archive, err := s.Get(token, "member")
+	if err != nil || string(archive) != "zip" {
+		t.Fatalf("unable to get archive: %s", err)
+	}
+	now = now.Add(2 * time.Hour)
+	_, err = s.Get(token, "member")
+	if err != ErrNotFound {
+		t.Fatalf("archive not expired: %s", err)
+	}
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// Store keeps finished archives until they are downloaded or expire
+	Store struct {
+		ttl time.Duration
+		now func() time.Time
+
+		m       sync.Mutex
+		byToken map[string]stored
+	}
+	stored struct {
+		nickname string
+		archive  []byte
+		expires  time.Time
+	}
+)
+
+var ErrNotFound = errors.New("no export found")
+
+func NewStore(ttl time.Duration) (s *Store) {
+	return &Store{
+		ttl:     ttl,
+		now:     time.Now,
+		byToken: map[string]stored{},
+	}
+}
+
+// Put stores the archive of nickname, replacing an older one, and returns
+// the token for the download link
+func (s *Store) Put(nickname string, archive []byte) (token string, err error) {
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate random token: %s", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(random)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.expire()
+	for t, st := range s.byToken {
+		if st.nickname == nickname {
+			delete(s.byToken, t)
+		}
+	}
+	s.byToken[token] = stored{
+		nickname: nickname,
+		archive:  archive,
+		expires:  s.now().Add(s.ttl),
+	}
+	return token, nil
+}
+
+// Get returns the archive for token, if it belongs to nickname
+func (s *Store) Get(token, nickname string) (archive []byte, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.expire()
+	st, ok := s.byToken[token]
+	if !ok || st.nickname != nickname {
+		return nil, ErrNotFound
+	}
+	return st.archive, nil
+}
+
+func (s *Store) expire() {
+	now := s.now()
+	for token, st := range s.byToken {
+		if now.After(st.expires) {
+			delete(s.byToken, token)
+		}
+	}
+}
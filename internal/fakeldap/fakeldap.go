@@ -0,0 +1,411 @@
+// Package fakeldap is an in-memory directory implementing core.LdapConn. It
+// understands enough of LDAP for our own queries and is used by tests and the
+// development mode.
+package fakeldap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type (
+	Directory struct {
+		m       sync.Mutex
+		entries map[string]*ldap.Entry
+	}
+)
+
+func New() (d *Directory) {
+	return &Directory{entries: map[string]*ldap.Entry{}}
+}
+
+// Seed adds an entry, attributes are given as name and values
+func (d *Directory) Seed(dn string, attributes map[string][]string) {
+	req := ldap.NewAddRequest(dn, []ldap.Control{})
+	for name, values := range attributes {
+		req.Attribute(name, values)
+	}
+	err := d.Add(req)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Entry returns a copy of the entry at dn
+func (d *Directory) Entry(dn string) (entry *ldap.Entry, ok bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	e, ok := d.entries[normalizeDN(dn)]
+	if !ok {
+		return nil, false
+	}
+	return copyEntry(e, nil), true
+}
+
+func (d *Directory) Add(req *ldap.AddRequest) (err error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	key := normalizeDN(req.DN)
+	if _, ok := d.entries[key]; ok {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("%s exists", req.DN))
+	}
+	entry := &ldap.Entry{DN: req.DN}
+	for _, attr := range req.Attributes {
+		entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{
+			Name:   attr.Type,
+			Values: append([]string{}, attr.Vals...),
+		})
+	}
+	d.entries[key] = entry
+	return nil
+}
+
+func (d *Directory) Modify(req *ldap.ModifyRequest) (err error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	entry, ok := d.entries[normalizeDN(req.DN)]
+	if !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("%s not found", req.DN))
+	}
+	modified := copyEntry(entry, nil)
+	for _, change := range req.Changes {
+		name := change.Modification.Type
+		values := change.Modification.Vals
+		attr := attribute(modified, name)
+		switch change.Operation {
+		case ldap.AddAttribute:
+			if attr == nil {
+				attr = &ldap.EntryAttribute{Name: name}
+				modified.Attributes = append(modified.Attributes, attr)
+			}
+			for _, value := range values {
+				if containsFold(attr.Values, value) {
+					return ldap.NewError(ldap.LDAPResultAttributeOrValueExists, fmt.Errorf("%s: %s exists", name, value))
+				}
+				attr.Values = append(attr.Values, value)
+			}
+		case ldap.DeleteAttribute:
+			if attr == nil {
+				return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("no attribute %s", name))
+			}
+			if len(values) == 0 {
+				attr.Values = nil
+			}
+			for _, value := range values {
+				if !containsFold(attr.Values, value) {
+					return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("%s: no value %s", name, value))
+				}
+				attr.Values = removeFold(attr.Values, value)
+			}
+		case ldap.ReplaceAttribute:
+			if attr == nil {
+				attr = &ldap.EntryAttribute{Name: name}
+				modified.Attributes = append(modified.Attributes, attr)
+			}
+			attr.Values = append([]string{}, values...)
+		default:
+			return ldap.NewError(ldap.LDAPResultProtocolError, fmt.Errorf("unknown operation %d", change.Operation))
+		}
+	}
+	d.entries[normalizeDN(req.DN)] = copyEntry(modified, nil)
+	return nil
+}
+
+func (d *Directory) ModifyDN(req *ldap.ModifyDNRequest) (err error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	key := normalizeDN(req.DN)
+	entry, ok := d.entries[key]
+	if !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("%s not found", req.DN))
+	}
+	parent := req.NewSuperior
+	if parent == "" {
+		parts := strings.SplitN(req.DN, ",", 2)
+		if len(parts) == 2 {
+			parent = parts[1]
+		}
+	}
+	newDN := req.NewRDN
+	if parent != "" {
+		newDN += "," + parent
+	}
+	if _, exists := d.entries[normalizeDN(newDN)]; exists {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("%s exists", newDN))
+	}
+	moved := copyEntry(entry, nil)
+	moved.DN = newDN
+	// the naming attribute follows the new rdn
+	oldRDN := strings.SplitN(entry.DN, ",", 2)[0]
+	if name, value, ok := strings.Cut(oldRDN, "="); ok && req.DeleteOldRDN {
+		if attr := attribute(moved, name); attr != nil {
+			attr.Values = removeFold(attr.Values, value)
+		}
+	}
+	if name, value, ok := strings.Cut(req.NewRDN, "="); ok {
+		attr := attribute(moved, name)
+		if attr == nil {
+			attr = &ldap.EntryAttribute{Name: name}
+			moved.Attributes = append(moved.Attributes, attr)
+		}
+		if !containsFold(attr.Values, value) {
+			attr.Values = append(attr.Values, value)
+		}
+	}
+	delete(d.entries, key)
+	d.entries[normalizeDN(newDN)] = moved
+	return nil
+}
+
+func (d *Directory) Del(req *ldap.DelRequest) (err error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	key := normalizeDN(req.DN)
+	if _, ok := d.entries[key]; !ok {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("%s not found", req.DN))
+	}
+	for dn := range d.entries {
+		if strings.HasSuffix(dn, ","+key) {
+			return ldap.NewError(ldap.LDAPResultNotAllowedOnNonLeaf, fmt.Errorf("%s has children", req.DN))
+		}
+	}
+	delete(d.entries, key)
+	return nil
+}
+
+// Search supports all scopes and the filter types we use. The paged results
+// control is honored with the offset of the next page as cookie, other
+// controls are ignored.
+func (d *Directory) Search(req *ldap.SearchRequest) (sr *ldap.SearchResult, err error) {
+	filter, err := ldap.CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	d.m.Lock()
+	defer d.m.Unlock()
+	base := normalizeDN(req.BaseDN)
+	sr = &ldap.SearchResult{}
+	dns := make([]string, 0, len(d.entries))
+	for dn := range d.entries {
+		dns = append(dns, dn)
+	}
+	sort.Strings(dns)
+	for _, dn := range dns {
+		if !inScope(dn, base, req.Scope) {
+			continue
+		}
+		entry := d.entries[dn]
+		ok, err := match(entry, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sr.Entries = append(sr.Entries, copyEntry(entry, req.Attributes))
+		}
+	}
+	if paging, ok := ldap.FindControl(req.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+		sr.Entries, sr.Controls, err = page(sr.Entries, paging)
+	}
+	return sr, err
+}
+
+func page(entries []*ldap.Entry, paging *ldap.ControlPaging) (
+	result []*ldap.Entry, controls []ldap.Control, err error,
+) {
+	offset := 0
+	if len(paging.Cookie) > 0 {
+		offset, err = strconv.Atoi(string(paging.Cookie))
+		if err != nil || offset > len(entries) {
+			return nil, nil, ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("invalid cookie"))
+		}
+	}
+	// a size of 0 abandons the result set
+	if paging.PagingSize == 0 {
+		return nil, []ldap.Control{ldap.NewControlPaging(0)}, nil
+	}
+	end := min(offset+int(paging.PagingSize), len(entries))
+	next := ldap.NewControlPaging(0)
+	if end < len(entries) {
+		next.SetCookie([]byte(strconv.Itoa(end)))
+	}
+	return entries[offset:end], []ldap.Control{next}, nil
+}
+
+func (d *Directory) Close() error {
+	return nil
+}
+
+func inScope(dn, base string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == base
+	default:
+		return dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+func match(entry *ldap.Entry, filter *ber.Packet) (ok bool, err error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			ok, err = match(entry, child)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			ok, err = match(entry, child)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		ok, err = match(entry, filter.Children[0])
+		return !ok, err
+	case ldap.FilterPresent:
+		name, _ := filter.Value.(string)
+		if strings.EqualFold(name, "objectClass") {
+			return true, nil
+		}
+		attr := attribute(entry, name)
+		return attr != nil && len(attr.Values) > 0, nil
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		if strings.EqualFold(name, "entryDN") {
+			return normalizeDN(entry.DN) == normalizeDN(value), nil
+		}
+		attr := attribute(entry, name)
+		return attr != nil && containsFold(attr.Values, value), nil
+	case ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, v := range entry.GetAttributeValues(name) {
+			if filter.Tag == ldap.FilterGreaterOrEqual && compare(v, value) >= 0 ||
+				filter.Tag == ldap.FilterLessOrEqual && compare(v, value) <= 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterSubstrings:
+		name, _ := filter.Children[0].Value.(string)
+		for _, v := range entry.GetAttributeValues(name) {
+			if matchSubstrings(strings.ToLower(v), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, errors.New("unsupported filter")
+	}
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s, _ := part.Value.(string)
+		s = strings.ToLower(s)
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compare orders numbers numerically and everything else as strings
+func compare(a, b string) int {
+	if len(a) != len(b) && isNumber(a) && isNumber(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func attribute(entry *ldap.Entry, name string) *ldap.EntryAttribute {
+	for _, attr := range entry.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			return attr
+		}
+	}
+	return nil
+}
+
+// copyEntry copies entry with the given attributes, all for none or "*",
+// leaving out empty ones
+func copyEntry(entry *ldap.Entry, attrs []string) *ldap.Entry {
+	all := len(attrs) == 0 || containsFold(attrs, "*")
+	c := &ldap.Entry{DN: entry.DN}
+	for _, attr := range entry.Attributes {
+		if len(attr.Values) == 0 || !all && !containsFold(attrs, attr.Name) {
+			continue
+		}
+		c.Attributes = append(c.Attributes, &ldap.EntryAttribute{
+			Name:   attr.Name,
+			Values: append([]string{}, attr.Values...),
+		})
+	}
+	return c
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFold(values []string, value string) (rest []string) {
+	for _, v := range values {
+		if !strings.EqualFold(v, value) {
+			rest = append(rest, v)
+		}
+	}
+	return rest
+}
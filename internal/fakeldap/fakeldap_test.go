@@ -0,0 +1,78 @@
+package fakeldap
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestDirectory(t *testing.T) {
+	d := New()
+	d.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass":    {"backspaceMember"},
+		"uid":            {"member"},
+		"uidNumber":      {"1005"},
+		"alternateEmail": {"Member@Example.com"},
+	})
+	d.Seed("uid=other,ou=inactiveMember,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"other"},
+		"uidNumber":   {"999"},
+	})
+
+	searchOpts := []struct {
+		base   string
+		filter string
+		want   int
+	}{
+		{"dc=backspace", "(objectClass=backspaceMember)", 2},
+		{"ou=member,dc=backspace", "(objectClass=backspaceMember)", 1},
+		{"dc=backspace", "(alternateEmail=member@example.com)", 1},
+		{"dc=backspace", "(&(objectClass=backspaceMember)(uid=*the*))", 1},
+		{"dc=backspace", "(|(uid=member)(uid=other))", 2},
+		{"dc=backspace", "(!(uid=member))", 1},
+		{"dc=backspace", "(uidNumber>=1000)", 1},
+		{"dc=backspace", "(serviceEnabled=*)", 0},
+	}
+	for _, o := range searchOpts {
+		sr, err := d.Search(ldap.NewSearchRequest(
+			o.base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			o.filter, []string{"uid"}, nil,
+		))
+		if err != nil || len(sr.Entries) != o.want {
+			t.Fatalf("invalid result for %s: %v %s", o.filter, sr, err)
+		}
+	}
+
+	req := ldap.NewModifyRequest("uid=member,ou=member,dc=backspace", nil)
+	req.Add("serviceEnabled", []string{"mail", "wiki"})
+	req.Delete("alternateEmail", []string{})
+	err := d.Modify(req)
+	if err != nil {
+		t.Fatalf("unable to modify: %s", err)
+	}
+	req = ldap.NewModifyRequest("uid=member,ou=member,dc=backspace", nil)
+	req.Add("serviceEnabled", []string{"mail"})
+	if d.Modify(req) == nil {
+		t.Fatalf("duplicate value added")
+	}
+
+	err = d.ModifyDN(ldap.NewModifyDNRequest(
+		"uid=member,ou=member,dc=backspace", "uid=member", true, "ou=inactiveMember,dc=backspace",
+	))
+	if err != nil {
+		t.Fatalf("unable to move: %s", err)
+	}
+	entry, ok := d.Entry("uid=member,ou=inactiveMember,dc=backspace")
+	if !ok || len(entry.GetAttributeValues("serviceEnabled")) != 2 || entry.GetAttributeValue("alternateEmail") != "" {
+		t.Fatalf("invalid entry after move: %+v", entry)
+	}
+
+	err = d.Del(ldap.NewDelRequest("uid=member,ou=inactiveMember,dc=backspace", nil))
+	if err != nil {
+		t.Fatalf("unable to delete: %s", err)
+	}
+	if _, ok = d.Entry("uid=member,ou=inactiveMember,dc=backspace"); ok {
+		t.Fatalf("entry not deleted")
+	}
+}
@@ -0,0 +1,198 @@
+// Package fakewebauthn is a software authenticator for tests. It answers the
+// options the server hands to navigator.credentials.create() and get() with
+// the JSON a browser would post back.
+package fakewebauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+type (
+	Authenticator struct {
+		origin      string
+		credentials []*credential
+	}
+	credential struct {
+		id         []byte
+		rpID       string
+		userHandle []byte
+		key        *ecdsa.PrivateKey
+		counter    uint32
+	}
+
+	creationOptions struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RP        struct {
+				ID string `json:"id"`
+			} `json:"rp"`
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	requestOptions struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			RPID      string `json:"rpId"`
+		} `json:"publicKey"`
+	}
+	clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// New creates an authenticator used on pages of origin
+func New(origin string) *Authenticator {
+	return &Authenticator{origin: origin}
+}
+
+// Create answers creation options with a new credential
+func (a *Authenticator) Create(options []byte) (response []byte, err error) {
+	o := creationOptions{}
+	err = json.Unmarshal(options, &o)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creation options: %s", err)
+	}
+	userHandle, err := b64.DecodeString(o.PublicKey.User.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %s", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	c := &credential{
+		id:         make([]byte, 16),
+		rpID:       o.PublicKey.RP.ID,
+		userHandle: userHandle,
+		key:        key,
+	}
+	_, err = rand.Read(c.id)
+	if err != nil {
+		return nil, err
+	}
+	a.credentials = append(a.credentials, c)
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	authData := c.authData(flagUserPresent | flagUserVerified | flagAttested)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(c.id)))
+	authData = append(authData, c.id...)
+	authData = append(authData, publicKey...)
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, err := a.clientData("webauthn.create", o.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(c.id),
+		"rawId": b64.EncodeToString(c.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientDataJSON),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+}
+
+// Get answers request options with an assertion of the newest credential
+// for the relying party
+func (a *Authenticator) Get(options []byte) (response []byte, err error) {
+	o := requestOptions{}
+	err = json.Unmarshal(options, &o)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request options: %s", err)
+	}
+	var c *credential
+	for _, candidate := range a.credentials {
+		if candidate.rpID == o.PublicKey.RPID {
+			c = candidate
+		}
+	}
+	if c == nil {
+		return nil, errors.New("no credential for relying party")
+	}
+	c.counter++
+
+	authData := c.authData(flagUserPresent | flagUserVerified)
+	clientDataJSON, err := a.clientData("webauthn.get", o.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(c.id),
+		"rawId": b64.EncodeToString(c.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientDataJSON),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(c.userHandle),
+		},
+	})
+}
+
+// Rewind resets the sign counters, as a cloned authenticator would
+func (a *Authenticator) Rewind() {
+	for _, c := range a.credentials {
+		c.counter = 0
+	}
+}
+
+func (c *credential) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, flags)
+	return binary.BigEndian.AppendUint32(authData, c.counter)
+}
+
+func (a *Authenticator) clientData(typ, challenge string) ([]byte, error) {
+	return json.Marshal(clientData{
+		Type:      typ,
+		Challenge: challenge,
+		Origin:    a.origin,
+	})
+}
@@ -0,0 +1,112 @@
+package ldapwrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Offboarded members are moved to ou=archivedMember. deleteAfter holds the
+// end of the retention period as generalized time, after which the entry is
+// deleted for good.
+
+const archiveOU = "ou=archivedMember,dc=backspace"
+
+// DisableLogin replaces the password hash with a value no password matches,
+// invalidates a pending password reset and removes passkeys and the second
+// factor
+func (l *LdapWrap) DisableLogin(uid string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("userPassword", []string{"-"})
+	req.Replace("token", []string{"**invalidated**"})
+	req.Replace("webauthnCredential", []string{})
+	req.Replace("totpSecret", []string{})
+	req.Replace("totpRecoveryCode", []string{})
+	req.Replace("totpCounter", []string{})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to disable login: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) Archive(uid string, deleteAfter time.Time) (err error) {
+	member, err := l.findMember(uid, []string{"uid"})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("deleteAfter", []string{deleteAfter.UTC().Format("20060102150405Z")})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to schedule deletion: %s", err)
+	}
+	rdn := fmt.Sprintf("uid=%s", ldap.EscapeDN(member.GetAttributeValue("uid")))
+	err = l.conn.ModifyDN(ldap.NewModifyDNRequest(member.DN, rdn, true, archiveOU))
+	if err != nil {
+		return fmt.Errorf("unable to move member to archive: %s", err)
+	}
+	return nil
+}
+
+// ExpiredArchives lists archived members whose retention period ended
+// before now
+func (l *LdapWrap) ExpiredArchives(now time.Time) (archives []core.Archive, err error) {
+	sr, err := l.SearchArchived("(&(objectClass=backspaceMember)(deleteAfter=*))", []string{"uid", "deleteAfter"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search: %s", err)
+	}
+	for _, member := range sr.Entries {
+		deleteAfter, err := time.Parse("20060102150405Z", member.GetAttributeValue("deleteAfter"))
+		if err != nil || deleteAfter.After(now) {
+			continue
+		}
+		archives = append(archives, core.Archive{
+			Nickname:    member.GetAttributeValue("uid"),
+			DeleteAfter: deleteAfter,
+		})
+	}
+	return archives, nil
+}
+
+// DeleteArchived removes an archived member. Active and inactive members are
+// never deleted.
+func (l *LdapWrap) DeleteArchived(uid string) (err error) {
+	filter := fmt.Sprintf("(&(objectClass=backspaceMember)(uid=%s))", EscapeFilter(uid))
+	sr, err := l.SearchArchived(filter, []string{})
+	if err != nil {
+		return fmt.Errorf("unable to search: %s", err)
+	}
+	if len(sr.Entries) != 1 {
+		return fmt.Errorf("unable to find archived user with nickname: %s", uid)
+	}
+	if !strings.HasSuffix(strings.ToLower(sr.Entries[0].DN), ","+strings.ToLower(archiveOU)) {
+		return fmt.Errorf("refusing to delete %s", sr.Entries[0].DN)
+	}
+	err = l.conn.Del(ldap.NewDelRequest(sr.Entries[0].DN, []ldap.Control{}))
+	if err != nil {
+		return fmt.Errorf("unable to delete member: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) SearchArchived(filter string, attrs []string) (sr *ldap.SearchResult, err error) {
+	r := ldap.NewSearchRequest(
+		archiveOU,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attrs,
+		[]ldap.Control{},
+	)
+	return l.conn.Search(r)
+}
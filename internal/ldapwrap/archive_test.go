@@ -0,0 +1,121 @@
+package ldapwrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/b4ckspace/members/internal/fakeldap"
+)
+
+func TestArchive(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	dir.Seed("uid=other,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"other"},
+	})
+	l := &LdapWrap{conn: dir}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	err := l.Archive("member", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unable to archive: %s", err)
+	}
+	err = l.Archive("other", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unable to archive: %s", err)
+	}
+	if _, ok := dir.Entry("uid=member,ou=archivedMember,dc=backspace"); !ok {
+		t.Fatalf("member not moved to archive")
+	}
+
+	archives, err := l.ExpiredArchives(now)
+	if err != nil {
+		t.Fatalf("unable to list expired archives: %s", err)
+	}
+	if len(archives) != 1 || archives[0].Nickname != "member" {
+		t.Fatalf("invalid expired archives: %+v", archives)
+	}
+	err = l.DeleteArchived(archives[0].Nickname)
+	if err != nil {
+		t.Fatalf("unable to delete archived member: %s", err)
+	}
+	if _, ok := dir.Entry("uid=member,ou=archivedMember,dc=backspace"); ok {
+		t.Fatalf("archived member not deleted")
+	}
+	if _, ok := dir.Entry("uid=other,ou=archivedMember,dc=backspace"); !ok {
+		t.Fatalf("member within retention period deleted")
+	}
+}
+
+func TestDeleteArchivedActive(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	err := l.DeleteArchived("member")
+	if err == nil {
+		t.Fatalf("active member deleted")
+	}
+	if _, ok := dir.Entry("uid=member,ou=member,dc=backspace"); !ok {
+		t.Fatalf("active member missing")
+	}
+}
+
+func TestArchivedMemberReserved(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+		"uidNumber":   {"1000"},
+	})
+	dir.Seed("uid=left,ou=archivedMember,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"left"},
+		"uidNumber":   {"1001"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	exists, err := l.MemberExists("left")
+	if err != nil || !exists {
+		t.Fatalf("archived nickname not taken: %v %s", exists, err)
+	}
+	uidNumber, err := l.NextUidNumber()
+	if err != nil || uidNumber != 1002 {
+		t.Fatalf("invalid uid number: %d %s", uidNumber, err)
+	}
+}
+
+func TestDisableLogin(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass":        {"backspaceMember"},
+		"uid":                {"member"},
+		"userPassword":       {"{SSHA}x"},
+		"webauthnCredential": {"passkey"},
+		"totpSecret":         {"JBSWY3DPEHPK3PXP"},
+		"totpRecoveryCode":   {"{SSHA512}y"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	err := l.DisableLogin("member")
+	if err != nil {
+		t.Fatalf("unable to disable login: %s", err)
+	}
+	_, enabled, err := l.LoginEnabled("member")
+	if err != nil || enabled {
+		t.Fatalf("login still enabled: %s", err)
+	}
+	member, _ := dir.Entry("uid=member,ou=member,dc=backspace")
+	for _, attr := range []string{"webauthnCredential", "totpSecret", "totpRecoveryCode"} {
+		if values := member.GetAttributeValues(attr); len(values) != 0 {
+			t.Fatalf("%s not removed: %v", attr, values)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ldapwrap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ssha"
+)
+
+// Badges are stored in the multi valued doorBadge attribute as
+// "<id> <created unix> <{SSHA512}hash> <label>"
+
+var ErrBadgeExists = errors.New("badge is already enrolled")
+
+func (l *LdapWrap) AddBadge(uid, badgeUID, label string) (badge core.Badge, err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return badge, err
+	}
+
+	// badge uids are hashed, so every enrolled badge has to be checked
+	sr, err := l.SearchActiveAndInactive("(&(objectClass=backspaceMember)(doorBadge=*))", []string{"doorBadge"})
+	if err != nil {
+		return badge, fmt.Errorf("unable to search: %s", err)
+	}
+	for _, entry := range sr.Entries {
+		for _, value := range entry.GetAttributeValues("doorBadge") {
+			existing, err := parseBadge(value)
+			if err != nil {
+				continue
+			}
+			ok, _ := ssha.Verify(badgeUID, existing.Hash)
+			if ok {
+				return badge, ErrBadgeExists
+			}
+		}
+	}
+
+	id := make([]byte, 4)
+	_, err = rand.Read(id)
+	if err != nil {
+		return badge, fmt.Errorf("unable to generate badge id: %s", err)
+	}
+	hash, err := ssha.Hash(badgeUID, ssha.SSHA512)
+	if err != nil {
+		return badge, fmt.Errorf("unable to hash badge: %s", err)
+	}
+	badge = core.Badge{
+		ID:      hex.EncodeToString(id),
+		Label:   label,
+		Hash:    hash,
+		Created: time.Now().Truncate(time.Second),
+	}
+
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Add("doorBadge", []string{formatBadge(badge)})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return badge, fmt.Errorf("unable to add badge: %s", err)
+	}
+	return badge, nil
+}
+
+func (l *LdapWrap) Badges(uid string) (badges []core.Badge, err error) {
+	member, err := l.findMember(uid, []string{"doorBadge"})
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range member.GetAttributeValues("doorBadge") {
+		badge, err := parseBadge(value)
+		if err != nil {
+			return nil, err
+		}
+		badges = append(badges, badge)
+	}
+	return badges, nil
+}
+
+func (l *LdapWrap) RevokeBadge(uid, badgeID string) (err error) {
+	member, err := l.findMember(uid, []string{"doorBadge"})
+	if err != nil {
+		return err
+	}
+	for _, value := range member.GetAttributeValues("doorBadge") {
+		badge, err := parseBadge(value)
+		if err != nil || badge.ID != badgeID {
+			continue
+		}
+		req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+		req.Delete("doorBadge", []string{value})
+		err = l.conn.Modify(req)
+		if err != nil {
+			return fmt.Errorf("unable to revoke badge: %s", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to find badge %s", badgeID)
+}
+
+func formatBadge(badge core.Badge) string {
+	return fmt.Sprintf("%s %d %s %s", badge.ID, badge.Created.Unix(), badge.Hash, badge.Label)
+}
+
+func parseBadge(value string) (badge core.Badge, err error) {
+	parts := strings.SplitN(value, " ", 4)
+	if len(parts) < 3 {
+		return badge, fmt.Errorf("invalid badge: %s", value)
+	}
+	created, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return badge, fmt.Errorf("invalid badge timestamp: %s", err)
+	}
+	badge = core.Badge{
+		ID:      parts[0],
+		Created: time.Unix(created, 0),
+		Hash:    parts[2],
+	}
+	if len(parts) == 4 {
+		badge.Label = parts[3]
+	}
+	return badge, nil
+}
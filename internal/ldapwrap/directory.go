@@ -0,0 +1,123 @@
+package ldapwrap
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// DirectoryOUs are the organizational units members can live in
+var DirectoryOUs = []string{"member", "inactiveMember", "archivedMember"}
+
+// Directory lists members matching q. Pages are fetched with the paged
+// results control. Cookies are bound to the connection, so the pages before
+// q.Page are read and skipped. A PageSize of 0 returns all members.
+func (l *LdapWrap) Directory(q core.DirectoryQuery) (entries []core.DirectoryEntry, more bool, err error) {
+	if q.State != "" {
+		return l.directoryByState(q)
+	}
+	base := "dc=backspace"
+	if q.OU != "" {
+		if !slices.Contains(DirectoryOUs, q.OU) {
+			return nil, false, fmt.Errorf("invalid ou: %s", q.OU)
+		}
+		base = fmt.Sprintf("ou=%s,dc=backspace", q.OU)
+	}
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+
+	paging := ldap.NewControlPaging(uint32(pageSize))
+	for page := 0; ; page++ {
+		sr, err := l.conn.Search(ldap.NewSearchRequest(
+			base,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0, 0, false,
+			directoryFilter(q),
+			[]string{"uid", "membershipState", "email", "alternateEmail", "mlAddress", "serviceEnabled"},
+			[]ldap.Control{paging},
+		))
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to search: %s", err)
+		}
+		if q.PageSize <= 0 || page == q.Page {
+			for _, member := range sr.Entries {
+				entries = append(entries, directoryEntry(member))
+			}
+		}
+
+		var cookie []byte
+		if c, ok := ldap.FindControl(sr.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+			cookie = c.Cookie
+		}
+		if len(cookie) == 0 {
+			return entries, false, nil
+		}
+		paging.SetCookie(cookie)
+		if q.PageSize > 0 && page == q.Page {
+			// a page size of 0 tells the server to drop the result set
+			paging.PagingSize = 0
+			_, _ = l.conn.Search(ldap.NewSearchRequest(
+				base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+				directoryFilter(q), []string{"uid"}, []ldap.Control{paging},
+			))
+			return entries, true, nil
+		}
+	}
+}
+
+// directoryByState filters and pages in memory. Entries predating the
+// lifecycle have no membershipState, their state follows from the OU.
+func (l *LdapWrap) directoryByState(q core.DirectoryQuery) (entries []core.DirectoryEntry, more bool, err error) {
+	all := q
+	all.State, all.Page, all.PageSize = "", 0, 0
+	entries, _, err = l.Directory(all)
+	if err != nil {
+		return nil, false, err
+	}
+	entries = slices.DeleteFunc(entries, func(e core.DirectoryEntry) bool {
+		return e.State != q.State
+	})
+	if q.PageSize <= 0 {
+		return entries, false, nil
+	}
+	start := min(q.Page*q.PageSize, len(entries))
+	end := min(start+q.PageSize, len(entries))
+	return entries[start:end], end < len(entries), nil
+}
+
+func directoryFilter(q core.DirectoryQuery) string {
+	filter := "(objectClass=backspaceMember)"
+	if q.Service != "" {
+		filter += fmt.Sprintf("(serviceEnabled=%s)", EscapeFilter(q.Service))
+	}
+	if q.Search != "" {
+		s := EscapeFilter(q.Search)
+		filter += fmt.Sprintf(
+			"(|(uid=*%s*)(email=*%s*)(alternateEmail=*%s*)(mlAddress=*%s*))",
+			s, s, s, s,
+		)
+	}
+	return "(&" + filter + ")"
+}
+
+func directoryEntry(member *ldap.Entry) core.DirectoryEntry {
+	entry := core.DirectoryEntry{
+		Nickname:       member.GetAttributeValue("uid"),
+		State:          membershipState(member),
+		Email:          member.GetAttributeValue("email"),
+		AlternateEmail: member.GetAttributeValue("alternateEmail"),
+		MlAddress:      member.GetAttributeValue("mlAddress"),
+		Services:       member.GetAttributeValues("serviceEnabled"),
+	}
+	dn, err := ldap.ParseDN(member.DN)
+	if err == nil && len(dn.RDNs) > 1 && len(dn.RDNs[1].Attributes) > 0 {
+		entry.OU = dn.RDNs[1].Attributes[0].Value
+	}
+	return entry
+}
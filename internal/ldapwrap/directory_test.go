@@ -0,0 +1,119 @@
+package ldapwrap
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/membership"
+)
+
+func TestDirectoryFilter(t *testing.T) {
+	filterOpts := []struct {
+		q    core.DirectoryQuery
+		want string
+	}{
+		{core.DirectoryQuery{}, "(&(objectClass=backspaceMember))"},
+		{
+			core.DirectoryQuery{Service: "wiki", State: membership.Active},
+			"(&(objectClass=backspaceMember)(serviceEnabled=wiki))",
+		},
+		{
+			core.DirectoryQuery{Search: "a*)"},
+			"(&(objectClass=backspaceMember)" +
+				`(|(uid=*a\2a\29*)(email=*a\2a\29*)(alternateEmail=*a\2a\29*)(mlAddress=*a\2a\29*)))`,
+		},
+	}
+	for _, o := range filterOpts {
+		if filter := directoryFilter(o.q); filter != o.want {
+			t.Fatalf("invalid filter for %+v:\n  %s\nvs\n  %s", o.q, filter, o.want)
+		}
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	dir := fakeldap.New()
+	seed := func(dn, uid string, attrs map[string][]string) {
+		attrs["objectClass"] = []string{"backspaceMember"}
+		attrs["uid"] = []string{uid}
+		dir.Seed(dn, attrs)
+	}
+	seed("uid=alice,ou=member,dc=backspace", "alice", map[string][]string{
+		"membershipState": {"active"},
+		"serviceEnabled":  {"wiki"},
+	})
+	seed("uid=bob,ou=member,dc=backspace", "bob", map[string][]string{
+		"membershipState": {"trial"},
+	})
+	// predates membershipState
+	seed("uid=carol,ou=member,dc=backspace", "carol", map[string][]string{})
+	seed("uid=dave,ou=inactiveMember,dc=backspace", "dave", map[string][]string{})
+	seed("uid=erin,ou=member,dc=backspace", "erin", map[string][]string{
+		"membershipState": {"active"},
+		"serviceEnabled":  {"wiki"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	directoryOpts := []struct {
+		testName string
+		q        core.DirectoryQuery
+		want     []string
+		more     bool
+	}{{
+		"all",
+		core.DirectoryQuery{},
+		[]string{"alice", "bob", "carol", "dave", "erin"}, false,
+	}, {
+		"first page",
+		core.DirectoryQuery{PageSize: 2},
+		[]string{"alice", "bob"}, true,
+	}, {
+		"last page",
+		core.DirectoryQuery{Page: 2, PageSize: 2},
+		[]string{"erin"}, false,
+	}, {
+		"ou",
+		core.DirectoryQuery{OU: "inactiveMember"},
+		[]string{"dave"}, false,
+	}, {
+		"service",
+		core.DirectoryQuery{Service: "wiki"},
+		[]string{"alice", "erin"}, false,
+	}, {
+		"active with legacy entry",
+		core.DirectoryQuery{State: membership.Active},
+		[]string{"alice", "carol", "erin"}, false,
+	}, {
+		"active paged",
+		core.DirectoryQuery{State: membership.Active, Page: 0, PageSize: 2},
+		[]string{"alice", "carol"}, true,
+	}, {
+		"left legacy entry",
+		core.DirectoryQuery{State: membership.Left},
+		[]string{"dave"}, false,
+	}, {
+		"search",
+		core.DirectoryQuery{Search: "ob"},
+		[]string{"bob"}, false,
+	}}
+	for _, o := range directoryOpts {
+		entries, more, err := l.Directory(o.q)
+		if err != nil {
+			t.Fatalf("unable to list %s: %s", o.testName, err)
+		}
+		var nicknames []string
+		for _, e := range entries {
+			nicknames = append(nicknames, e.Nickname)
+		}
+		slices.Sort(nicknames)
+		if !slices.Equal(nicknames, o.want) || more != o.more {
+			t.Fatalf("invalid result for %s: %v %t", o.testName, nicknames, more)
+		}
+	}
+
+	_, _, err := l.Directory(core.DirectoryQuery{OU: "groups"})
+	if err == nil {
+		t.Fatalf("missing error for invalid ou")
+	}
+}
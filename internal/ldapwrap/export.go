@@ -0,0 +1,57 @@
+package ldapwrap
+
+import (
+	"strings"
+)
+
+// secretAttributes are never handed out, not even to the member they belong
+// to
+var secretAttributes = map[string]bool{
+	"userpassword":     true,
+	"doorpassword":     true,
+	"token":            true,
+	"emailtoken":       true,
+	"totpsecret":       true,
+	"totprecoverycode": true,
+}
+
+// MemberData returns all attributes stored about a member without password
+// hashes and tokens. Badges are listed without their hash, passkeys without
+// their key.
+func (l *LdapWrap) MemberData(uid string) (data map[string][]string, err error) {
+	member, err := l.findMember(uid, []string{"*"})
+	if err != nil {
+		return nil, err
+	}
+	data = map[string][]string{}
+	for _, attr := range member.Attributes {
+		name := strings.ToLower(attr.Name)
+		switch {
+		case secretAttributes[name]:
+			continue
+		case name == "doorbadge":
+			for _, value := range attr.Values {
+				badge, err := parseBadge(value)
+				if err != nil {
+					continue
+				}
+				data[attr.Name] = append(data[attr.Name], strings.TrimSpace(
+					badge.ID+" "+badge.Created.Format("2006-01-02 15:04:05")+" "+badge.Label,
+				))
+			}
+		case name == "webauthncredential":
+			for _, value := range attr.Values {
+				passkey, err := parsePasskey(value)
+				if err != nil {
+					continue
+				}
+				data[attr.Name] = append(data[attr.Name], strings.TrimSpace(
+					passkey.Created.Format("2006-01-02 15:04:05")+" "+passkey.Label,
+				))
+			}
+		default:
+			data[attr.Name] = attr.Values
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,311 @@
+package ldapwrap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Groups live in ou=groups, either as groupOfNames listing the member dn or
+// as posixGroup listing the uid
+
+const groupsOU = "ou=groups,dc=backspace"
+
+var ErrGroupExists = errors.New("group exists")
+
+// MemberGroups returns the cn of every group the member belongs to
+func (l *LdapWrap) MemberGroups(uid string) (groups []string, err error) {
+	member, err := l.findMember(uid, []string{"uid"})
+	if err != nil {
+		return nil, err
+	}
+	filter := fmt.Sprintf(
+		"(|(&(objectClass=groupOfNames)(member=%s))(&(objectClass=posixGroup)(memberUid=%s)))",
+		EscapeFilter(member.DN), EscapeFilter(member.GetAttributeValue("uid")),
+	)
+	sr, err := l.SearchGroups(filter, []string{"cn"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search groups: %s", err)
+	}
+	for _, group := range sr.Entries {
+		groups = append(groups, group.GetAttributeValue("cn"))
+	}
+	return groups, nil
+}
+
+func (l *LdapWrap) SearchGroups(filter string, attrs []string) (sr *ldap.SearchResult, err error) {
+	r := ldap.NewSearchRequest(
+		groupsOU,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		attrs,
+		[]ldap.Control{},
+	)
+	return l.conn.Search(r)
+}
+
+// Supplementary posixGroups list their members in memberUid. Members allowed
+// to manage a group are kept as dn in owner.
+
+func (l *LdapWrap) Groups() (groups []core.Group, err error) {
+	sr, err := l.SearchGroups("(objectClass=posixGroup)", groupAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search groups: %s", err)
+	}
+	for _, entry := range sr.Entries {
+		groups = append(groups, groupFromEntry(entry))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (l *LdapWrap) Group(cn string) (group core.Group, err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return group, err
+	}
+	return groupFromEntry(entry), nil
+}
+
+func (l *LdapWrap) CreateGroup(cn, description string) (group core.Group, err error) {
+	sr, err := l.SearchGroups(fmt.Sprintf("(cn=%s)", EscapeFilter(cn)), []string{})
+	if err != nil {
+		return group, fmt.Errorf("unable to search groups: %s", err)
+	}
+	if len(sr.Entries) > 0 {
+		return group, ErrGroupExists
+	}
+	gidNumber, err := l.nextGidNumber()
+	if err != nil {
+		return group, err
+	}
+	req := ldap.NewAddRequest(groupDN(cn), []ldap.Control{})
+	req.Attribute("objectClass", []string{"posixGroup"})
+	req.Attribute("cn", []string{cn})
+	req.Attribute("gidNumber", []string{strconv.Itoa(gidNumber)})
+	if description != "" {
+		req.Attribute("description", []string{description})
+	}
+	err = l.conn.Add(req)
+	if err != nil {
+		return group, fmt.Errorf("unable to add group: %s", err)
+	}
+	return core.Group{Name: cn, GidNumber: gidNumber, Description: description}, nil
+}
+
+func (l *LdapWrap) DeleteGroup(cn string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	err = l.conn.Del(ldap.NewDelRequest(entry.DN, []ldap.Control{}))
+	if err != nil {
+		return fmt.Errorf("unable to delete group: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) RenameGroup(cn, newCN string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	sr, err := l.SearchGroups(fmt.Sprintf("(cn=%s)", EscapeFilter(newCN)), []string{})
+	if err != nil {
+		return fmt.Errorf("unable to search groups: %s", err)
+	}
+	if len(sr.Entries) > 0 {
+		return ErrGroupExists
+	}
+	rdn := fmt.Sprintf("cn=%s", ldap.EscapeDN(newCN))
+	err = l.conn.ModifyDN(ldap.NewModifyDNRequest(entry.DN, rdn, true, ""))
+	if err != nil {
+		return fmt.Errorf("unable to rename group: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) AddGroupMember(cn, uid string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	member, err := l.findMember(uid, []string{"uid"})
+	if err != nil {
+		return err
+	}
+	uid = member.GetAttributeValue("uid")
+	if slices.Contains(entry.GetAttributeValues("memberUid"), uid) {
+		return nil
+	}
+	req := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	req.Add("memberUid", []string{uid})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to add group member: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) RemoveGroupMember(cn, uid string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(entry.GetAttributeValues("memberUid"), uid) {
+		return nil
+	}
+	req := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	req.Delete("memberUid", []string{uid})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to remove group member: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) AddGroupOwner(cn, uid string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	if slices.Contains(groupFromEntry(entry).Owners, uid) {
+		return nil
+	}
+	req := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+	req.Add("owner", []string{member.DN})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to add group owner: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) RemoveGroupOwner(cn, uid string) (err error) {
+	entry, err := l.findGroup(cn)
+	if err != nil {
+		return err
+	}
+	for _, owner := range entry.GetAttributeValues("owner") {
+		if uidFromDN(owner) != uid {
+			continue
+		}
+		req := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+		req.Delete("owner", []string{owner})
+		err = l.conn.Modify(req)
+		if err != nil {
+			return fmt.Errorf("unable to remove group owner: %s", err)
+		}
+	}
+	return nil
+}
+
+// LeaveGroups removes the member from every group, as member as well as
+// owner, and returns the cn of the groups changed
+func (l *LdapWrap) LeaveGroups(uid string) (groups []string, err error) {
+	member, err := l.findMember(uid, []string{"uid"})
+	if err != nil {
+		return nil, err
+	}
+	uid = member.GetAttributeValue("uid")
+	filter := fmt.Sprintf("(|(member=%s)(memberUid=%s)(owner=%s))",
+		EscapeFilter(member.DN), EscapeFilter(uid), EscapeFilter(member.DN))
+	sr, err := l.SearchGroups(filter, []string{"cn", "member", "memberUid", "owner"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search groups: %s", err)
+	}
+	for _, entry := range sr.Entries {
+		req := ldap.NewModifyRequest(entry.DN, []ldap.Control{})
+		for _, attr := range []string{"member", "owner"} {
+			for _, dn := range entry.GetAttributeValues(attr) {
+				if strings.EqualFold(dn, member.DN) {
+					req.Delete(attr, []string{dn})
+				}
+			}
+		}
+		if slices.Contains(entry.GetAttributeValues("memberUid"), uid) {
+			req.Delete("memberUid", []string{uid})
+		}
+		if len(req.Changes) == 0 {
+			continue
+		}
+		err = l.conn.Modify(req)
+		if err != nil {
+			return groups, fmt.Errorf("unable to leave group: %s", err)
+		}
+		groups = append(groups, entry.GetAttributeValue("cn"))
+	}
+	return groups, nil
+}
+
+var groupAttributes = []string{"cn", "gidNumber", "description", "memberUid", "owner"}
+
+func (l *LdapWrap) findGroup(cn string) (entry *ldap.Entry, err error) {
+	filter := fmt.Sprintf("(&(objectClass=posixGroup)(cn=%s))", EscapeFilter(cn))
+	sr, err := l.SearchGroups(filter, groupAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search groups: %s", err)
+	}
+	if len(sr.Entries) != 1 {
+		return nil, fmt.Errorf("unable to find group: %s", cn)
+	}
+	return sr.Entries[0], nil
+}
+
+// nextGidNumber keeps supplementary groups above the gidNumber 1212 shared
+// by all members
+func (l *LdapWrap) nextGidNumber() (gidNumber int, err error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	sr, err := l.SearchGroups("(objectClass=posixGroup)", []string{"gidNumber"})
+	if err != nil {
+		return 0, fmt.Errorf("unable to query for new gid: %s", err)
+	}
+	gidNumber = 2000
+	for _, group := range sr.Entries {
+		n, err := strconv.Atoi(group.GetAttributeValue("gidNumber"))
+		if err == nil && n >= gidNumber {
+			gidNumber = n + 1
+		}
+	}
+	return gidNumber, nil
+}
+
+func groupDN(cn string) string {
+	return fmt.Sprintf("cn=%s,%s", ldap.EscapeDN(cn), groupsOU)
+}
+
+func groupFromEntry(entry *ldap.Entry) core.Group {
+	group := core.Group{
+		Name:        entry.GetAttributeValue("cn"),
+		Description: entry.GetAttributeValue("description"),
+		Members:     entry.GetAttributeValues("memberUid"),
+		Owners:      []string{},
+	}
+	group.GidNumber, _ = strconv.Atoi(entry.GetAttributeValue("gidNumber"))
+	for _, owner := range entry.GetAttributeValues("owner") {
+		group.Owners = append(group.Owners, uidFromDN(owner))
+	}
+	return group
+}
+
+func uidFromDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
@@ -0,0 +1,159 @@
+package ldapwrap
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/b4ckspace/members/internal/fakeldap"
+)
+
+func TestMemberGroups(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=member,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=door-admin,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"door-admin"},
+		"memberUid":   {"member"},
+	})
+	dir.Seed("cn=treasurer,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"treasurer"},
+		"memberUid":   {"other"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	groups, err := l.MemberGroups("member")
+	if err != nil {
+		t.Fatalf("unable to load groups: %s", err)
+	}
+	sort.Strings(groups)
+	if len(groups) != 2 || groups[0] != "board" || groups[1] != "door-admin" {
+		t.Fatalf("invalid groups: %v", groups)
+	}
+	_, err = l.MemberGroups("unknown")
+	if err == nil {
+		t.Fatalf("missing error for unknown member")
+	}
+}
+
+func TestGroupManagement(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	dir.Seed("cn=server,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"server"},
+		"gidNumber":   {"2003"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	group, err := l.CreateGroup("laser", "Lasercutter Wiki")
+	if err != nil || group.GidNumber != 2004 {
+		t.Fatalf("unable to create group: %+v %s", group, err)
+	}
+	_, err = l.CreateGroup("laser", "")
+	if err != ErrGroupExists {
+		t.Fatalf("duplicate group created: %s", err)
+	}
+	err = l.AddGroupMember("laser", "member")
+	if err != nil {
+		t.Fatalf("unable to add member: %s", err)
+	}
+	err = l.AddGroupMember("laser", "unknown")
+	if err == nil {
+		t.Fatalf("unknown member added")
+	}
+	err = l.AddGroupOwner("laser", "member")
+	if err != nil {
+		t.Fatalf("unable to add owner: %s", err)
+	}
+	err = l.RenameGroup("laser", "lasercutter")
+	if err != nil {
+		t.Fatalf("unable to rename group: %s", err)
+	}
+	group, err = l.Group("lasercutter")
+	if err != nil || len(group.Members) != 1 || len(group.Owners) != 1 || group.Owners[0] != "member" {
+		t.Fatalf("invalid group after rename: %+v %s", group, err)
+	}
+	groups, _ := l.MemberGroups("member")
+	if len(groups) != 1 || groups[0] != "lasercutter" {
+		t.Fatalf("posix group not resolved: %v", groups)
+	}
+
+	err = l.RemoveGroupOwner("lasercutter", "member")
+	if err != nil {
+		t.Fatalf("unable to remove owner: %s", err)
+	}
+	err = l.RemoveGroupMember("lasercutter", "member")
+	if err != nil {
+		t.Fatalf("unable to remove member: %s", err)
+	}
+	group, _ = l.Group("lasercutter")
+	if len(group.Members) != 0 || len(group.Owners) != 0 {
+		t.Fatalf("member or owner not removed: %+v", group)
+	}
+	err = l.DeleteGroup("lasercutter")
+	if err != nil {
+		t.Fatalf("unable to delete group: %s", err)
+	}
+	groups2, _ := l.Groups()
+	if len(groups2) != 1 {
+		t.Fatalf("group not deleted: %+v", groups2)
+	}
+}
+
+func TestLeaveGroups(t *testing.T) {
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=member,ou=member,dc=backspace", "uid=other,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=laser,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"laser"},
+		"memberUid":   {"member"},
+		"owner":       {"uid=member,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=server,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"server"},
+		"memberUid":   {"other"},
+	})
+	l := &LdapWrap{conn: dir}
+
+	groups, err := l.LeaveGroups("member")
+	if err != nil {
+		t.Fatalf("unable to leave groups: %s", err)
+	}
+	sort.Strings(groups)
+	if len(groups) != 2 || groups[0] != "board" || groups[1] != "laser" {
+		t.Fatalf("invalid groups left: %v", groups)
+	}
+	remaining, _ := l.MemberGroups("member")
+	if len(remaining) != 0 {
+		t.Fatalf("still member of %v", remaining)
+	}
+	laser, _ := l.Group("laser")
+	if len(laser.Owners) != 0 {
+		t.Fatalf("still owner of laser: %v", laser.Owners)
+	}
+	board, _ := dir.Entry("cn=board,ou=groups,dc=backspace")
+	if members := board.GetAttributeValues("member"); len(members) != 1 {
+		t.Fatalf("other members removed: %v", members)
+	}
+}
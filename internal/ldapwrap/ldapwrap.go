@@ -11,6 +11,7 @@ import (
 	"github.com/go-ldap/ldap/v3"
 
 	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/membership"
 	"github.com/b4ckspace/members/internal/ssha"
 )
 
@@ -28,6 +29,21 @@ type (
 		Nickname   string
 		Random     []byte
 	}
+
+	EmailTokenKind string
+	EmailToken     struct {
+		Kind       EmailTokenKind
+		ValidUntil time.Time
+		Nickname   string
+		OldEmail   string
+		NewEmail   string
+		Random     []byte
+	}
+)
+
+const (
+	EmailConfirm EmailTokenKind = "confirm"
+	EmailRevert  EmailTokenKind = "revert"
 )
 
 func EscapeFilter(f string) string {
@@ -56,10 +72,12 @@ func (ld *LdapDialer) Dial(ctx context.Context) (core.LdapWrap, error) {
 	}, nil
 }
 
+// NextUidNumber includes archived members, so a uid number isn't handed out
+// again while the archived entry still exists
 func (l *LdapWrap) NextUidNumber() (nextUidNumber int, err error) {
 	l.m.Lock()
 	defer l.m.Unlock()
-	res, err := l.SearchActiveAndInactive("(objectClass=backspaceMember)", []string{"uidNumber"})
+	res, err := l.searchAll("(objectClass=backspaceMember)", []string{"uidNumber"})
 	if err != nil {
 		return 0, fmt.Errorf("unable to query for new uid: %s", err)
 	}
@@ -82,37 +100,46 @@ func (l *LdapWrap) NextUidNumber() (nextUidNumber int, err error) {
 	return
 }
 
-func (l *LdapWrap) PasswordReset(nickname string) (token, email string, err error) {
-	nickname = ldap.EscapeFilter(nickname)
-	search := fmt.Sprintf("(&(objectClass=backspaceMember)(uid=%s))", nickname)
-	sr, err := l.SearchActive(search, []string{"alternateEmail"})
+// PasswordReset sets a new token for every active member whose nickname or
+// email address matches. Several members may share one email address, an
+// unknown nickname or address results in no tokens.
+func (l *LdapWrap) PasswordReset(nicknameOrEmail string) (resets []core.PasswordResetToken, err error) {
+	v := ldap.EscapeFilter(nicknameOrEmail)
+	search := fmt.Sprintf(
+		"(&(objectClass=backspaceMember)(|(uid=%s)(alternateEmail=%s)(email=%s)))",
+		v, v, v,
+	)
+	sr, err := l.SearchActive(search, []string{"uid", "alternateEmail"})
 	if err != nil {
-		return "", "", fmt.Errorf("unable to find member: %s", err)
-	}
-	if len(sr.Entries) != 1 {
-		return "", "", fmt.Errorf("unable to find user with nickname: %s", nickname)
+		return nil, fmt.Errorf("unable to find member: %s", err)
 	}
 
-	member := sr.Entries[0]
-	ldapNickname := member.GetAttributeValue("uid")
-	email = member.GetAttributeValue("alternateEmail")
+	for _, member := range sr.Entries {
+		ldapNickname := member.GetAttributeValue("uid")
+		email := member.GetAttributeValue("alternateEmail")
 
-	token, err = GenerateToken(ldapNickname)
-	if err != nil {
-		return "", "", fmt.Errorf("unable to generate token: %s", err)
-	}
+		token, err := GenerateToken(ldapNickname)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate token: %s", err)
+		}
 
-	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
-	req.Replace("token", []string{token})
+		req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+		req.Replace("token", []string{token})
 
-	err = l.conn.Modify(req)
-	if err != nil {
-		return "", "", fmt.Errorf("unable to set token: %s", err)
+		err = l.conn.Modify(req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set token: %s", err)
+		}
+		resets = append(resets, core.PasswordResetToken{
+			Nickname: ldapNickname,
+			Email:    email,
+			Token:    token,
+		})
 	}
-	return token, email, nil
+	return resets, nil
 }
 
-func (l *LdapWrap) RegisterMember(user, email, mlEmail string) (token string, err error) {
+func (l *LdapWrap) RegisterMember(user, email, mlEmail string, services []string) (token string, err error) {
 	exists, err := l.MemberExists(user)
 	if err != nil {
 		return "", fmt.Errorf("unable to check if user exists: %s", err)
@@ -139,7 +166,10 @@ func (l *LdapWrap) RegisterMember(user, email, mlEmail string) (token string, er
 	req.Attribute("email", []string{intEmail})
 	req.Attribute("alternateEmail", []string{email})
 	req.Attribute("mlAddress", []string{mlEmail})
-	req.Attribute("serviceEnabled", []string{"htaccess", "mail", "redmine"})
+	req.Attribute("membershipState", []string{string(membership.Applicant)})
+	if len(services) > 0 {
+		req.Attribute("serviceEnabled", services)
+	}
 	req.Attribute("token", []string{token})
 	req.Attribute("userPassword", []string{"-"})
 	req.Attribute("doorPassword", []string{"-"})
@@ -191,9 +221,223 @@ func (l *LdapWrap) SetPassword(token, password, doorpass string) (err error) {
 	return nil
 }
 
+// Authenticate checks the password and returns the nickname as stored in
+// ldap, uid matches regardless of case. Inactive members can log in as well,
+// new members start there until the board activates them.
+func (l *LdapWrap) Authenticate(uid, password string) (nickname string, ok bool, err error) {
+	filter := fmt.Sprintf("(&(objectClass=backspaceMember)(uid=%s))", EscapeFilter(uid))
+	sr, err := l.SearchActiveAndInactive(filter, []string{"uid", "userPassword"})
+	if err != nil {
+		return "", false, fmt.Errorf("unable to search: %s", err)
+	}
+	if len(sr.Entries) != 1 {
+		return "", false, nil
+	}
+	hash := sr.Entries[0].GetAttributeValue("userPassword")
+	if hash == "" || hash == "-" {
+		return "", false, nil
+	}
+	ok, err = ssha.Verify(password, hash)
+	if !ok || err != nil {
+		return "", false, err
+	}
+	return sr.Entries[0].GetAttributeValue("uid"), true, nil
+}
+
+// LoginEnabled is false for members without a password, e.g. after
+// offboarding or before the registration was completed. nickname is the uid
+// as stored in ldap.
+func (l *LdapWrap) LoginEnabled(uid string) (nickname string, enabled bool, err error) {
+	member, err := l.findMember(uid, []string{"uid", "userPassword"})
+	if err != nil {
+		return "", false, err
+	}
+	hash := member.GetAttributeValue("userPassword")
+	return member.GetAttributeValue("uid"), hash != "" && hash != "-", nil
+}
+
+// RequestEmailChange stores a confirmation and a revert token for changing
+// the alternateEmail of a member. The address itself is not changed yet.
+func (l *LdapWrap) RequestEmailChange(
+	uid, newEmail string,
+) (
+	confirmToken, revertToken, oldEmail string, err error,
+) {
+	member, err := l.findMember(uid, []string{"uid", "alternateEmail", "emailToken"})
+	if err != nil {
+		return "", "", "", err
+	}
+	nickname := member.GetAttributeValue("uid")
+	oldEmail = member.GetAttributeValue("alternateEmail")
+
+	confirmToken, err = GenerateEmailToken(EmailConfirm, nickname, oldEmail, newEmail, 24*time.Hour)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to generate token: %s", err)
+	}
+	revertToken, err = GenerateEmailToken(EmailRevert, nickname, oldEmail, newEmail, 14*24*time.Hour)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to generate token: %s", err)
+	}
+
+	// revert links already sent to previous addresses keep working, only a
+	// superseded confirmation is dropped
+	tokens := RevertTokens(member.GetAttributeValues("emailToken"), time.Now())
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("emailToken", append(tokens, confirmToken, revertToken))
+	err = l.conn.Modify(req)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to set email token: %s", err)
+	}
+	return confirmToken, revertToken, oldEmail, nil
+}
+
+// ConfirmEmailChange sets the new alternateEmail of the change belonging to
+// token
+func (l *LdapWrap) ConfirmEmailChange(token string) (nickname, oldEmail, email string, err error) {
+	member, t, err := l.findEmailToken(token, EmailConfirm)
+	if err != nil {
+		return "", "", "", err
+	}
+	if member.GetAttributeValue("alternateEmail") != t.OldEmail {
+		return "", "", "", errors.New("email address changed in the meantime")
+	}
+
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("alternateEmail", []string{t.NewEmail})
+	req.Delete("emailToken", []string{token})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to set email: %s", err)
+	}
+	return t.Nickname, t.OldEmail, t.NewEmail, nil
+}
+
+// RevertEmailChange restores the previous alternateEmail. It cancels a
+// pending change as well as an already confirmed one and invalidates a
+// pending password reset. replacedEmail is the address in use until now.
+func (l *LdapWrap) RevertEmailChange(token string) (nickname, replacedEmail, email string, err error) {
+	member, t, err := l.findEmailToken(token, EmailRevert)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("alternateEmail", []string{t.OldEmail})
+	req.Replace("emailToken", []string{})
+	req.Replace("token", []string{"**invalidated**"})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return "", "", "", fmt.Errorf("unable to revert email: %s", err)
+	}
+	return t.Nickname, member.GetAttributeValue("alternateEmail"), t.OldEmail, nil
+}
+
+func (l *LdapWrap) findEmailToken(
+	token string, kind EmailTokenKind,
+) (
+	member *ldap.Entry, t EmailToken, err error,
+) {
+	t, err = ParseEmailToken(token)
+	if err != nil {
+		return nil, t, fmt.Errorf("invalid token: %s", err)
+	}
+	if t.Kind != kind {
+		return nil, t, fmt.Errorf("invalid token kind: %s", t.Kind)
+	}
+	if time.Now().After(t.ValidUntil) {
+		return nil, t, errors.New("token expired")
+	}
+
+	search := fmt.Sprintf("(&(objectClass=backspaceMember)(emailToken=%s))", EscapeFilter(token))
+	sr, err := l.SearchActiveAndInactive(search, []string{"uid", "alternateEmail"})
+	if err != nil {
+		return nil, t, fmt.Errorf("unable to search: %s", err)
+	}
+	if len(sr.Entries) != 1 {
+		return nil, t, errors.New("no user with that token found")
+	}
+	member = sr.Entries[0]
+	if member.GetAttributeValue("uid") != t.Nickname {
+		return nil, t, fmt.Errorf("invalid nickname in token: %s", t.Nickname)
+	}
+	return member, t, nil
+}
+
+func (l *LdapWrap) SetDoorPassword(uid, doorpass string) (err error) {
+	doorpassHash, err := ssha.Hash(doorpass, ssha.SSHA512)
+	if err != nil {
+		return fmt.Errorf("unable to hash door password: %s", err)
+	}
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("doorPassword", []string{doorpassHash})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to set door password: %s", err)
+	}
+	return nil
+}
+
+// InvalidateDoorPassword replaces the door password hash with a value no
+// password matches
+func (l *LdapWrap) InvalidateDoorPassword(uid string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("doorPassword", []string{"-"})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to invalidate door password: %s", err)
+	}
+	return nil
+}
+
+// DoorMembers lists the door password and badge hashes of all active members
+func (l *LdapWrap) DoorMembers() (members []core.DoorMember, err error) {
+	sr, err := l.SearchActive("(objectClass=backspaceMember)", []string{"uid", "doorPassword", "doorBadge"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to search: %s", err)
+	}
+	for _, member := range sr.Entries {
+		dm := core.DoorMember{
+			Nickname:     member.GetAttributeValue("uid"),
+			DoorPassword: member.GetAttributeValue("doorPassword"),
+			Badges:       []string{},
+		}
+		for _, value := range member.GetAttributeValues("doorBadge") {
+			badge, err := parseBadge(value)
+			if err != nil {
+				continue
+			}
+			dm.Badges = append(dm.Badges, badge.Hash)
+		}
+		members = append(members, dm)
+	}
+	return members, nil
+}
+
+func (l *LdapWrap) findMember(uid string, attrs []string) (member *ldap.Entry, err error) {
+	filter := fmt.Sprintf("(&(objectClass=backspaceMember)(uid=%s))", EscapeFilter(uid))
+	sr, err := l.SearchActiveAndInactive(filter, attrs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search: %s", err)
+	}
+	if len(sr.Entries) != 1 {
+		return nil, fmt.Errorf("unable to find user with nickname: %s", uid)
+	}
+	return sr.Entries[0], nil
+}
+
+// MemberExists also looks at archived members, their nickname stays taken
+// until the entry is deleted
 func (l *LdapWrap) MemberExists(uid string) (exists bool, err error) {
 	filter := fmt.Sprintf("(&(objectClass=backspaceMember)(uid=%s))", EscapeFilter(uid))
-	res, err := l.SearchActiveAndInactive(filter, []string{})
+	res, err := l.searchAll(filter, []string{})
 	if err != nil {
 		return false, fmt.Errorf("unable to search: %s", err)
 	}
@@ -244,3 +488,17 @@ func (l *LdapWrap) SearchActiveAndInactive(filter string, attrs []string) (sr *l
 		Controls:  append(sr1.Controls, sr2.Controls...),
 	}, err
 }
+
+// searchAll searches active, inactive and archived members
+func (l *LdapWrap) searchAll(filter string, attrs []string) (sr *ldap.SearchResult, err error) {
+	sr, err = l.SearchActiveAndInactive(filter, attrs)
+	if err != nil {
+		return
+	}
+	archived, err := l.SearchArchived(filter, attrs)
+	if err != nil {
+		return
+	}
+	sr.Entries = append(sr.Entries, archived.Entries...)
+	return sr, nil
+}
@@ -0,0 +1,65 @@
+package ldapwrap
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/ssha"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestAuthenticate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockConn := mocks.NewMockLdapConn(mockCtrl)
+
+	hash, err := ssha.Hash("p4ssw0rd", ssha.SSHA)
+	if err != nil {
+		t.Fatalf("unable to hash: %s", err)
+	}
+	// a new member waiting for activation
+	member := ldap.NewEntry("uid=member,ou=inactiveMember,dc=backspace", map[string][]string{
+		"uid":          {"member"},
+		"userPassword": {hash},
+	})
+	mockConn.EXPECT().Search(gomock.Any()).DoAndReturn(
+		func(r *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			if r.BaseDN == "ou=inactiveMember,dc=backspace" {
+				return &ldap.SearchResult{Entries: []*ldap.Entry{member}}, nil
+			}
+			return &ldap.SearchResult{}, nil
+		},
+	).AnyTimes()
+	l := &LdapWrap{conn: mockConn}
+
+	authOpts := []struct {
+		uid      string
+		password string
+		nickname string
+		ok       bool
+	}{
+		{"member", "p4ssw0rd", "member", true},
+		{"MEMBER", "p4ssw0rd", "member", true},
+		{"member", "wrong", "", false},
+	}
+	for _, o := range authOpts {
+		nickname, ok, err := l.Authenticate(o.uid, o.password)
+		if err != nil {
+			t.Fatalf("unable to authenticate %s: %s", o.uid, err)
+		}
+		if nickname != o.nickname || ok != o.ok {
+			t.Fatalf("invalid result for %s/%s: %s %t", o.uid, o.password, nickname, ok)
+		}
+	}
+
+	member = ldap.NewEntry(member.DN, map[string][]string{
+		"uid":          {"member"},
+		"userPassword": {"-"},
+	})
+	_, ok, err := l.Authenticate("member", "-")
+	if ok || err != nil {
+		t.Fatalf("login without password: %t %s", ok, err)
+	}
+}
@@ -0,0 +1,34 @@
+package ldapwrap
+
+import (
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// mlAddress is the address subscribed to our mailing lists, either the
+// alternateEmail or the nickname@hackerspace-bamberg.de forward
+
+func (l *LdapWrap) MlAddress(uid string) (mlAddress, email string, err error) {
+	member, err := l.findMember(uid, []string{"mlAddress", "alternateEmail"})
+	if err != nil {
+		return "", "", err
+	}
+	return member.GetAttributeValue("mlAddress"),
+		member.GetAttributeValue("alternateEmail"),
+		nil
+}
+
+func (l *LdapWrap) SetMlAddress(uid, mlAddress string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("mlAddress", []string{mlAddress})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to set ml address: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package ldapwrap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/membership"
+)
+
+// The current state is kept in membershipState, every change is appended to
+// the multi valued membershipTransition attribute as
+// "<unix> <from> <to> <by> <reason>". Entries without a state predate the
+// lifecycle and get one derived from their ou.
+
+func (l *LdapWrap) Membership(uid string) (state membership.State, transitions []membership.Transition, err error) {
+	member, err := l.findMember(uid, []string{"membershipState", "membershipTransition"})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, value := range member.GetAttributeValues("membershipTransition") {
+		t, err := parseTransition(value)
+		if err != nil {
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+	return membershipState(member), transitions, nil
+}
+
+// ChangeMembership moves a member to t.To and applies its side effects:
+// members entering ou=member get the given default services, members leaving
+// it lose all services and members who left lose their door credentials.
+func (l *LdapWrap) ChangeMembership(uid string, t membership.Transition, services []string) (err error) {
+	member, err := l.findMember(uid, []string{
+		"uid", "membershipState", "serviceEnabled", "serviceRequested", "doorBadge",
+	})
+	if err != nil {
+		return err
+	}
+	t.From = membershipState(member)
+	if !t.From.CanTransition(t.To) {
+		return fmt.Errorf("invalid transition from %s to %s", t.From, t.To)
+	}
+	if t.Time.IsZero() {
+		t.Time = time.Now()
+	}
+
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("membershipState", []string{string(t.To)})
+	req.Add("membershipTransition", []string{formatTransition(t)})
+	switch {
+	case t.To.Member() && !t.From.Member():
+		missing := []string{}
+		for _, service := range services {
+			if !slices.Contains(member.GetAttributeValues("serviceEnabled"), service) {
+				missing = append(missing, service)
+			}
+		}
+		if len(missing) > 0 {
+			req.Add("serviceEnabled", missing)
+		}
+	case !t.To.Member():
+		if len(member.GetAttributeValues("serviceEnabled")) > 0 {
+			req.Replace("serviceEnabled", []string{})
+		}
+		if len(member.GetAttributeValues("serviceRequested")) > 0 {
+			req.Replace("serviceRequested", []string{})
+		}
+	}
+	if t.To == membership.Left {
+		req.Replace("doorPassword", []string{"-"})
+		if len(member.GetAttributeValues("doorBadge")) > 0 {
+			req.Replace("doorBadge", []string{})
+		}
+	}
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to change membership: %s", err)
+	}
+
+	ou := "ou=inactiveMember,dc=backspace"
+	if t.To.Member() {
+		ou = "ou=member,dc=backspace"
+	}
+	if strings.HasSuffix(strings.ToLower(member.DN), ","+strings.ToLower(ou)) {
+		return nil
+	}
+	rdn := fmt.Sprintf("uid=%s", ldap.EscapeDN(member.GetAttributeValue("uid")))
+	err = l.conn.ModifyDN(ldap.NewModifyDNRequest(member.DN, rdn, true, ou))
+	if err != nil {
+		return fmt.Errorf("unable to move member to %s: %s", ou, err)
+	}
+	return nil
+}
+
+func membershipState(member *ldap.Entry) membership.State {
+	state := membership.State(member.GetAttributeValue("membershipState"))
+	if state.Valid() {
+		return state
+	}
+	if strings.HasSuffix(strings.ToLower(member.DN), ",ou=member,dc=backspace") {
+		return membership.Active
+	}
+	return membership.Left
+}
+
+func formatTransition(t membership.Transition) string {
+	return fmt.Sprintf("%d %s %s %s %s", t.Time.Unix(), t.From, t.To, t.By, t.Reason)
+}
+
+func parseTransition(value string) (t membership.Transition, err error) {
+	parts := strings.SplitN(value, " ", 5)
+	if len(parts) < 4 {
+		return t, errors.New("invalid transition")
+	}
+	created, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("invalid transition time: %s", err)
+	}
+	t = membership.Transition{
+		Time: time.Unix(created, 0),
+		From: membership.State(parts[1]),
+		To:   membership.State(parts[2]),
+		By:   parts[3],
+	}
+	if len(parts) == 5 {
+		t.Reason = parts[4]
+	}
+	return t, nil
+}
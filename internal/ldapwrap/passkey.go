@@ -0,0 +1,145 @@
+package ldapwrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Passkeys are stored in the multi valued webauthnCredential attribute as
+// "<created unix> <base64 json credential> <label>"
+
+func (l *LdapWrap) Passkeys(uid string) (passkeys []core.Passkey, err error) {
+	member, err := l.findMember(uid, []string{"webauthnCredential"})
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range member.GetAttributeValues("webauthnCredential") {
+		passkey, err := parsePasskey(value)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, nil
+}
+
+func (l *LdapWrap) AddPasskey(uid, label string, credential webauthn.Credential) (passkey core.Passkey, err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return passkey, err
+	}
+	passkey = core.Passkey{
+		ID:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Label:      label,
+		Created:    time.Now().Truncate(time.Second),
+		Credential: credential,
+	}
+	value, err := formatPasskey(passkey)
+	if err != nil {
+		return passkey, err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Add("webauthnCredential", []string{value})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return passkey, fmt.Errorf("unable to add passkey: %s", err)
+	}
+	return passkey, nil
+}
+
+// UpdatePasskey stores the sign counter and flags of a credential after a
+// login
+func (l *LdapWrap) UpdatePasskey(uid string, credential webauthn.Credential) (err error) {
+	member, err := l.findMember(uid, []string{"webauthnCredential"})
+	if err != nil {
+		return err
+	}
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for _, value := range member.GetAttributeValues("webauthnCredential") {
+		passkey, err := parsePasskey(value)
+		if err != nil || passkey.ID != id {
+			continue
+		}
+		passkey.Credential = credential
+		updated, err := formatPasskey(passkey)
+		if err != nil {
+			return err
+		}
+		req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+		req.Delete("webauthnCredential", []string{value})
+		req.Add("webauthnCredential", []string{updated})
+		err = l.conn.Modify(req)
+		if err != nil {
+			return fmt.Errorf("unable to update passkey: %s", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to find passkey %s", id)
+}
+
+func (l *LdapWrap) RevokePasskey(uid, passkeyID string) (err error) {
+	member, err := l.findMember(uid, []string{"webauthnCredential"})
+	if err != nil {
+		return err
+	}
+	for _, value := range member.GetAttributeValues("webauthnCredential") {
+		passkey, err := parsePasskey(value)
+		if err != nil || passkey.ID != passkeyID {
+			continue
+		}
+		req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+		req.Delete("webauthnCredential", []string{value})
+		err = l.conn.Modify(req)
+		if err != nil {
+			return fmt.Errorf("unable to revoke passkey: %s", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to find passkey %s", passkeyID)
+}
+
+func formatPasskey(passkey core.Passkey) (value string, err error) {
+	credential, err := json.Marshal(passkey.Credential)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode passkey: %s", err)
+	}
+	return fmt.Sprintf("%d %s %s",
+		passkey.Created.Unix(),
+		base64.StdEncoding.EncodeToString(credential),
+		passkey.Label,
+	), nil
+}
+
+func parsePasskey(value string) (passkey core.Passkey, err error) {
+	parts := strings.SplitN(value, " ", 3)
+	if len(parts) < 2 {
+		return passkey, fmt.Errorf("invalid passkey: %s", value)
+	}
+	created, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return passkey, fmt.Errorf("invalid passkey creation time: %s", err)
+	}
+	credential, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return passkey, fmt.Errorf("invalid passkey credential: %s", err)
+	}
+	err = json.Unmarshal(credential, &passkey.Credential)
+	if err != nil {
+		return passkey, fmt.Errorf("invalid passkey credential: %s", err)
+	}
+	passkey.ID = base64.RawURLEncoding.EncodeToString(passkey.Credential.ID)
+	passkey.Created = time.Unix(created, 0)
+	if len(parts) == 3 {
+		passkey.Label = parts[2]
+	}
+	return passkey, nil
+}
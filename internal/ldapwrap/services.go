@@ -0,0 +1,122 @@
+package ldapwrap
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Services which need approval are kept in serviceRequested until an admin
+// moves them to serviceEnabled
+
+func (l *LdapWrap) Services(uid string) (enabled, requested []string, err error) {
+	member, err := l.findMember(uid, []string{"serviceEnabled", "serviceRequested"})
+	if err != nil {
+		return nil, nil, err
+	}
+	return member.GetAttributeValues("serviceEnabled"),
+		member.GetAttributeValues("serviceRequested"),
+		nil
+}
+
+func (l *LdapWrap) EnableService(uid, service string) (err error) {
+	member, err := l.findMember(uid, []string{"serviceEnabled", "serviceRequested"})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	if !slices.Contains(member.GetAttributeValues("serviceEnabled"), service) {
+		req.Add("serviceEnabled", []string{service})
+	}
+	if slices.Contains(member.GetAttributeValues("serviceRequested"), service) {
+		req.Delete("serviceRequested", []string{service})
+	}
+	if len(req.Changes) == 0 {
+		return nil
+	}
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to enable service: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) DisableService(uid, service string) (err error) {
+	member, err := l.findMember(uid, []string{"serviceEnabled", "serviceRequested"})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	if slices.Contains(member.GetAttributeValues("serviceEnabled"), service) {
+		req.Delete("serviceEnabled", []string{service})
+	}
+	if slices.Contains(member.GetAttributeValues("serviceRequested"), service) {
+		req.Delete("serviceRequested", []string{service})
+	}
+	if len(req.Changes) == 0 {
+		return nil
+	}
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to disable service: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) RequestService(uid, service string) (err error) {
+	member, err := l.findMember(uid, []string{"serviceEnabled", "serviceRequested"})
+	if err != nil {
+		return err
+	}
+	if slices.Contains(member.GetAttributeValues("serviceEnabled"), service) ||
+		slices.Contains(member.GetAttributeValues("serviceRequested"), service) {
+		return nil
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Add("serviceRequested", []string{service})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to request service: %s", err)
+	}
+	return nil
+}
+
+// DeclineService drops a pending request, an already enabled service is kept
+func (l *LdapWrap) DeclineService(uid, service string) (err error) {
+	member, err := l.findMember(uid, []string{"serviceRequested"})
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(member.GetAttributeValues("serviceRequested"), service) {
+		return nil
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Delete("serviceRequested", []string{service})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to decline service: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) ServiceRequests() (requests []core.ServiceRequest, err error) {
+	sr, err := l.SearchActiveAndInactive(
+		"(&(objectClass=backspaceMember)(serviceRequested=*))",
+		[]string{"uid", "serviceRequested"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search: %s", err)
+	}
+	for _, member := range sr.Entries {
+		for _, service := range member.GetAttributeValues("serviceRequested") {
+			requests = append(requests, core.ServiceRequest{
+				Nickname: member.GetAttributeValue("uid"),
+				Service:  service,
+			})
+		}
+	}
+	return requests, nil
+}
@@ -0,0 +1,56 @@
+package ldapwrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SSH keys are stored in sshPublicKey of the ldapPublicKey object class, as
+// read by AuthorizedKeysCommand on our servers
+
+func (l *LdapWrap) SSHKeys(uid string) (keys []string, err error) {
+	member, err := l.findMember(uid, []string{"sshPublicKey"})
+	if err != nil {
+		return nil, err
+	}
+	return member.GetAttributeValues("sshPublicKey"), nil
+}
+
+func (l *LdapWrap) AddSSHKey(uid, key string) (err error) {
+	member, err := l.findMember(uid, []string{"objectClass"})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	hasObjectClass := false
+	for _, objectClass := range member.GetAttributeValues("objectClass") {
+		if strings.EqualFold(objectClass, "ldapPublicKey") {
+			hasObjectClass = true
+		}
+	}
+	if !hasObjectClass {
+		req.Add("objectClass", []string{"ldapPublicKey"})
+	}
+	req.Add("sshPublicKey", []string{key})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to add ssh key: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) DeleteSSHKey(uid, key string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Delete("sshPublicKey", []string{key})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to delete ssh key: %s", err)
+	}
+	return nil
+}
@@ -11,16 +11,82 @@ import (
 )
 
 func GenerateToken(nickname string) (tokenString string, err error) {
-	random := bytes.NewBuffer(make([]byte, 0, 32))
-	_, err = io.CopyN(random, rand.Reader, 32)
+	random, err := randomBytes()
 	if err != nil {
-		return "", fmt.Errorf("unable to generate random token: %s", err)
+		return "", err
 	}
 	token := Token{
 		ValidUntil: time.Now().Add(24 * time.Hour),
 		Nickname:   nickname,
-		Random:     random.Bytes(),
+		Random:     random,
 	}
+	return encodeToken(token)
+}
+
+func ParseToken(tokenString string) (token Token, err error) {
+	err = decodeToken(tokenString, &token)
+	return token, err
+}
+
+func ValidateToken(tokenString string, nickname string) (ok bool, err error) {
+	token, err := ParseToken(tokenString)
+	if err != nil {
+		return false, err
+	}
+	if token.Nickname != nickname {
+		return false, fmt.Errorf("invalid nickname in token: %s", token.Nickname)
+	}
+	return true, nil
+}
+
+func GenerateEmailToken(
+	kind EmailTokenKind, nickname, oldEmail, newEmail string, validFor time.Duration,
+) (
+	tokenString string, err error,
+) {
+	random, err := randomBytes()
+	if err != nil {
+		return "", err
+	}
+	token := EmailToken{
+		Kind:       kind,
+		ValidUntil: time.Now().Add(validFor),
+		Nickname:   nickname,
+		OldEmail:   oldEmail,
+		NewEmail:   newEmail,
+		Random:     random,
+	}
+	return encodeToken(token)
+}
+
+func ParseEmailToken(tokenString string) (token EmailToken, err error) {
+	err = decodeToken(tokenString, &token)
+	return token, err
+}
+
+// RevertTokens returns the revert tokens which did not expire yet
+func RevertTokens(tokens []string, now time.Time) (revert []string) {
+	revert = []string{}
+	for _, tokenString := range tokens {
+		token, err := ParseEmailToken(tokenString)
+		if err != nil || token.Kind != EmailRevert || now.After(token.ValidUntil) {
+			continue
+		}
+		revert = append(revert, tokenString)
+	}
+	return revert
+}
+
+func randomBytes() (random []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 32))
+	_, err = io.CopyN(buf, rand.Reader, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate random token: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeToken(token interface{}) (tokenString string, err error) {
 	w := bytes.NewBuffer([]byte{})
 	err = gob.NewEncoder(w).Encode(token)
 	if err != nil {
@@ -29,19 +95,15 @@ func GenerateToken(nickname string) (tokenString string, err error) {
 	return base64.RawURLEncoding.EncodeToString(w.Bytes()), nil
 }
 
-func ValidateToken(tokenString string, nickname string) (ok bool, err error) {
+func decodeToken(tokenString string, token interface{}) (err error) {
 	tokenBytes, err := base64.RawURLEncoding.DecodeString(tokenString)
 	if err != nil {
-		return false, fmt.Errorf("unable to decode base64: %s\n%s", err, tokenString)
+		return fmt.Errorf("unable to decode base64: %s\n%s", err, tokenString)
 	}
-	token := Token{}
 	r := bytes.NewBuffer(tokenBytes)
-	err = gob.NewDecoder(r).Decode(&token)
+	err = gob.NewDecoder(r).Decode(token)
 	if err != nil {
-		return false, fmt.Errorf("unable to decode token: %s", err)
+		return fmt.Errorf("unable to decode token: %s", err)
 	}
-	if token.Nickname != nickname {
-		return false, fmt.Errorf("invalid nickname in token: %s", token.Nickname)
-	}
-	return true, nil
+	return nil
 }
@@ -0,0 +1,31 @@
+package ldapwrap
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRevertTokens(t *testing.T) {
+	confirm, err := GenerateEmailToken(EmailConfirm, "member", "old@example.com", "new@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("unable to generate token: %s", err)
+	}
+	revert, err := GenerateEmailToken(EmailRevert, "member", "old@example.com", "new@example.com", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("unable to generate token: %s", err)
+	}
+	expired, err := GenerateEmailToken(EmailRevert, "member", "old@example.com", "new@example.com", -time.Hour)
+	if err != nil {
+		t.Fatalf("unable to generate token: %s", err)
+	}
+
+	tokens := RevertTokens([]string{confirm, revert, expired, "invalid"}, time.Now())
+	if !slices.Equal(tokens, []string{revert}) {
+		t.Fatalf("invalid revert tokens: %v", tokens)
+	}
+	tokens = RevertTokens([]string{revert}, time.Now().Add(3*time.Hour))
+	if len(tokens) != 0 {
+		t.Fatalf("expired revert token kept: %v", tokens)
+	}
+}
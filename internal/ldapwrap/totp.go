@@ -0,0 +1,113 @@
+package ldapwrap
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/b4ckspace/members/internal/ssha"
+)
+
+// The totp secret is stored in totpSecret, recovery codes are hashed in the
+// multi valued totpRecoveryCode attribute and removed once used. totpCounter
+// holds the period of the last used one-time password.
+
+// TOTP returns the secret of a member, empty if not enrolled, and the number
+// of unused recovery codes
+func (l *LdapWrap) TOTP(uid string) (secret string, recoveryCodes int, err error) {
+	member, err := l.findMember(uid, []string{"totpSecret", "totpRecoveryCode"})
+	if err != nil {
+		return "", 0, err
+	}
+	return member.GetAttributeValue("totpSecret"),
+		len(member.GetAttributeValues("totpRecoveryCode")), nil
+}
+
+func (l *LdapWrap) EnableTOTP(uid, secret string, recoveryCodes []string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	hashes := []string{}
+	for _, code := range recoveryCodes {
+		hash, err := ssha.Hash(code, ssha.SSHA512)
+		if err != nil {
+			return fmt.Errorf("unable to hash recovery code: %s", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("totpSecret", []string{secret})
+	req.Replace("totpRecoveryCode", hashes)
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to enable totp: %s", err)
+	}
+	return nil
+}
+
+func (l *LdapWrap) DisableTOTP(uid string) (err error) {
+	member, err := l.findMember(uid, []string{})
+	if err != nil {
+		return err
+	}
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	req.Replace("totpSecret", []string{})
+	req.Replace("totpRecoveryCode", []string{})
+	req.Replace("totpCounter", []string{})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return fmt.Errorf("unable to disable totp: %s", err)
+	}
+	return nil
+}
+
+// UseTOTP records counter as the period of the last used one-time password.
+// ok is false if a code of the same or a later period was used before.
+func (l *LdapWrap) UseTOTP(uid string, counter int64) (ok bool, err error) {
+	member, err := l.findMember(uid, []string{"totpCounter"})
+	if err != nil {
+		return false, err
+	}
+	last := member.GetAttributeValue("totpCounter")
+	if n, err := strconv.ParseInt(last, 10, 64); err == nil && counter <= n {
+		return false, nil
+	}
+	// deleting the old value fails if a code was used concurrently
+	req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+	if last != "" {
+		req.Delete("totpCounter", []string{last})
+	}
+	req.Add("totpCounter", []string{strconv.FormatInt(counter, 10)})
+	err = l.conn.Modify(req)
+	if err != nil {
+		return false, fmt.Errorf("unable to use totp: %s", err)
+	}
+	return true, nil
+}
+
+// UseRecoveryCode removes code from the recovery codes of a member, ok is
+// false if the code does not exist or was used before
+func (l *LdapWrap) UseRecoveryCode(uid, code string) (ok bool, err error) {
+	member, err := l.findMember(uid, []string{"totpRecoveryCode"})
+	if err != nil {
+		return false, err
+	}
+	for _, hash := range member.GetAttributeValues("totpRecoveryCode") {
+		ok, _ := ssha.Verify(code, hash)
+		if !ok {
+			continue
+		}
+		// deleting the value fails if the code was used concurrently
+		req := ldap.NewModifyRequest(member.DN, []ldap.Control{})
+		req.Delete("totpRecoveryCode", []string{hash})
+		err = l.conn.Modify(req)
+		if err != nil {
+			return false, fmt.Errorf("unable to use recovery code: %s", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// textToHTML renders a text mail as HTML for the alternative part: blank
+// lines separate paragraphs and links become clickable
+func textToHTML(text string) string {
+	b := &strings.Builder{}
+	b.WriteString("<!DOCTYPE html>\n<html>\n<body style=\"font-family: sans-serif\">\n")
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		lines := strings.Split(strings.Trim(paragraph, "\n"), "\n")
+		for i, line := range lines {
+			lines[i] = linkPattern.ReplaceAllStringFunc(html.EscapeString(line), func(url string) string {
+				return `<a href="` + url + `">` + url + `</a>`
+			})
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
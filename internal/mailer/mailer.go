@@ -1,30 +1,96 @@
 package mailer
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/b4ckspace/members/internal/core"
 	"github.com/b4ckspace/members/internal/statics"
 )
 
+const (
+	sender        = "register@hackerspace-bamberg.de"
+	senderName    = "Hackerspace Bamberg"
+	DefaultLocale = "de"
+)
+
+// Preview is sample data filling every field used by the mail templates
+var Preview = core.MailData{
+	Nickname: "member",
+	EMail:    "member@example.com",
+	Token:    "t0k3n",
+	Notice: core.SecurityNotice{
+		Change:     "Türsystem Passwort wurde geändert",
+		Time:       time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC),
+		RemoteAddr: "192.0.2.1",
+		UserAgent:  "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	},
+}
+
+// locales lists the translations available for each mail template. Every
+// template needs the default locale, it is used for all others.
+var locales = map[string][]string{
+	core.MailRegistration:    {DefaultLocale, "en"},
+	core.MailNicknameTaken:   {DefaultLocale, "en"},
+	core.MailPasswordReset:   {DefaultLocale, "en"},
+	core.MailEmailConfirm:    {DefaultLocale, "en"},
+	core.MailEmailRevert:     {DefaultLocale, "en"},
+	core.MailDoorCompromised: {DefaultLocale},
+	core.MailDataExport:      {DefaultLocale, "en"},
+	core.MailSecurityNotice:  {DefaultLocale, "en"},
+}
+
 type (
 	Mailer struct {
 		connFactory ConnFactory
+		// templates by name and locale
+		templates map[string]map[string]*template.Template
+		now       func() time.Time
 	}
-	welcomeMail struct {
-		Nickname string
-		Token    string
+	// Message is a rendered mail template, the HTML part is generated from
+	// the text
+	Message struct {
+		Subject string
+		Text    string
+		HTML    string
 	}
 
 	ConnFactory func() (core.SmtpConn, error)
+
+	localeKey struct{}
 )
 
-func New(connFactory ConnFactory) (m *Mailer) {
-	return &Mailer{connFactory: connFactory}
+// New parses all mail templates, a broken template fails right away instead
+// of on the first mail using it
+func New(connFactory ConnFactory) (m *Mailer, err error) {
+	m = &Mailer{
+		connFactory: connFactory,
+		templates:   map[string]map[string]*template.Template{},
+		now:         time.Now,
+	}
+	fs := statics.MustStatics()
+	for name, ls := range locales {
+		m.templates[name] = map[string]*template.Template{}
+		for _, locale := range ls {
+			m.templates[name][locale], err = parseTemplate(fs, name, locale)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
 }
 
 func SmtpConnFactory(host string) ConnFactory {
@@ -34,7 +100,101 @@ func SmtpConnFactory(host string) ConnFactory {
 
 }
 
-func (m *Mailer) SendPassword(to, nickname, token string) (err error) {
+// WithLocale sets the locale mails sent with ctx are rendered in
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// Locale returns the locale set by WithLocale or the default locale
+func Locale(ctx context.Context) string {
+	locale, ok := ctx.Value(localeKey{}).(string)
+	if !ok || locale == "" {
+		return DefaultLocale
+	}
+	return locale
+}
+
+// Templates returns the names of all mail templates
+func (m *Mailer) Templates() (names []string) {
+	for name := range m.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Locales returns the locales the template is available in
+func (m *Mailer) Locales(name string) []string {
+	return locales[name]
+}
+
+// Render executes the named template, unknown locales fall back to the
+// default locale
+func (m *Mailer) Render(name, locale string, data interface{}) (msg Message, err error) {
+	ts, ok := m.templates[name]
+	if !ok {
+		return msg, fmt.Errorf("unknown mail template: %s", name)
+	}
+	t, ok := ts[locale]
+	if !ok {
+		t = ts[DefaultLocale]
+	}
+	subject := &strings.Builder{}
+	err = t.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return msg, fmt.Errorf("unable to render subject: %s", err)
+	}
+	text := &strings.Builder{}
+	err = t.Execute(text, data)
+	if err != nil {
+		return msg, fmt.Errorf("unable to render mail: %s", err)
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    textToHTML(text.String()),
+	}, nil
+}
+
+// MIME returns the message with headers as it is sent, text and HTML are
+// alternative parts
+func (msg Message) MIME(to string, date time.Time) []byte {
+	b := &bytes.Buffer{}
+	parts := multipart.NewWriter(b)
+	fmt.Fprintf(b, "From: %s <%s>\r\n", senderName, sender)
+	fmt.Fprintf(b, "To: %s\r\n", to)
+	fmt.Fprintf(b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(b, "Content-Type: multipart/alternative; boundary=%s\r\n", parts.Boundary())
+	b.WriteString("\r\n")
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		// writing to a bytes.Buffer does not fail
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		_, _ = w.Write([]byte(strings.ReplaceAll(part.body, "\n", "\r\n")))
+	}
+	_ = parts.Close()
+	return b.Bytes()
+}
+
+func (m *Mailer) Send(ctx context.Context, to, templateName string, data interface{}) (err error) {
+	msg, err := m.Render(templateName, Locale(ctx), data)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
 	c, err := m.connFactory()
 	if err != nil {
 		return fmt.Errorf("unable to open smtp connection: %s", err)
@@ -46,7 +206,7 @@ func (m *Mailer) SendPassword(to, nickname, token string) (err error) {
 	if err != nil {
 		return fmt.Errorf("unable to upgrade to tls: %s", err)
 	}
-	err = c.Mail("register@hackerspace-bamberg.de")
+	err = c.Mail(sender)
 	if err != nil {
 		return fmt.Errorf("unable to set sender: %s", err)
 	}
@@ -60,25 +220,32 @@ func (m *Mailer) SendPassword(to, nickname, token string) (err error) {
 	}
 	defer body.Close()
 
-	fp , err:= statics.MustStatics().Open("/templates/email.txt")
+	_, err = body.Write(msg.MIME(to, m.now()))
 	if err != nil {
-		return fmt.Errorf("unable to open mail template: %s", err)
+		return fmt.Errorf("unable to send mail: %s", err)
 	}
-	templateBody, err := io.ReadAll(fp)
+	return
+}
+
+// parseTemplate loads /templates/mail/<name>.<locale>.txt, the subject is
+// defined as a "subject" block within the template
+func parseTemplate(fs http.FileSystem, name, locale string) (t *template.Template, err error) {
+	file := fmt.Sprintf("/templates/mail/%s.%s.txt", name, locale)
+	fp, err := fs.Open(file)
 	if err != nil {
-		return fmt.Errorf("unable to load mail template: %s", err)
+		return nil, fmt.Errorf("unable to open mail template: %s", err)
 	}
-	t, err := template.New("email.txt").Parse(string(templateBody))
+	defer fp.Close()
+	body, err := io.ReadAll(fp)
 	if err != nil {
-		return fmt.Errorf("unable to parse mail template: %s", err)
+		return nil, fmt.Errorf("unable to load mail template: %s", err)
 	}
-
-	err = t.Execute(body, welcomeMail{
-		Nickname: nickname,
-		Token:    token,
-	})
+	t, err = template.New(name).Parse(string(body))
 	if err != nil {
-		return fmt.Errorf("unable to send mail: %s", err)
+		return nil, fmt.Errorf("unable to parse mail template %s: %s", file, err)
 	}
-	return
+	if t.Lookup("subject") == nil {
+		return nil, fmt.Errorf("mail template %s has no subject", file)
+	}
+	return t, nil
 }
@@ -2,9 +2,11 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -13,19 +15,28 @@ import (
 	"github.com/b4ckspace/members/mocks"
 )
 
-func TestSendPassword(t *testing.T) {
+func TestMain(m *testing.M) {
+	// mail templates are loaded relative to the repository root
 	_ = os.Chdir("../../")
+	os.Exit(m.Run())
+}
 
+func TestSend(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	c := mocks.NewMockSmtpConn(mockCtrl)
-	m := New(func() (core.SmtpConn, error) { return c, nil })
+	m, err := New(func() (core.SmtpConn, error) { return c, nil })
+	if err != nil {
+		t.Fatalf("unable to load templates: %s", err)
+	}
 
 	r, w := io.Pipe()
 	mailBody := bytes.NewBuffer([]byte{})
+	done := make(chan struct{})
 	go func() {
 		_, _ = io.Copy(mailBody, r)
+		close(done)
 	}()
 
 	c.EXPECT().StartTLS(&tls.Config{
@@ -36,14 +47,91 @@ func TestSendPassword(t *testing.T) {
 	c.EXPECT().Rcpt("member@example.com")
 	c.EXPECT().Close()
 
-	err := m.SendPassword("member@example.com", "member", "t0k3n")
+	err = m.Send(context.Background(), "member@example.com", core.MailPasswordReset, core.MailData{
+		Nickname: "member",
+		Token:    "t0k3n",
+	})
 	if err != nil {
 		t.Fatalf("unable to test mail: %s", err)
 	}
-	if !bytes.Contains(mailBody.Bytes(), []byte("member")) {
-		t.Fatalf("nickname not in mail body")
+	<-done
+	for _, want := range []string{
+		"To: member@example.com\r\n",
+		"Subject: =?utf-8?q?Hackerspace_Bamberg_-_Passwort_zur=C3=BCcksetzen?=\r\n",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"Content-Type: text/html; charset=utf-8\r\n",
+		`<a href="https://members.hackerspace-bamberg.de/password?t=t0k3n">`,
+		"Hallo member,\r\n",
+		"password?t=t0k3n",
+	} {
+		if !strings.Contains(mailBody.String(), want) {
+			t.Fatalf("%q not in mail: %s", want, mailBody.String())
+		}
+	}
+
+	err = m.Send(context.Background(), "member@example.com", "unknown", core.MailData{})
+	if err == nil {
+		t.Fatalf("unknown template sent")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatalf("unable to load templates: %s", err)
+	}
+	if len(m.Templates()) != len(locales) {
+		t.Fatalf("invalid templates: %v", m.Templates())
 	}
-	if !bytes.Contains(mailBody.Bytes(), []byte("t0k3n")) {
-		t.Fatalf("nickname not in mail body")
+	for _, name := range m.Templates() {
+		for _, locale := range m.Locales(name) {
+			msg, err := m.Render(name, locale, Preview)
+			if err != nil {
+				t.Fatalf("unable to render %s.%s: %s", name, locale, err)
+			}
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+				t.Fatalf("invalid subject for %s.%s: %q", name, locale, msg.Subject)
+			}
+			if !strings.Contains(msg.Text, "member") || strings.Contains(msg.Text, "<no value>") {
+				t.Fatalf("invalid text for %s.%s: %s", name, locale, msg.Text)
+			}
+			if !strings.Contains(msg.HTML, "member") || !strings.HasPrefix(msg.HTML, "<!DOCTYPE html>") {
+				t.Fatalf("invalid html for %s.%s: %s", name, locale, msg.HTML)
+			}
+			t.Logf("%s.%s\n%s", name, locale, msg.MIME("member@example.com", Preview.Notice.Time))
+		}
+	}
+}
+
+func TestLocales(t *testing.T) {
+	m, err := New(nil)
+	if err != nil {
+		t.Fatalf("unable to load templates: %s", err)
+	}
+	ctx := WithLocale(context.Background(), "en")
+	if Locale(ctx) != "en" || Locale(context.Background()) != DefaultLocale {
+		t.Fatalf("invalid locale from context")
+	}
+
+	de, _ := m.Render(core.MailSecurityNotice, DefaultLocale, Preview)
+	en, _ := m.Render(core.MailSecurityNotice, "en", Preview)
+	if !strings.Contains(de.Text, "01.03.2024 18:30:00") || !strings.Contains(en.Text, "2024-03-01 18:30:00") {
+		t.Fatalf("time not localized:\n%s\n%s", de.Text, en.Text)
+	}
+	// the board only gets German mails
+	fallback, err := m.Render(core.MailDoorCompromised, "en", Preview)
+	if err != nil || !strings.Contains(fallback.Text, "Hallo Vorstand") {
+		t.Fatalf("no fallback to default locale: %s", err)
+	}
+
+	// registration and reset both lead to setting a password but must not
+	// be mistaken for each other
+	for _, locale := range []string{DefaultLocale, "en"} {
+		registration, _ := m.Render(core.MailRegistration, locale, Preview)
+		reset, _ := m.Render(core.MailPasswordReset, locale, Preview)
+		if registration.Subject == reset.Subject || registration.Text == reset.Text {
+			t.Fatalf("registration and reset mail look alike in %s", locale)
+		}
 	}
 }
@@ -0,0 +1,69 @@
+package mailinglist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+type (
+	// Fake keeps subscriptions in memory, for tests and local development
+	Fake struct {
+		lists []core.MailingList
+
+		m           sync.Mutex
+		subscribers map[string]map[string]bool
+	}
+)
+
+func NewFake(lists ...core.MailingList) (f *Fake) {
+	f = &Fake{
+		lists:       lists,
+		subscribers: map[string]map[string]bool{},
+	}
+	for _, l := range lists {
+		f.subscribers[l.ID] = map[string]bool{}
+	}
+	return f
+}
+
+func (f *Fake) Lists() (lists []core.MailingList, err error) {
+	return f.lists, nil
+}
+
+func (f *Fake) Subscriptions(address string) (listIDs []string, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	for listID, subscribers := range f.subscribers {
+		if subscribers[strings.ToLower(address)] {
+			listIDs = append(listIDs, listID)
+		}
+	}
+	sort.Strings(listIDs)
+	return listIDs, nil
+}
+
+func (f *Fake) Subscribe(listID, address string) (err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	subscribers, ok := f.subscribers[listID]
+	if !ok {
+		return fmt.Errorf("unknown list: %s", listID)
+	}
+	subscribers[strings.ToLower(address)] = true
+	return nil
+}
+
+func (f *Fake) Unsubscribe(listID, address string) (err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	subscribers, ok := f.subscribers[listID]
+	if !ok {
+		return fmt.Errorf("unknown list: %s", listID)
+	}
+	delete(subscribers, strings.ToLower(address))
+	return nil
+}
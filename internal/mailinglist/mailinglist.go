@@ -0,0 +1,30 @@
+package mailinglist
+
+import (
+	"fmt"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Move transfers all subscriptions from one address to another, e.g. after
+// a member changed the mlAddress
+func Move(ml core.MailingLists, from, to string) (err error) {
+	if from == to || from == "" {
+		return nil
+	}
+	listIDs, err := ml.Subscriptions(from)
+	if err != nil {
+		return err
+	}
+	for _, listID := range listIDs {
+		err = ml.Subscribe(listID, to)
+		if err != nil {
+			return fmt.Errorf("unable to subscribe to %s: %s", listID, err)
+		}
+		err = ml.Unsubscribe(listID, from)
+		if err != nil {
+			return fmt.Errorf("unable to unsubscribe from %s: %s", listID, err)
+		}
+	}
+	return nil
+}
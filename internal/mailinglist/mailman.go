@@ -0,0 +1,140 @@
+package mailinglist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+type (
+	// Mailman talks to the Mailman 3 core REST api
+	Mailman struct {
+		baseURL  string
+		user     string
+		password string
+		client   *http.Client
+	}
+
+	mailmanLists struct {
+		Entries []struct {
+			ListID      string `json:"list_id"`
+			DisplayName string `json:"display_name"`
+			Description string `json:"description"`
+		} `json:"entries"`
+	}
+	mailmanMembers struct {
+		Entries []struct {
+			ListID   string `json:"list_id"`
+			MemberID string `json:"member_id"`
+			Role     string `json:"role"`
+		} `json:"entries"`
+	}
+)
+
+// NewMailman creates a client for the api at baseURL, e.g.
+// http://localhost:8001/3.1
+func NewMailman(baseURL, user, password string) (m *Mailman) {
+	return &Mailman{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (m *Mailman) Lists() (lists []core.MailingList, err error) {
+	res := mailmanLists{}
+	err = m.do("GET", "/lists", nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range res.Entries {
+		lists = append(lists, core.MailingList{
+			ID:          l.ListID,
+			Name:        l.DisplayName,
+			Description: l.Description,
+		})
+	}
+	return lists, nil
+}
+
+func (m *Mailman) Subscriptions(address string) (listIDs []string, err error) {
+	members, err := m.members(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members.Entries {
+		if member.Role == "member" {
+			listIDs = append(listIDs, member.ListID)
+		}
+	}
+	return listIDs, nil
+}
+
+func (m *Mailman) Subscribe(listID, address string) (err error) {
+	form := url.Values{
+		"list_id":       {listID},
+		"subscriber":    {address},
+		"pre_verified":  {"true"},
+		"pre_confirmed": {"true"},
+		"pre_approved":  {"true"},
+	}
+	return m.do("POST", "/members", form, nil)
+}
+
+func (m *Mailman) Unsubscribe(listID, address string) (err error) {
+	members, err := m.members(address)
+	if err != nil {
+		return err
+	}
+	for _, member := range members.Entries {
+		if member.ListID == listID && member.Role == "member" {
+			return m.do("DELETE", fmt.Sprintf("/members/%s", url.PathEscape(member.MemberID)), nil, nil)
+		}
+	}
+	return nil
+}
+
+func (m *Mailman) members(address string) (members mailmanMembers, err error) {
+	q := url.Values{"subscriber": {address}}
+	err = m.do("GET", "/members/find?"+q.Encode(), nil, &members)
+	return members, err
+}
+
+func (m *Mailman) do(method, path string, form url.Values, v interface{}) (err error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, m.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("unable to create request: %s", err)
+	}
+	req.SetBasicAuth(m.user, m.password)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach mailman: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("mailman %s %s: %s %s", method, path, res.Status, msg)
+	}
+	if v == nil {
+		return nil
+	}
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("unable to decode mailman response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package mailinglist
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMailman(t *testing.T) {
+	var deleted, subscribed string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/3.1/lists", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"entries": [{"list_id": "intern.example.com", "display_name": "Intern"}]}`)
+	})
+	mux.HandleFunc("/3.1/members/find", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("subscriber") != "member@example.com" {
+			t.Fatalf("invalid subscriber: %s", r.URL.Query().Get("subscriber"))
+		}
+		fmt.Fprint(w, `{"entries": [
+			{"list_id": "intern.example.com", "member_id": "42", "role": "member"},
+			{"list_id": "board.example.com", "member_id": "23", "role": "owner"}
+		]}`)
+	})
+	mux.HandleFunc("/3.1/members", func(w http.ResponseWriter, r *http.Request) {
+		subscribed = r.PostFormValue("list_id") + " " + r.PostFormValue("subscriber")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/3.1/members/", func(w http.ResponseWriter, r *http.Request) {
+		deleted = r.Method + " " + r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "restadmin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	m := NewMailman(srv.URL+"/3.1/", "restadmin", "secret")
+	lists, err := m.Lists()
+	if err != nil || len(lists) != 1 || lists[0].Name != "Intern" {
+		t.Fatalf("invalid lists: %+v %s", lists, err)
+	}
+	listIDs, err := m.Subscriptions("member@example.com")
+	if err != nil || len(listIDs) != 1 || listIDs[0] != "intern.example.com" {
+		t.Fatalf("invalid subscriptions: %v %s", listIDs, err)
+	}
+	err = m.Subscribe("public.example.com", "member@example.com")
+	if err != nil || subscribed != "public.example.com member@example.com" {
+		t.Fatalf("not subscribed: %s %s", subscribed, err)
+	}
+	err = m.Unsubscribe("intern.example.com", "member@example.com")
+	if err != nil || deleted != "DELETE /3.1/members/42" {
+		t.Fatalf("not unsubscribed: %s %s", deleted, err)
+	}
+
+	m = NewMailman(srv.URL+"/3.1", "restadmin", "wrong")
+	_, err = m.Lists()
+	if err == nil {
+		t.Fatalf("missing error for invalid credentials")
+	}
+}
@@ -0,0 +1,64 @@
+// Package membership describes the lifecycle of a membership as decided by
+// the board
+package membership
+
+import (
+	"time"
+)
+
+type (
+	State      string
+	Transition struct {
+		Time   time.Time
+		From   State
+		To     State
+		By     string
+		Reason string
+	}
+)
+
+const (
+	Applicant State = "applicant"
+	Trial     State = "trial"
+	Active    State = "active"
+	Suspended State = "suspended"
+	Left      State = "left"
+)
+
+var transitions = map[State][]State{
+	Applicant: {Trial, Active, Left},
+	Trial:     {Active, Suspended, Left},
+	Active:    {Suspended, Left},
+	Suspended: {Active, Left},
+	Left:      {Applicant},
+}
+
+// States lists all states in lifecycle order
+func States() []State {
+	return []State{Applicant, Trial, Active, Suspended, Left}
+}
+
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Next lists the states the board may move a member in state s to
+func (s State) Next() []State {
+	return transitions[s]
+}
+
+func (s State) CanTransition(to State) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Member tells whether the state grants access to the space and its
+// services. Only those entries live in ou=member.
+func (s State) Member() bool {
+	return s == Trial || s == Active
+}
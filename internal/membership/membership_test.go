@@ -0,0 +1,40 @@
+package membership
+
+import (
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	transitionOpts := []struct {
+		from State
+		to   State
+		want bool
+	}{
+		{Applicant, Trial, true},
+		{Applicant, Suspended, false},
+		{Trial, Active, true},
+		{Active, Applicant, false},
+		{Active, Active, false},
+		{Suspended, Active, true},
+		{Left, Active, false},
+		{Left, Applicant, true},
+		{State("unknown"), Active, false},
+	}
+	for _, o := range transitionOpts {
+		if o.from.CanTransition(o.to) != o.want {
+			t.Fatalf("invalid transition %s -> %s: want %t", o.from, o.to, o.want)
+		}
+	}
+}
+
+func TestMember(t *testing.T) {
+	for _, state := range States() {
+		if !state.Valid() {
+			t.Fatalf("invalid state: %s", state)
+		}
+		want := state == Trial || state == Active
+		if state.Member() != want {
+			t.Fatalf("invalid member flag for %s", state)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package offboarding revokes everything a leaving member had access to and
+// takes care of deleting the entry once the retention period ends
+package offboarding
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/membership"
+)
+
+type (
+	Offboarder struct {
+		mailingLists core.MailingLists
+		auditLog     core.AuditLog
+		retention    time.Duration
+		now          func() time.Time
+	}
+)
+
+// New creates an Offboarder keeping archived entries for retention.
+// mailingLists may be nil if no list server is configured.
+func New(mailingLists core.MailingLists, auditLog core.AuditLog, retention time.Duration) (o *Offboarder) {
+	return &Offboarder{
+		mailingLists: mailingLists,
+		auditLog:     auditLog,
+		retention:    retention,
+		now:          time.Now,
+	}
+}
+
+// Offboard runs all steps for nickname and stops at the first failing one.
+// Credentials are revoked first, so an unreachable list server can't keep
+// them valid. Every step can be repeated, so a failed offboarding is simply
+// started again.
+func (o *Offboarder) Offboard(ldap core.LdapWrap, nickname, actor, reason string) (err error) {
+	steps := []struct {
+		action string
+		run    func() (detail string, err error)
+	}{
+		{"disable login", func() (string, error) {
+			return "", ldap.DisableLogin(nickname)
+		}},
+		{"disable door password", func() (string, error) {
+			return "", ldap.InvalidateDoorPassword(nickname)
+		}},
+		{"remove ssh keys", func() (string, error) {
+			return removeSSHKeys(ldap, nickname)
+		}},
+		{"revoke badges", func() (string, error) {
+			return revokeBadges(ldap, nickname)
+		}},
+		{"leave groups", func() (string, error) {
+			groups, err := ldap.LeaveGroups(nickname)
+			return fmt.Sprintf("%d groups", len(groups)), err
+		}},
+		{"unsubscribe mailing lists", func() (string, error) {
+			return o.unsubscribe(ldap, nickname)
+		}},
+		{"leave", func() (string, error) {
+			return leave(ldap, nickname, actor, reason)
+		}},
+		{"archive", func() (string, error) {
+			deleteAfter := o.now().Add(o.retention)
+			return fmt.Sprintf("delete after %s", deleteAfter.Format(time.RFC3339)),
+				ldap.Archive(nickname, deleteAfter)
+		}},
+	}
+	for _, step := range steps {
+		detail, err := step.run()
+		if err != nil {
+			detail = fmt.Sprintf("failed: %s", err)
+		}
+		auditErr := o.auditLog.Record(audit.Event{
+			Time:    o.now(),
+			Actor:   actor,
+			Subject: nickname,
+			Action:  "offboarding: " + step.action,
+			Detail:  detail,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to %s: %s", step.action, err)
+		}
+		if auditErr != nil {
+			return fmt.Errorf("unable to record %s: %s", step.action, auditErr)
+		}
+	}
+	return nil
+}
+
+// Purge deletes all archived members whose retention period ended
+func (o *Offboarder) Purge(ldap core.LdapWrap, actor string) (deleted []string, err error) {
+	archives, err := ldap.ExpiredArchives(o.now())
+	if err != nil {
+		return nil, err
+	}
+	for _, archive := range archives {
+		err = ldap.DeleteArchived(archive.Nickname)
+		if err != nil {
+			return deleted, err
+		}
+		err = o.auditLog.Record(audit.Event{
+			Time:    o.now(),
+			Actor:   actor,
+			Subject: archive.Nickname,
+			Action:  "delete",
+			Detail:  fmt.Sprintf("retention ended %s", archive.DeleteAfter.Format(time.RFC3339)),
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("unable to record deletion: %s", err)
+		}
+		deleted = append(deleted, archive.Nickname)
+	}
+	return deleted, nil
+}
+
+func (o *Offboarder) unsubscribe(ldap core.LdapWrap, nickname string) (detail string, err error) {
+	if o.mailingLists == nil {
+		return "no list server configured", nil
+	}
+	mlAddress, _, err := ldap.MlAddress(nickname)
+	if err != nil || mlAddress == "" {
+		return "", err
+	}
+	listIDs, err := o.mailingLists.Subscriptions(mlAddress)
+	if err != nil {
+		return "", err
+	}
+	for _, listID := range listIDs {
+		err = o.mailingLists.Unsubscribe(listID, mlAddress)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s from %d lists", mlAddress, len(listIDs)), nil
+}
+
+func removeSSHKeys(ldap core.LdapWrap, nickname string) (detail string, err error) {
+	keys, err := ldap.SSHKeys(nickname)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		err = ldap.DeleteSSHKey(nickname, key)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d keys", len(keys)), nil
+}
+
+func revokeBadges(ldap core.LdapWrap, nickname string) (detail string, err error) {
+	badges, err := ldap.Badges(nickname)
+	if err != nil {
+		return "", err
+	}
+	for _, badge := range badges {
+		err = ldap.RevokeBadge(nickname, badge.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d badges", len(badges)), nil
+}
+
+func leave(ldap core.LdapWrap, nickname, actor, reason string) (detail string, err error) {
+	state, _, err := ldap.Membership(nickname)
+	if err != nil {
+		return "", err
+	}
+	if state == membership.Left {
+		return "already left", nil
+	}
+	err = ldap.ChangeMembership(nickname, membership.Transition{
+		To:     membership.Left,
+		By:     actor,
+		Reason: reason,
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s -> %s", state, membership.Left), nil
+}
@@ -0,0 +1,96 @@
+package offboarding
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/membership"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestOffboard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ml := mailinglist.NewFake(core.MailingList{ID: "intern.example.com"})
+	_ = ml.Subscribe("intern.example.com", "member@example.com")
+	auditLog := audit.NewMemory()
+	o := New(ml, auditLog, 365*24*time.Hour)
+	o.now = func() time.Time { return now }
+
+	gomock.InOrder(
+		mockLdapWrap.EXPECT().DisableLogin("member"),
+		mockLdapWrap.EXPECT().InvalidateDoorPassword("member"),
+		mockLdapWrap.EXPECT().SSHKeys("member").Return([]string{"ssh-ed25519 AAAA"}, nil),
+		mockLdapWrap.EXPECT().DeleteSSHKey("member", "ssh-ed25519 AAAA"),
+		mockLdapWrap.EXPECT().Badges("member").Return([]core.Badge{{ID: "ab"}, {ID: "cd"}}, nil),
+		mockLdapWrap.EXPECT().RevokeBadge("member", "ab"),
+		mockLdapWrap.EXPECT().RevokeBadge("member", "cd"),
+		mockLdapWrap.EXPECT().LeaveGroups("member").Return([]string{"laser"}, nil),
+		mockLdapWrap.EXPECT().MlAddress("member").Return("member@example.com", "member@example.com", nil),
+		mockLdapWrap.EXPECT().Membership("member").Return(membership.Active, nil, nil),
+		mockLdapWrap.EXPECT().ChangeMembership("member", membership.Transition{
+			To: membership.Left, By: "admin", Reason: "moved away",
+		}, nil),
+		mockLdapWrap.EXPECT().Archive("member", now.Add(365*24*time.Hour)),
+	)
+	err := o.Offboard(mockLdapWrap, "member", "admin", "moved away")
+	if err != nil {
+		t.Fatalf("unable to offboard: %s", err)
+	}
+	subscriptions, _ := ml.Subscriptions("member@example.com")
+	if len(subscriptions) != 0 {
+		t.Fatalf("still subscribed: %v", subscriptions)
+	}
+	events, _ := auditLog.Events("member")
+	if len(events) != 8 || events[7].Action != "offboarding: archive" {
+		t.Fatalf("invalid audit events: %+v", events)
+	}
+}
+
+func TestOffboardFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	auditLog := audit.NewMemory()
+	o := New(nil, auditLog, time.Hour)
+	mockLdapWrap.EXPECT().DisableLogin("member").Return(errors.New("ldap down"))
+	err := o.Offboard(mockLdapWrap, "member", "admin", "moved away")
+	if err == nil {
+		t.Fatalf("missing error")
+	}
+	events, _ := auditLog.Events("member")
+	if len(events) != 1 || events[0].Detail != "failed: ldap down" {
+		t.Fatalf("failure not recorded: %+v", events)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	auditLog := audit.NewMemory()
+	o := New(nil, auditLog, time.Hour)
+	o.now = func() time.Time { return now }
+	mockLdapWrap.EXPECT().ExpiredArchives(now).Return([]core.Archive{{Nickname: "old"}}, nil)
+	mockLdapWrap.EXPECT().DeleteArchived("old")
+	deleted, err := o.Purge(mockLdapWrap, "purge")
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("unable to purge: %v %s", deleted, err)
+	}
+	events, _ := auditLog.Events("old")
+	if len(events) != 1 || events[0].Action != "delete" {
+		t.Fatalf("deletion not recorded: %+v", events)
+	}
+}
@@ -0,0 +1,67 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/b4ckspace/members/internal/ssha"
+)
+
+type (
+	Client struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		// Secret is hashed like passwords, e.g. {SSHA512}..., public clients
+		// like single page apps have none and rely on PKCE alone
+		Secret       string   `json:"secret"`
+		RedirectURIs []string `json:"redirectURIs"`
+		// Service has to be in serviceEnabled of a member to log in
+		Service string `json:"service"`
+	}
+	clientConfig struct {
+		Clients []Client `json:"clients"`
+	}
+)
+
+func LoadClients(file string) (clients []Client, err error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open oidc clients: %s", err)
+	}
+	defer fp.Close()
+	c := clientConfig{}
+	err = json.NewDecoder(fp).Decode(&c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode oidc clients: %s", err)
+	}
+	ids := map[string]bool{}
+	for _, client := range c.Clients {
+		if client.ID == "" || client.Service == "" || len(client.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("oidc client %q needs an id, a service and redirect uris", client.ID)
+		}
+		if ids[client.ID] {
+			return nil, fmt.Errorf("oidc client %s defined twice", client.ID)
+		}
+		ids[client.ID] = true
+	}
+	return c.Clients, nil
+}
+
+func (c Client) validRedirectURI(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate checks the secret of confidential clients
+func (c Client) authenticate(secret string) bool {
+	if c.Secret == "" {
+		return true
+	}
+	ok, _ := ssha.Verify(secret, c.Secret)
+	return ok
+}
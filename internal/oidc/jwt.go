@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+type (
+	JWKSet struct {
+		Keys []JWK `json:"keys"`
+	}
+	JWK struct {
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+)
+
+var b64 = base64.RawURLEncoding
+
+// LoadKey reads the RSA signing key from a PEM file, a new key is generated
+// and written if the file does not exist
+func LoadKey(file string) (key *rsa.PrivateKey, err error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate signing key: %s", err)
+		}
+		data = pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+		err = os.WriteFile(file, data, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write signing key: %s", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read signing key: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block in %s", file)
+	}
+	key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %s", err)
+	}
+	return key, nil
+}
+
+func keyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return b64.EncodeToString(sum[:12])
+}
+
+// sign returns claims as RS256 signed JWT
+func (p *Provider) sign(claims interface{}) (token string, err error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": p.keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("unable to sign token: %s", err)
+	}
+	return signingInput + "." + b64.EncodeToString(signature), nil
+}
+
+// JWKS returns the public key clients verify id tokens with
+func (p *Provider) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: p.keyID,
+		N:   b64.EncodeToString(p.key.PublicKey.N.Bytes()),
+		E:   b64.EncodeToString(big.NewInt(int64(p.key.PublicKey.E)).Bytes()),
+	}}}
+}
@@ -0,0 +1,361 @@
+// Package oidc is a minimal OpenID Connect provider for the services of the
+// space. It supports the authorization code flow with PKCE (S256) only, codes
+// and access tokens are kept in memory.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	Provider struct {
+		issuer   string
+		key      *rsa.PrivateKey
+		keyID    string
+		clients  map[string]Client
+		codeTTL  time.Duration
+		tokenTTL time.Duration
+		now      func() time.Time
+
+		m      sync.Mutex
+		codes  map[string]Grant
+		tokens map[string]Grant
+	}
+
+	AuthRequest struct {
+		ClientID            string
+		RedirectURI         string
+		Scopes              []string
+		State               string
+		Nonce               string
+		CodeChallenge       string
+		CodeChallengeMethod string
+	}
+	// Grant is what a member allowed a client, first referenced by the
+	// authorization code, then by the access token
+	Grant struct {
+		ClientID      string
+		RedirectURI   string
+		Nickname      string
+		Scopes        []string
+		Nonce         string
+		CodeChallenge string
+		Claims        UserClaims
+		AuthTime      time.Time
+		Expires       time.Time
+	}
+	UserClaims struct {
+		Email string
+	}
+
+	TokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		IDToken     string `json:"id_token"`
+		Scope       string `json:"scope"`
+	}
+	Discovery struct {
+		Issuer                            string   `json:"issuer"`
+		AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+		TokenEndpoint                     string   `json:"token_endpoint"`
+		UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+		JWKSURI                           string   `json:"jwks_uri"`
+		ResponseTypesSupported            []string `json:"response_types_supported"`
+		SubjectTypesSupported             []string `json:"subject_types_supported"`
+		IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+		ScopesSupported                   []string `json:"scopes_supported"`
+		ClaimsSupported                   []string `json:"claims_supported"`
+		GrantTypesSupported               []string `json:"grant_types_supported"`
+		CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+		TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	}
+
+	// Error is an OAuth 2.0 error response. Authorization errors are sent
+	// back to the client, see ErrorRedirect.
+	Error struct {
+		Code        string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+)
+
+// Errors that must not be redirected, the redirect uri can not be trusted
+var (
+	ErrUnknownClient   = errors.New("unknown client")
+	ErrInvalidRedirect = errors.New("redirect uri not registered for client")
+)
+
+var scopesSupported = []string{"openid", "profile", "email"}
+
+func New(issuer string, key *rsa.PrivateKey, clients []Client) (p *Provider) {
+	p = &Provider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		key:      key,
+		keyID:    keyID(&key.PublicKey),
+		clients:  map[string]Client{},
+		codeTTL:  time.Minute,
+		tokenTTL: time.Hour,
+		now:      time.Now,
+		codes:    map[string]Grant{},
+		tokens:   map[string]Grant{},
+	}
+	for _, c := range clients {
+		p.clients[c.ID] = c
+	}
+	return p
+}
+
+func (p *Provider) Client(id string) (client Client, ok bool) {
+	client, ok = p.clients[id]
+	return client, ok
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Discovery returns the document served at
+// /.well-known/openid-configuration
+func (p *Provider) Discovery() Discovery {
+	return Discovery{
+		Issuer:                            p.issuer,
+		AuthorizationEndpoint:             p.issuer + "/oidc/authorize",
+		TokenEndpoint:                     p.issuer + "/oidc/token",
+		UserinfoEndpoint:                  p.issuer + "/oidc/userinfo",
+		JWKSURI:                           p.issuer + "/oidc/jwks",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   scopesSupported,
+		ClaimsSupported:                   []string{"sub", "preferred_username", "name", "email", "email_verified"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// ParseAuthRequest validates the query of an authorization request.
+// ErrUnknownClient and ErrInvalidRedirect have to be shown to the member, an
+// *Error goes back to the client.
+func (p *Provider) ParseAuthRequest(v url.Values) (req AuthRequest, client Client, err error) {
+	req = AuthRequest{
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		Scopes:              strings.Fields(v.Get("scope")),
+		State:               v.Get("state"),
+		Nonce:               v.Get("nonce"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+	client, ok := p.clients[req.ClientID]
+	if !ok {
+		return req, client, ErrUnknownClient
+	}
+	if !client.validRedirectURI(req.RedirectURI) {
+		return req, client, ErrInvalidRedirect
+	}
+	if v.Get("response_type") != "code" {
+		return req, client, &Error{"unsupported_response_type", "only code is supported"}
+	}
+	if !slices.Contains(req.Scopes, "openid") {
+		return req, client, &Error{"invalid_scope", "openid scope missing"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return req, client, &Error{"invalid_request", "pkce with S256 is required"}
+	}
+	return req, client, nil
+}
+
+// Authorize issues a code for a member and returns where to send the member
+func (p *Provider) Authorize(req AuthRequest, nickname string, claims UserClaims) (redirect string, err error) {
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := p.now()
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if slices.Contains(scopesSupported, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	p.m.Lock()
+	p.expire(now)
+	p.codes[code] = Grant{
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		Nickname:      nickname,
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		Claims:        claims,
+		AuthTime:      now,
+		Expires:       now.Add(p.codeTTL),
+	}
+	p.m.Unlock()
+
+	v := url.Values{"code": {code}}
+	if req.State != "" {
+		v.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, v), nil
+}
+
+// ErrorRedirect returns where to send the member if the request failed
+func ErrorRedirect(req AuthRequest, err *Error) string {
+	v := url.Values{"error": {err.Code}}
+	if err.Description != "" {
+		v.Set("error_description", err.Description)
+	}
+	if req.State != "" {
+		v.Set("state", req.State)
+	}
+	return appendQuery(req.RedirectURI, v)
+}
+
+// Exchange redeems an authorization code from the token endpoint. Codes can
+// be used once.
+func (p *Provider) Exchange(r *http.Request) (res TokenResponse, err error) {
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		return res, &Error{"unsupported_grant_type", ""}
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	client, ok := p.clients[clientID]
+	if !ok || !client.authenticate(secret) {
+		return res, &Error{"invalid_client", ""}
+	}
+
+	now := p.now()
+	code := r.PostFormValue("code")
+	p.m.Lock()
+	p.expire(now)
+	grant, ok := p.codes[code]
+	delete(p.codes, code)
+	p.m.Unlock()
+	if !ok || grant.ClientID != clientID {
+		return res, &Error{"invalid_grant", "unknown or expired code"}
+	}
+	if grant.RedirectURI != r.PostFormValue("redirect_uri") {
+		return res, &Error{"invalid_grant", "redirect uri does not match"}
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if subtle.ConstantTimeCompare([]byte(b64.EncodeToString(challenge[:])), []byte(grant.CodeChallenge)) != 1 {
+		return res, &Error{"invalid_grant", "code verifier does not match"}
+	}
+
+	accessToken, err := randomToken()
+	if err != nil {
+		return res, err
+	}
+	grant.Expires = now.Add(p.tokenTTL)
+	claims := p.claims(grant)
+	claims["iss"] = p.issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = grant.Expires.Unix()
+	claims["auth_time"] = grant.AuthTime.Unix()
+	if grant.Nonce != "" {
+		claims["nonce"] = grant.Nonce
+	}
+	idToken, err := p.sign(claims)
+	if err != nil {
+		return res, err
+	}
+
+	p.m.Lock()
+	p.tokens[accessToken] = grant
+	p.m.Unlock()
+	return TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.tokenTTL / time.Second),
+		IDToken:     idToken,
+		Scope:       strings.Join(grant.Scopes, " "),
+	}, nil
+}
+
+// Token returns the grant of the bearer token in r
+func (p *Provider) Token(r *http.Request) (grant Grant, err error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.FormValue("access_token")
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.expire(p.now())
+	grant, ok = p.tokens[token]
+	if !ok {
+		return grant, &Error{"invalid_token", ""}
+	}
+	return grant, nil
+}
+
+// UserInfo returns the claims for the userinfo endpoint, claims are the
+// current values as the grant only holds those from the login
+func (p *Provider) UserInfo(grant Grant, claims UserClaims) map[string]interface{} {
+	grant.Claims = claims
+	return p.claims(grant)
+}
+
+func (p *Provider) claims(grant Grant) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": grant.Nickname,
+	}
+	if slices.Contains(grant.Scopes, "profile") {
+		claims["preferred_username"] = grant.Nickname
+		claims["name"] = grant.Nickname
+	}
+	if slices.Contains(grant.Scopes, "email") && grant.Claims.Email != "" {
+		claims["email"] = grant.Claims.Email
+		claims["email_verified"] = true
+	}
+	return claims
+}
+
+func (p *Provider) expire(now time.Time) {
+	for code, grant := range p.codes {
+		if now.After(grant.Expires) {
+			delete(p.codes, code)
+		}
+	}
+	for token, grant := range p.tokens {
+		if now.After(grant.Expires) {
+			delete(p.tokens, token)
+		}
+	}
+}
+
+func appendQuery(uri string, v url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + v.Encode()
+	}
+	return uri + "?" + v.Encode()
+}
+
+func randomToken() (token string, err error) {
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate token: %s", err)
+	}
+	return b64.EncodeToString(random), nil
+}
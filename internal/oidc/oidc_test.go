@@ -0,0 +1,185 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b4ckspace/members/internal/ssha"
+)
+
+func testProvider(t *testing.T) (p *Provider, now *time.Time) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	secret, _ := ssha.Hash("s3cr3t", ssha.SSHA512)
+	p = New("https://members.example.com/", key, []Client{{
+		ID:           "wiki",
+		Secret:       secret,
+		RedirectURIs: []string{"https://wiki.example.com/callback"},
+		Service:      "wiki",
+	}})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	now = &t0
+	p.now = func() time.Time { return *now }
+	return p, now
+}
+
+func authQuery(challenge string) url.Values {
+	return url.Values{
+		"client_id":             {"wiki"},
+		"redirect_uri":          {"https://wiki.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid email profile offline_access"},
+		"state":                 {"st4te"},
+		"nonce":                 {"n0nce"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func pkce(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func exchange(p *Provider, code, verifier string) (TokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://wiki.example.com/callback"},
+		"code_verifier": {verifier},
+	}
+	r := httptest.NewRequest("POST", "/oidc/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("wiki", "s3cr3t")
+	return p.Exchange(r)
+}
+
+func authorize(t *testing.T, p *Provider, verifier string) (code string) {
+	req, _, err := p.ParseAuthRequest(authQuery(pkce(verifier)))
+	if err != nil {
+		t.Fatalf("valid request rejected: %s", err)
+	}
+	redirect, err := p.Authorize(req, "member", UserClaims{Email: "member@example.com"})
+	if err != nil {
+		t.Fatalf("unable to authorize: %s", err)
+	}
+	u, _ := url.Parse(redirect)
+	if u.Host != "wiki.example.com" || u.Query().Get("state") != "st4te" {
+		t.Fatalf("invalid redirect: %s", redirect)
+	}
+	return u.Query().Get("code")
+}
+
+func TestAuthRequest(t *testing.T) {
+	p, _ := testProvider(t)
+	requestOpts := []struct {
+		key, value string
+		err        error
+		code       string
+	}{
+		{"client_id", "pad", ErrUnknownClient, ""},
+		{"redirect_uri", "https://evil.example.com/callback", ErrInvalidRedirect, ""},
+		{"response_type", "token", nil, "unsupported_response_type"},
+		{"scope", "email", nil, "invalid_scope"},
+		{"code_challenge_method", "plain", nil, "invalid_request"},
+		{"code_challenge", "", nil, "invalid_request"},
+	}
+	for _, o := range requestOpts {
+		q := authQuery("challenge")
+		q.Set(o.key, o.value)
+		req, _, err := p.ParseAuthRequest(q)
+		var oe *Error
+		switch {
+		case o.err != nil && err != o.err:
+			t.Fatalf("invalid error for %s: %s", o.key, err)
+		case o.code != "" && (!errors.As(err, &oe) || oe.Code != o.code):
+			t.Fatalf("invalid error for %s: %s", o.key, err)
+		case o.code != "":
+			redirect := ErrorRedirect(req, oe)
+			if !strings.HasPrefix(redirect, "https://wiki.example.com/callback?error="+o.code) {
+				t.Fatalf("invalid error redirect: %s", redirect)
+			}
+		}
+	}
+}
+
+func TestCodeFlow(t *testing.T) {
+	p, now := testProvider(t)
+	verifier := "a-long-random-code-verifier-0123456789"
+
+	code := authorize(t, p, verifier)
+	_, err := exchange(p, code, "wrong-verifier")
+	if err == nil {
+		t.Fatalf("invalid code verifier accepted")
+	}
+	// a failed exchange burns the code
+	_, err = exchange(p, code, verifier)
+	if err == nil {
+		t.Fatalf("code used twice")
+	}
+
+	code = authorize(t, p, verifier)
+	res, err := exchange(p, code, verifier)
+	if err != nil {
+		t.Fatalf("unable to exchange code: %s", err)
+	}
+	if res.Scope != "openid email profile" {
+		t.Fatalf("unsupported scope granted: %s", res.Scope)
+	}
+
+	// verify the id token with the published key
+	parts := strings.Split(res.IDToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid id token: %s", res.IDToken)
+	}
+	jwk := p.JWKS().Keys[0]
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		t.Fatalf("invalid id token signature: %s", err)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := map[string]interface{}{}
+	_ = json.Unmarshal(payload, &claims)
+	if claims["iss"] != "https://members.example.com" || claims["aud"] != "wiki" ||
+		claims["sub"] != "member" || claims["nonce"] != "n0nce" ||
+		claims["email"] != "member@example.com" {
+		t.Fatalf("invalid claims: %v", claims)
+	}
+
+	r := httptest.NewRequest("GET", "/oidc/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+res.AccessToken)
+	grant, err := p.Token(r)
+	if err != nil || grant.Nickname != "member" {
+		t.Fatalf("access token not accepted: %s", err)
+	}
+	*now = now.Add(2 * time.Hour)
+	_, err = p.Token(r)
+	if err == nil {
+		t.Fatalf("expired access token accepted")
+	}
+
+	code = authorize(t, p, verifier)
+	*now = now.Add(2 * time.Minute)
+	_, err = exchange(p, code, verifier)
+	if err == nil {
+		t.Fatalf("expired code accepted")
+	}
+}
@@ -0,0 +1,187 @@
+// Package passkey runs the WebAuthn ceremonies to register security keys and
+// passkeys and to log in with them. The state between the two requests of a
+// ceremony is kept in memory and referenced by a random token.
+package passkey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/b4ckspace/members/internal/core"
+)
+
+type (
+	Manager struct {
+		webAuthn *webauthn.WebAuthn
+		ttl      time.Duration
+		now      func() time.Time
+
+		m          sync.Mutex
+		ceremonies map[string]ceremony
+	}
+	ceremony struct {
+		// nickname is empty for logins, the member is only known once the
+		// authenticator answered
+		nickname string
+		data     webauthn.SessionData
+		expires  time.Time
+	}
+
+	// User adapts a member to the webauthn library, the user handle is the
+	// nickname
+	User struct {
+		Nickname string
+		Passkeys []core.Passkey
+	}
+	// UserLookup loads the passkeys of the member a login claims to be
+	UserLookup func(nickname string) (user User, err error)
+)
+
+var (
+	ErrNoCeremony = errors.New("no pending ceremony found")
+	ErrCloned     = errors.New("sign counter went backwards, authenticator may be cloned")
+)
+
+// New creates a manager for the relying party rpID, e.g. members.example.com,
+// accepting responses from origins, e.g. https://members.example.com
+func New(rpID string, origins ...string) (m *Manager, err error) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Backspace Member Portal",
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn config: %s", err)
+	}
+	return &Manager{
+		webAuthn:   w,
+		ttl:        5 * time.Minute,
+		now:        time.Now,
+		ceremonies: map[string]ceremony{},
+	}, nil
+}
+
+func (u User) WebAuthnID() []byte          { return []byte(u.Nickname) }
+func (u User) WebAuthnName() string        { return u.Nickname }
+func (u User) WebAuthnDisplayName() string { return u.Nickname }
+func (u User) WebAuthnIcon() string        { return "" }
+func (u User) WebAuthnCredentials() (credentials []webauthn.Credential) {
+	for _, passkey := range u.Passkeys {
+		credentials = append(credentials, passkey.Credential)
+	}
+	return credentials
+}
+
+// BeginRegistration returns the options for navigator.credentials.create().
+// Keys the member already registered are excluded.
+func (m *Manager) BeginRegistration(user User) (options *protocol.CredentialCreation, token string, err error) {
+	exclude := []protocol.CredentialDescriptor{}
+	for _, credential := range user.WebAuthnCredentials() {
+		exclude = append(exclude, credential.Descriptor())
+	}
+	options, data, err := m.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to begin registration: %s", err)
+	}
+	token, err = m.put(user.Nickname, *data)
+	return options, token, err
+}
+
+// FinishRegistration verifies the response of the authenticator in r
+func (m *Manager) FinishRegistration(user User, token string, r *http.Request) (credential webauthn.Credential, err error) {
+	c, ok := m.take(token)
+	if !ok || c.nickname != user.Nickname {
+		return credential, ErrNoCeremony
+	}
+	cred, err := m.webAuthn.FinishRegistration(user, c.data, r)
+	if err != nil {
+		return credential, fmt.Errorf("unable to finish registration: %s", err)
+	}
+	return *cred, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get(). No
+// credentials are listed, the browser offers the passkeys it knows for this
+// site.
+func (m *Manager) BeginLogin() (options *protocol.CredentialAssertion, token string, err error) {
+	options, data, err := m.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to begin login: %s", err)
+	}
+	token, err = m.put("", *data)
+	return options, token, err
+}
+
+// FinishLogin verifies the assertion in r and returns the member it belongs
+// to along with the credential carrying the new sign counter
+func (m *Manager) FinishLogin(token string, r *http.Request, lookup UserLookup) (nickname string, credential webauthn.Credential, err error) {
+	c, ok := m.take(token)
+	if !ok {
+		return "", credential, ErrNoCeremony
+	}
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := lookup(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		nickname = user.Nickname
+		return user, nil
+	}
+	cred, err := m.webAuthn.FinishDiscoverableLogin(handler, c.data, r)
+	if err != nil {
+		return "", credential, fmt.Errorf("unable to finish login: %s", err)
+	}
+	if cred.Authenticator.CloneWarning {
+		return "", credential, ErrCloned
+	}
+	return nickname, *cred, nil
+}
+
+func (m *Manager) put(nickname string, data webauthn.SessionData) (token string, err error) {
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate token: %s", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(random)
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	now := m.now()
+	for t, c := range m.ceremonies {
+		if now.After(c.expires) {
+			delete(m.ceremonies, t)
+		}
+	}
+	m.ceremonies[token] = ceremony{
+		nickname: nickname,
+		data:     data,
+		expires:  now.Add(m.ttl),
+	}
+	return token, nil
+}
+
+// take returns a ceremony only once, so every challenge can be answered once
+func (m *Manager) take(token string) (c ceremony, ok bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	c, ok = m.ceremonies[token]
+	delete(m.ceremonies, token)
+	if !ok || m.now().After(c.expires) {
+		return c, false
+	}
+	return c, true
+}
@@ -0,0 +1,91 @@
+package passkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakewebauthn"
+)
+
+func TestPasskey(t *testing.T) {
+	m, err := New("members.example.com", "https://members.example.com")
+	if err != nil {
+		t.Fatalf("unable to create manager: %s", err)
+	}
+	authenticator := fakewebauthn.New("https://members.example.com")
+	user := User{Nickname: "member"}
+
+	options, token, err := m.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("unable to begin registration: %s", err)
+	}
+	raw, _ := json.Marshal(options)
+	response, err := authenticator.Create(raw)
+	if err != nil {
+		t.Fatalf("authenticator failed: %s", err)
+	}
+	_, err = m.FinishRegistration(User{Nickname: "other"}, token, httptest.NewRequest("POST", "/", bytes.NewReader(response)))
+	if err != ErrNoCeremony {
+		t.Fatalf("registration finished for other member: %s", err)
+	}
+	options, token, _ = m.BeginRegistration(user)
+	raw, _ = json.Marshal(options)
+	response, _ = authenticator.Create(raw)
+	credential, err := m.FinishRegistration(user, token, httptest.NewRequest("POST", "/", bytes.NewReader(response)))
+	if err != nil {
+		t.Fatalf("unable to finish registration: %s", err)
+	}
+	user.Passkeys = []core.Passkey{{Credential: credential}}
+
+	lookup := func(nickname string) (User, error) {
+		if nickname != "member" {
+			return User{}, errors.New("unknown member")
+		}
+		return user, nil
+	}
+	login := func() (nickname string, err error) {
+		options, token, err := m.BeginLogin()
+		if err != nil {
+			t.Fatalf("unable to begin login: %s", err)
+		}
+		raw, _ := json.Marshal(options)
+		response, err := authenticator.Get(raw)
+		if err != nil {
+			t.Fatalf("authenticator failed: %s", err)
+		}
+		nickname, credential, err := m.FinishLogin(token, httptest.NewRequest("POST", "/", bytes.NewReader(response)), lookup)
+		if err == nil {
+			user.Passkeys[0].Credential = credential
+		}
+		_, _, reused := m.FinishLogin(token, httptest.NewRequest("POST", "/", bytes.NewReader(response)), lookup)
+		if reused != ErrNoCeremony {
+			t.Fatalf("challenge answered twice: %s", reused)
+		}
+		return nickname, err
+	}
+
+	for i := 0; i < 2; i++ {
+		nickname, err := login()
+		if err != nil || nickname != "member" {
+			t.Fatalf("unable to login: %s %s", nickname, err)
+		}
+	}
+	authenticator.Rewind()
+	_, err = login()
+	if err != ErrCloned {
+		t.Fatalf("cloned authenticator accepted: %s", err)
+	}
+
+	other := fakewebauthn.New("https://evil.example.com")
+	options, token, _ = m.BeginRegistration(user)
+	raw, _ = json.Marshal(options)
+	response, _ = other.Create(raw)
+	_, err = m.FinishRegistration(user, token, httptest.NewRequest("POST", "/", bytes.NewReader(response)))
+	if err == nil {
+		t.Fatalf("credential from other origin accepted")
+	}
+}
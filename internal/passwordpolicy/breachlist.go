@@ -0,0 +1,60 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// BreachList looks up passwords in an offline copy of the HIBP
+	// k-anonymity range files. The directory contains one file per hash
+	// prefix, e.g. "5BAA6.txt", with lines of "SUFFIX:COUNT".
+	BreachList struct {
+		dir string
+	}
+)
+
+func NewBreachList(dir string) (bl *BreachList, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open breach list: %s", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breach list %s is not a directory", dir)
+	}
+	return &BreachList{dir: dir}, nil
+}
+
+func (bl *BreachList) Contains(password string) (breached bool, err error) {
+	hash := fmt.Sprintf("%X", sha1.Sum([]byte(password)))
+	prefix, suffix := hash[:5], hash[5:]
+
+	fp, err := os.Open(filepath.Join(bl.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to open range file: %s", err)
+	}
+	defer fp.Close()
+
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		lineSuffix, count, _ := strings.Cut(strings.TrimSpace(s.Text()), ":")
+		if !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		// padding entries of the range api have a count of zero
+		return count != "0", nil
+	}
+	if err := s.Err(); err != nil {
+		return false, fmt.Errorf("unable to read range file: %s", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,114 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+type (
+	// Input holds everything a Rule may look at
+	Input struct {
+		Password string
+		Nickname string
+		// MainPassword is only set when a door password is checked
+		MainPassword string
+	}
+
+	Rule interface {
+		Check(in Input) error
+	}
+	RuleFunc func(in Input) error
+
+	Policy struct {
+		rules []Rule
+	}
+)
+
+func (f RuleFunc) Check(in Input) error {
+	return f(in)
+}
+
+func New(rules ...Rule) (p *Policy) {
+	return &Policy{rules: rules}
+}
+
+// Default only enforces the minimal length the portal always had
+func Default() (p *Policy) {
+	return New(MinLength(8))
+}
+
+// Check returns the error of the first rule that rejects the input
+func (p *Policy) Check(in Input) (err error) {
+	for _, rule := range p.rules {
+		err = rule.Check(in)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func MinLength(n int) Rule {
+	return RuleFunc(func(in Input) error {
+		if len([]rune(in.Password)) < n {
+			return fmt.Errorf("to short, needs at least %d characters", n)
+		}
+		return nil
+	})
+}
+
+// MinStrength rejects passwords with a zxcvbn score (0-4) below score
+func MinStrength(score int) Rule {
+	return RuleFunc(func(in Input) error {
+		userInputs := []string{}
+		if in.Nickname != "" {
+			userInputs = append(userInputs, in.Nickname)
+		}
+		res := zxcvbn.PasswordStrength(in.Password, userInputs)
+		if res.Score < score {
+			return fmt.Errorf("to weak, strength %d of 4, needs at least %d", res.Score, score)
+		}
+		return nil
+	})
+}
+
+func NotNickname() Rule {
+	return RuleFunc(func(in Input) error {
+		if in.Nickname == "" {
+			return nil
+		}
+		password := strings.ToLower(in.Password)
+		nickname := strings.ToLower(in.Nickname)
+		if strings.Contains(password, nickname) {
+			return errors.New("must not contain the nickname")
+		}
+		return nil
+	})
+}
+
+// DifferentFromMain is meant for door passwords, which may be required to
+// differ from the main password
+func DifferentFromMain() Rule {
+	return RuleFunc(func(in Input) error {
+		if in.MainPassword != "" && in.Password == in.MainPassword {
+			return errors.New("must differ from the password")
+		}
+		return nil
+	})
+}
+
+func NotBreached(bl *BreachList) Rule {
+	return RuleFunc(func(in Input) error {
+		breached, err := bl.Contains(in.Password)
+		if err != nil {
+			return fmt.Errorf("unable to check breach list: %s", err)
+		}
+		if breached {
+			return errors.New("is part of a known data breach")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package passwordpolicy
+
+import (
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	bl, err := NewBreachList("testdata")
+	if err != nil {
+		t.Fatalf("unable to load breach list: %s", err)
+	}
+	p := New(
+		MinLength(8),
+		NotNickname(),
+		MinStrength(3),
+		NotBreached(bl),
+	)
+	policyData := []struct {
+		password string
+		ok       bool
+	}{
+		{"short", false},
+		{"password", false},
+		{"xXmemberXx2024", false},
+		{"correct horse battery staple", false},
+		{"Gl4sf4ser-Tr0mmel-Kompass", true},
+	}
+	for _, d := range policyData {
+		err := p.Check(Input{Password: d.password, Nickname: "member"})
+		if (err == nil) != d.ok {
+			t.Fatalf("unexpected result for '%s': %s", d.password, err)
+		}
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	bl, err := NewBreachList("testdata")
+	if err != nil {
+		t.Fatalf("unable to load breach list: %s", err)
+	}
+	breached, err := bl.Contains("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("unable to check breach list: %s", err)
+	}
+	if !breached {
+		t.Fatalf("password not found in breach list")
+	}
+	breached, err = bl.Contains("not in the list")
+	if err != nil {
+		t.Fatalf("unable to check breach list: %s", err)
+	}
+	if breached {
+		t.Fatalf("password unexpectedly found in breach list")
+	}
+}
@@ -0,0 +1,226 @@
+package pending
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Registrations keeps registrations until their email address is
+	// confirmed. The nickname stays reserved until the registration expires.
+	// Only hashes of the tokens are kept, with a file they survive restarts.
+	Registrations struct {
+		ttl  time.Duration
+		now  func() time.Time
+		file string
+
+		m      sync.Mutex
+		byHash map[string]Registration
+	}
+	Registration struct {
+		Nickname string
+		EMail    string
+		MlAddr   string
+		Expires  time.Time
+		// Claimed is set while the member is being created
+		Claimed bool
+	}
+)
+
+var (
+	ErrReserved = errors.New("nickname is reserved")
+	ErrNotFound = errors.New("no pending registration found")
+)
+
+func NewRegistrations(ttl time.Duration) (r *Registrations) {
+	return &Registrations{
+		ttl:    ttl,
+		now:    time.Now,
+		byHash: map[string]Registration{},
+	}
+}
+
+// OpenRegistrations loads the registrations stored in file and writes every
+// change back to it
+func OpenRegistrations(file string, ttl time.Duration) (r *Registrations, err error) {
+	r = NewRegistrations(ttl)
+	r.file = file
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registrations: %s", err)
+	}
+	err = json.Unmarshal(content, &r.byHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse registrations: %s", err)
+	}
+	// a claim is never finished after a restart
+	for hash, reg := range r.byHash {
+		reg.Claimed = false
+		r.byHash[hash] = reg
+	}
+	return r, nil
+}
+
+// Reserve stores a registration and returns the token for the confirmation
+// link
+func (r *Registrations) Reserve(nickname, email, mlAddr string) (token string, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.expire()
+
+	if r.reserved(nickname) {
+		return "", ErrReserved
+	}
+	token, err = randomToken()
+	if err != nil {
+		return "", err
+	}
+	r.byHash[hashToken(token)] = Registration{
+		Nickname: nickname,
+		EMail:    email,
+		MlAddr:   mlAddr,
+		Expires:  r.now().Add(r.ttl),
+	}
+	err = r.save()
+	if err != nil {
+		delete(r.byHash, hashToken(token))
+		return "", err
+	}
+	return token, nil
+}
+
+// Lookup returns the registration belonging to token. It stays reserved
+// until it is released after the member was created.
+func (r *Registrations) Lookup(token string) (reg Registration, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.expire()
+
+	reg, ok := r.byHash[hashToken(token)]
+	if !ok {
+		return reg, ErrNotFound
+	}
+	return reg, nil
+}
+
+// Claim hands out a registration only once, so concurrent confirmations
+// cannot both create the member. A failed creation has to be unclaimed, a
+// successful one released.
+func (r *Registrations) Claim(token string) (reg Registration, err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.expire()
+
+	hash := hashToken(token)
+	reg, ok := r.byHash[hash]
+	if !ok || reg.Claimed {
+		return reg, ErrNotFound
+	}
+	reg.Claimed = true
+	r.byHash[hash] = reg
+	return reg, nil
+}
+
+// Unclaim allows to confirm the registration again
+func (r *Registrations) Unclaim(token string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	hash := hashToken(token)
+	reg, ok := r.byHash[hash]
+	if !ok {
+		return
+	}
+	reg.Claimed = false
+	r.byHash[hash] = reg
+}
+
+// Release drops a registration, e.g. when the confirmation mail could not be
+// sent or the member was created
+func (r *Registrations) Release(token string) (err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.byHash, hashToken(token))
+	return r.save()
+}
+
+func (r *Registrations) Reserved(nickname string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.expire()
+	return r.reserved(nickname)
+}
+
+func (r *Registrations) reserved(nickname string) bool {
+	for _, reg := range r.byHash {
+		if strings.EqualFold(reg.Nickname, nickname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registrations) expire() {
+	now := r.now()
+	for hash, reg := range r.byHash {
+		if now.After(reg.Expires) {
+			delete(r.byHash, hash)
+		}
+	}
+}
+
+// save replaces the file, a crash while writing keeps the old content
+func (r *Registrations) save() (err error) {
+	if r.file == "" {
+		return nil
+	}
+	content, err := json.Marshal(r.byHash)
+	if err != nil {
+		return fmt.Errorf("unable to encode registrations: %s", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.file), ".registrations")
+	if err != nil {
+		return fmt.Errorf("unable to store registrations: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to store registrations: %s", err)
+	}
+	err = os.Rename(tmp.Name(), r.file)
+	if err != nil {
+		return fmt.Errorf("unable to store registrations: %s", err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func randomToken() (token string, err error) {
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate random token: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
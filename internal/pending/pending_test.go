@@ -0,0 +1,123 @@
+package pending
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistrations(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRegistrations(time.Hour)
+	r.now = func() time.Time { return now }
+
+	token, err := r.Reserve("member", "member@example.com", "member@example.com")
+	if err != nil {
+		t.Fatalf("unable to reserve: %s", err)
+	}
+	_, err = r.Reserve("Member", "other@example.com", "other@example.com")
+	if !errors.Is(err, ErrReserved) {
+		t.Fatalf("nickname not reserved: %s", err)
+	}
+
+	reg, err := r.Lookup(token)
+	if err != nil {
+		t.Fatalf("unable to look up: %s", err)
+	}
+	if reg.Nickname != "member" || reg.EMail != "member@example.com" {
+		t.Fatalf("invalid registration: %+v", reg)
+	}
+	if !r.Reserved("member") {
+		t.Fatalf("lookup released registration")
+	}
+	r.Release(token)
+	_, err = r.Lookup(token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("released token found: %s", err)
+	}
+
+	token, err = r.Reserve("member", "member@example.com", "member@example.com")
+	if err != nil {
+		t.Fatalf("unable to reserve: %s", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if r.Reserved("member") {
+		t.Fatalf("reservation did not expire")
+	}
+	_, err = r.Lookup(token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expired token found: %s", err)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	r := NewRegistrations(time.Hour)
+	token, err := r.Reserve("member", "member@example.com", "member@example.com")
+	if err != nil {
+		t.Fatalf("unable to reserve: %s", err)
+	}
+
+	_, err = r.Claim(token)
+	if err != nil {
+		t.Fatalf("unable to claim: %s", err)
+	}
+	_, err = r.Claim(token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("registration claimed twice: %s", err)
+	}
+	if !r.Reserved("member") {
+		t.Fatalf("claim released registration")
+	}
+	r.Unclaim(token)
+	_, err = r.Claim(token)
+	if err != nil {
+		t.Fatalf("unable to claim again: %s", err)
+	}
+}
+
+func TestOpenRegistrations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "registrations.json")
+	r, err := OpenRegistrations(file, time.Hour)
+	if err != nil {
+		t.Fatalf("unable to open: %s", err)
+	}
+	token, err := r.Reserve("member", "member@example.com", "member@example.com")
+	if err != nil {
+		t.Fatalf("unable to reserve: %s", err)
+	}
+	other, err := r.Reserve("other", "other@example.com", "other@example.com")
+	if err != nil {
+		t.Fatalf("unable to reserve: %s", err)
+	}
+	_, err = r.Claim(token)
+	if err != nil {
+		t.Fatalf("unable to claim: %s", err)
+	}
+	err = r.Release(other)
+	if err != nil {
+		t.Fatalf("unable to release: %s", err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read file: %s", err)
+	}
+	if bytes.Contains(content, []byte(token)) {
+		t.Fatalf("token stored in plain text")
+	}
+
+	r, err = OpenRegistrations(file, time.Hour)
+	if err != nil {
+		t.Fatalf("unable to reopen: %s", err)
+	}
+	reg, err := r.Claim(token)
+	if err != nil || reg.Nickname != "member" {
+		t.Fatalf("registration lost on restart: %+v %s", reg, err)
+	}
+	if r.Reserved("other") {
+		t.Fatalf("released registration restored")
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type (
+	// Catalog lists the services members can have in serviceEnabled
+	Catalog struct {
+		Services []Service `json:"services"`
+	}
+	Service struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		// SelfService services can be enabled by members themselves
+		SelfService bool `json:"selfService"`
+		// NeedsApproval services are requested by members and enabled by
+		// an admin
+		NeedsApproval bool `json:"needsApproval"`
+		// Default services are enabled on registration
+		Default bool `json:"default"`
+	}
+)
+
+// Default returns the services new members always got
+func Default() (c *Catalog) {
+	return &Catalog{Services: []Service{
+		{Name: "htaccess", Description: "Interne Webseiten", Default: true},
+		{Name: "mail", Description: "E-Mail-Adresse @hackerspace-bamberg.de", Default: true},
+		{Name: "redmine", Description: "Redmine", Default: true},
+	}}
+}
+
+func Load(file string) (c *Catalog, err error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open service catalog: %s", err)
+	}
+	defer fp.Close()
+	c = &Catalog{}
+	err = json.NewDecoder(fp).Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode service catalog: %s", err)
+	}
+	names := map[string]bool{}
+	for _, s := range c.Services {
+		if s.Name == "" {
+			return nil, fmt.Errorf("service without name in catalog")
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("service %s defined twice", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return c, nil
+}
+
+func (c *Catalog) Get(name string) (s Service, ok bool) {
+	for _, s := range c.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return s, false
+}
+
+func (c *Catalog) Defaults() (names []string) {
+	for _, s := range c.Services {
+		if s.Default {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Disableable services can be switched off by members
+func (s Service) Disableable() bool {
+	return s.SelfService || s.NeedsApproval
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var sessionBucket = []byte("sessions")
+
+// Bolt keeps sessions in a bbolt database so they survive restarts. Only the
+// hashed session ids are written to disk.
+type Bolt struct {
+	db *bolt.DB
+}
+
+func NewBolt(file string) (b *Bolt, err error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open session database: %s", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create session bucket: %s", err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Put(s Session) error {
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Put([]byte(s.Key), value)
+	})
+}
+
+func (b *Bolt) Get(key string) (s Session, ok bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(sessionBucket).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(value, &s)
+	})
+	return s, ok, err
+}
+
+func (b *Bolt) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).Delete([]byte(key))
+	})
+}
+
+func (b *Bolt) List() (sessions []Session, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).ForEach(func(k, v []byte) error {
+			s := Session{}
+			err := json.Unmarshal(v, &s)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, s)
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
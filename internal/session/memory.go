@@ -0,0 +1,45 @@
+package session
+
+import (
+	"sync"
+)
+
+// Memory keeps sessions until the process ends
+type Memory struct {
+	m        sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemory() *Memory {
+	return &Memory{sessions: map[string]Session{}}
+}
+
+func (m *Memory) Put(s Session) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.sessions[s.Key] = s
+	return nil
+}
+
+func (m *Memory) Get(key string) (s Session, ok bool, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	s, ok = m.sessions[key]
+	return s, ok, nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+	delete(m.sessions, key)
+	return nil
+}
+
+func (m *Memory) List() (sessions []Session, err error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,207 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// Store keeps the sessions of logged in members in a Backend. Sessions
+	// end after idleTimeout without requests and absoluteTimeout after the
+	// login.
+	Store struct {
+		backend         Backend
+		idleTimeout     time.Duration
+		absoluteTimeout time.Duration
+		now             func() time.Time
+
+		// m serializes read-modify-write cycles on the backend
+		m sync.Mutex
+	}
+	// Backend persists sessions by their key
+	Backend interface {
+		Put(s Session) error
+		Get(key string) (s Session, ok bool, err error)
+		Delete(key string) error
+		List() (sessions []Session, err error)
+	}
+	Session struct {
+		// ID is the cookie value, it is only known to the client and never
+		// stored
+		ID string `json:"-"`
+		// Key is the hash of ID, sessions are stored and listed by it
+		Key      string    `json:"key"`
+		Nickname string    `json:"nickname"`
+		Created  time.Time `json:"created"`
+		LastSeen time.Time `json:"lastSeen"`
+		// SecondFactor is set once the member confirmed the login with a
+		// one-time password
+		SecondFactor bool `json:"secondFactor"`
+		// Failures counts wrong one-time passwords of a pending login
+		Failures   int    `json:"failures,omitempty"`
+		RemoteAddr string `json:"remoteAddr"`
+		UserAgent  string `json:"userAgent"`
+	}
+)
+
+// LastSeen is only written back once per touchInterval to spare the backend
+const touchInterval = time.Minute
+
+func NewStore(backend Backend, idleTimeout, absoluteTimeout time.Duration) (s *Store) {
+	return &Store{
+		backend:         backend,
+		idleTimeout:     idleTimeout,
+		absoluteTimeout: absoluteTimeout,
+		now:             time.Now,
+	}
+}
+
+// Start stores a new session for template, which carries the nickname and
+// client information
+func (s *Store) Start(template Session) (session Session, err error) {
+	id, err := randomID()
+	if err != nil {
+		return session, err
+	}
+	now := s.now()
+	session = template
+	session.ID = id
+	session.Key = Key(id)
+	session.Created = now
+	session.LastSeen = now
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	err = s.backend.Put(session)
+	if err != nil {
+		return session, fmt.Errorf("unable to store session: %s", err)
+	}
+	return session, nil
+}
+
+func (s *Store) Create(nickname string) (session Session, err error) {
+	return s.Start(Session{Nickname: nickname})
+}
+
+// Get returns a valid session and marks it as used
+func (s *Store) Get(id string) (session Session, ok bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	session, ok, err := s.backend.Get(Key(id))
+	if err != nil || !ok {
+		return session, false
+	}
+	now := s.now()
+	if s.expired(session, now) {
+		_ = s.backend.Delete(session.Key)
+		return session, false
+	}
+	if now.Sub(session.LastSeen) >= touchInterval {
+		session.LastSeen = now
+		_ = s.backend.Put(session)
+	}
+	session.ID = id
+	return session, true
+}
+
+func (s *Store) SetSecondFactor(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	session, ok, err := s.backend.Get(Key(id))
+	if err == nil && ok {
+		session.SecondFactor = true
+		_ = s.backend.Put(session)
+	}
+}
+
+// AddFailure counts a failed attempt and returns the failures so far
+func (s *Store) AddFailure(id string) (failures int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	session, ok, err := s.backend.Get(Key(id))
+	if err != nil || !ok {
+		return 0
+	}
+	session.Failures++
+	_ = s.backend.Put(session)
+	return session.Failures
+}
+
+func (s *Store) Delete(id string) error {
+	return s.Revoke(Key(id))
+}
+
+// Revoke ends the session stored under key
+func (s *Store) Revoke(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.backend.Delete(key)
+}
+
+// List returns the active sessions of a member, expired sessions of all
+// members are removed on the way
+func (s *Store) List(nickname string) (sessions []Session, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	all, err := s.backend.List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sessions: %s", err)
+	}
+	now := s.now()
+	for _, session := range all {
+		if s.expired(session, now) {
+			_ = s.backend.Delete(session.Key)
+			continue
+		}
+		if session.Nickname == nickname {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteAll logs a member out everywhere except for the session with the key
+// keep, which may be empty
+func (s *Store) DeleteAll(nickname, keep string) (err error) {
+	sessions, err := s.List(nickname)
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, session := range sessions {
+		if session.Key == keep {
+			continue
+		}
+		err = s.backend.Delete(session.Key)
+		if err != nil {
+			return fmt.Errorf("unable to delete session: %s", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) expired(session Session, now time.Time) bool {
+	return now.Sub(session.LastSeen) > s.idleTimeout ||
+		now.Sub(session.Created) > s.absoluteTimeout
+}
+
+// Key returns the hash a session id is stored under
+func Key(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomID() (id string, err error) {
+	random := make([]byte, 32)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate session id: %s", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
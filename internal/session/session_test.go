@@ -0,0 +1,105 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	b, err := NewBolt(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatalf("unable to open bolt: %s", err)
+	}
+	defer b.Close()
+
+	for name, backend := range map[string]Backend{"memory": NewMemory(), "bolt": b} {
+		s := NewStore(backend, time.Hour, 24*time.Hour)
+		now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		s.now = func() time.Time { return now }
+
+		first, err := s.Start(Session{Nickname: "member", UserAgent: "curl"})
+		if err != nil {
+			t.Fatalf("%s: unable to start session: %s", name, err)
+		}
+		if first.Key == first.ID || first.Key != Key(first.ID) {
+			t.Fatalf("%s: session stored by id", name)
+		}
+		second, _ := s.Create("member")
+		other, _ := s.Create("other")
+
+		// idle timeout
+		now = now.Add(50 * time.Minute)
+		if _, ok := s.Get(first.ID); !ok {
+			t.Fatalf("%s: active session expired", name)
+		}
+		now = now.Add(50 * time.Minute)
+		if session, ok := s.Get(first.ID); !ok || session.UserAgent != "curl" {
+			t.Fatalf("%s: used session expired: %+v", name, session)
+		}
+		if _, ok := s.Get(second.ID); ok {
+			t.Fatalf("%s: idle session still valid", name)
+		}
+
+		// absolute timeout
+		for i := 0; i < 30; i++ {
+			now = now.Add(50 * time.Minute)
+			if _, ok := s.Get(first.ID); !ok {
+				break
+			}
+		}
+		if _, ok := s.Get(first.ID); ok {
+			t.Fatalf("%s: session outlived absolute timeout", name)
+		}
+
+		// log out everywhere
+		sessions := []Session{}
+		for i := 0; i < 3; i++ {
+			session, _ := s.Create("member")
+			sessions = append(sessions, session)
+		}
+		other, _ = s.Create("other")
+		s.SetSecondFactor(sessions[0].ID)
+		list, err := s.List("member")
+		if err != nil || len(list) != 3 {
+			t.Fatalf("%s: invalid session list: %+v %s", name, list, err)
+		}
+		err = s.DeleteAll("member", sessions[0].Key)
+		if err != nil {
+			t.Fatalf("%s: unable to delete sessions: %s", name, err)
+		}
+		if session, ok := s.Get(sessions[0].ID); !ok || !session.SecondFactor {
+			t.Fatalf("%s: kept session removed: %+v", name, session)
+		}
+		if _, ok := s.Get(sessions[1].ID); ok {
+			t.Fatalf("%s: session not removed", name)
+		}
+		if _, ok := s.Get(other.ID); !ok {
+			t.Fatalf("%s: session of other member removed", name)
+		}
+		_ = s.Revoke(sessions[0].Key)
+		if _, ok := s.Get(sessions[0].ID); ok {
+			t.Fatalf("%s: revoked session still valid", name)
+		}
+	}
+}
+
+func TestBoltRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sessions.db")
+	b, err := NewBolt(file)
+	if err != nil {
+		t.Fatalf("unable to open bolt: %s", err)
+	}
+	session, _ := NewStore(b, time.Hour, time.Hour).Create("member")
+	b.Close()
+
+	b, err = NewBolt(file)
+	if err != nil {
+		t.Fatalf("unable to reopen bolt: %s", err)
+	}
+	defer b.Close()
+	restored, ok := NewStore(b, time.Hour, time.Hour).Get(session.ID)
+	if !ok || restored.Nickname != "member" {
+		t.Fatalf("session lost on restart")
+	}
+}
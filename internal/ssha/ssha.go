@@ -5,9 +5,11 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"hash"
+	"strings"
 )
 
 type (
@@ -57,3 +59,39 @@ func Hash(password string, algo HashAlgo) (hashed string, err error) {
 	hashed = fmt.Sprintf("{%s}%s", algo, hash64)
 	return
 }
+
+// Verify checks password against a hash as created by Hash
+func Verify(password, hashed string) (ok bool, err error) {
+	var s hash.Hash
+	end := strings.Index(hashed, "}")
+	if !strings.HasPrefix(hashed, "{") || end < 0 {
+		return false, fmt.Errorf("invalid hash format")
+	}
+	switch HashAlgo(hashed[1:end]) {
+	case SSHA:
+		s = sha1.New()
+	case SSHA256:
+		s = sha256.New()
+	case SSHA512:
+		s = sha512.New()
+	default:
+		return false, fmt.Errorf("invalid hash algo")
+	}
+	hashWithSalt, err := base64.StdEncoding.DecodeString(hashed[end+1:])
+	if err != nil {
+		return false, fmt.Errorf("unable to decode hash: %s", err)
+	}
+	if len(hashWithSalt) <= s.Size() {
+		return false, fmt.Errorf("hash without salt")
+	}
+	hash, salt := hashWithSalt[:s.Size()], hashWithSalt[s.Size():]
+	_, err = s.Write([]byte(password))
+	if err != nil {
+		return false, err
+	}
+	_, err = s.Write(salt)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(s.Sum(nil), hash) == 1, nil
+}
@@ -0,0 +1,82 @@
+package sshkey
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type (
+	Key struct {
+		Type        string
+		Bits        int
+		Fingerprint string
+		Label       string
+		// Line is the key in authorized_keys format as stored in LDAP
+		Line string
+	}
+)
+
+const MinRSABits = 3072
+
+var labelValid = regexp.MustCompile(`^[a-zA-Z0-9@._+-]*$`)
+
+// Parse validates a public key in authorized_keys format. A non empty label
+// replaces the comment of the key.
+func Parse(line, label string) (key Key, err error) {
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(line)))
+	if err != nil {
+		return key, errors.New("unable to parse key")
+	}
+	if len(options) > 0 {
+		return key, errors.New("key options are not allowed")
+	}
+	if label == "" {
+		label = comment
+	}
+	label = strings.TrimSpace(label)
+	if len(label) > 64 || !labelValid.MatchString(label) {
+		return key, errors.New("invalid label")
+	}
+
+	key = Key{
+		Type:        pub.Type(),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		Label:       label,
+	}
+	switch pub.Type() {
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519:
+		key.Bits = 256
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoSKECDSA256:
+		key.Bits = 256
+	case ssh.KeyAlgoECDSA384:
+		key.Bits = 384
+	case ssh.KeyAlgoECDSA521:
+		key.Bits = 521
+	case ssh.KeyAlgoRSA:
+		cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+		if !ok {
+			return key, errors.New("unable to read rsa key")
+		}
+		rsaPub, ok := cryptoPub.CryptoPublicKey().(*rsa.PublicKey)
+		if !ok {
+			return key, errors.New("unable to read rsa key")
+		}
+		key.Bits = rsaPub.N.BitLen()
+		if key.Bits < MinRSABits {
+			return key, fmt.Errorf("rsa keys need at least %d bits", MinRSABits)
+		}
+	default:
+		return key, fmt.Errorf("key type %s is not allowed", pub.Type())
+	}
+
+	key.Line = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if key.Label != "" {
+		key.Line = fmt.Sprintf("%s %s", key.Line, key.Label)
+	}
+	return key, nil
+}
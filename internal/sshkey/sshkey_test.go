@@ -0,0 +1,64 @@
+package sshkey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKey(t *testing.T, key interface{}, comment string) string {
+	pub, err := ssh.NewPublicKey(key)
+	if err != nil {
+		t.Fatalf("unable to create ssh key: %s", err)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+func TestParse(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate rsa key: %s", err)
+	}
+	edLine := authorizedKey(t, edPub, "fnord@laptop")
+
+	key, err := Parse(edLine, "")
+	if err != nil {
+		t.Fatalf("unable to parse ed25519 key: %s", err)
+	}
+	if key.Type != ssh.KeyAlgoED25519 || key.Label != "fnord@laptop" || key.Line != edLine {
+		t.Fatalf("invalid key: %+v", key)
+	}
+	if !strings.HasPrefix(key.Fingerprint, "SHA256:") {
+		t.Fatalf("invalid fingerprint: %s", key.Fingerprint)
+	}
+
+	key, err = Parse(edLine, "desktop")
+	if err != nil || key.Label != "desktop" || !strings.HasSuffix(key.Line, " desktop") {
+		t.Fatalf("label not applied: %+v %s", key, err)
+	}
+
+	invalidKeys := []struct {
+		line  string
+		label string
+	}{
+		{authorizedKey(t, &rsaKey.PublicKey, ""), ""},
+		{"command=\"/bin/sh\" " + edLine, ""},
+		{"ssh-ed25519 AAAAnotakey", ""},
+		{edLine, "<script>"},
+	}
+	for _, d := range invalidKeys {
+		_, err = Parse(d.line, d.label)
+		if err == nil {
+			t.Fatalf("invalid key accepted: %s", d.line)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package totp implements time based one-time passwords (RFC 6238) as used by
+// common authenticator apps, plus the recovery codes handed out on enrollment.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"rsc.io/qr"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// codes of the previous and the next period are accepted as well, clocks
+	// of phones are rarely exact
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret
+func GenerateSecret() (secret string, err error) {
+	random := make([]byte, 20)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate secret: %s", err)
+	}
+	return encoding.EncodeToString(random), nil
+}
+
+// Code returns the one-time password for secret at t
+func Code(secret string, t time.Time) (code string, err error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid secret: %s", err)
+	}
+	return code6(key, t.Unix()/int64(Period/time.Second)), nil
+}
+
+// Verify checks code against secret at t
+func Verify(secret, code string, t time.Time) (ok bool) {
+	_, ok = Match(secret, code, t)
+	return ok
+}
+
+// Match checks code against secret at t and returns the counter of the
+// period the code belongs to
+func Match(secret, code string, t time.Time) (counter int64, ok bool) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	now := t.Unix() / int64(Period/time.Second)
+	for i := -skew; i <= skew; i++ {
+		expected := code6(key, now+int64(i))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return now + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+func code6(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// URI returns the otpauth uri authenticator apps import from the qr code
+func URI(secret, issuer, account string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// QRCode renders uri as png
+func QRCode(uri string) (png []byte, err error) {
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode qr code: %s", err)
+	}
+	code.Scale = 4
+	return code.PNG(), nil
+}
+
+// RecoveryCodes returns n random codes of the form "xxxxx-xxxxx"
+func RecoveryCodes(n int) (codes []string, err error) {
+	for i := 0; i < n; i++ {
+		random := make([]byte, 7)
+		_, err = rand.Read(random)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate recovery code: %s", err)
+		}
+		code := strings.ToLower(encoding.EncodeToString(random))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips what members tend to type along with a code
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// test vectors from RFC 6238, truncated to six digits
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		code, err := Code(secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("unable to generate code: %s", err)
+		}
+		if code != v.code {
+			t.Fatalf("invalid code at %d: %s != %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("unable to generate secret: %s", err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	code, _ := Code(secret, now)
+
+	verifyOpts := []struct {
+		t  time.Time
+		ok bool
+	}{
+		{now, true},
+		{now.Add(-Period), true},
+		{now.Add(Period), true},
+		{now.Add(-2 * Period), false},
+		{now.Add(3 * Period), false},
+	}
+	for _, o := range verifyOpts {
+		if Verify(secret, code, o.t) != o.ok {
+			t.Fatalf("invalid result at %s", o.t)
+		}
+	}
+	if Verify(secret, "", now) || Verify("invalid!", code, now) {
+		t.Fatalf("invalid input accepted")
+	}
+	counter, ok := Match(secret, code, now.Add(Period))
+	if !ok || counter != now.Unix()/30 {
+		t.Fatalf("invalid counter: %d", counter)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := RecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("unable to generate codes: %v %s", codes, err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || seen[code] {
+			t.Fatalf("invalid code: %s", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if NormalizeRecoveryCode(typed) != code {
+			t.Fatalf("unable to normalize %s", typed)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "backspace", "fnord")
+	if uri != "otpauth://totp/backspace:fnord?issuer=backspace&secret=JBSWY3DPEHPK3PXP" {
+		t.Fatalf("invalid uri: %s", uri)
+	}
+	png, err := QRCode(uri)
+	if err != nil || len(png) == 0 {
+		t.Fatalf("unable to render qr code: %s", err)
+	}
+}
@@ -0,0 +1,373 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/membership"
+)
+
+func (web *Web) handleServiceRequests(r *http.Request) (td *ServiceRequestsTemplateData) {
+	td = &ServiceRequestsTemplateData{
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		nickname := r.PostFormValue("nickname")
+		service := r.PostFormValue("service")
+		_, ok := web.services.Get(service)
+		switch action := r.PostFormValue("action"); {
+		case !ok:
+			err = fmt.Errorf("unknown service: %s", service)
+		case action == "approve":
+			err = ldap.EnableService(nickname, service)
+		case action == "decline":
+			err = ldap.DeclineService(nickname, service)
+		default:
+			err = fmt.Errorf("invalid action: %s", action)
+		}
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Anfrage konnte nicht bearbeitet werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{
+				SUCCESS,
+				fmt.Sprintf("Anfrage von %s für %s wurde bearbeitet", nickname, service),
+			})
+		}
+	}
+
+	td.Requests, err = ldap.ServiceRequests()
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Anfragen konnten nicht geladen werden",
+		})
+	}
+	return
+}
+
+func (web *Web) handleMembership(r *http.Request, admin string) (td *MembershipTemplateData) {
+	td = &MembershipTemplateData{
+		Nickname: r.FormValue("nickname"),
+		Messages: []Message{},
+	}
+	if td.Nickname == "" {
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		t := membership.Transition{
+			To:     membership.State(r.PostFormValue("state")),
+			By:     admin,
+			Reason: strings.Join(strings.Fields(r.PostFormValue("reason")), " "),
+		}
+		if t.Reason == "" {
+			err = errors.New("missing reason")
+		} else {
+			err = ldap.ChangeMembership(td.Nickname, t, web.services.Defaults())
+		}
+		if err != nil {
+			log.Printf("membership error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Status konnte nicht geändert werden, bitte gib einen Grund an",
+			})
+		} else {
+			web.audit(admin, td.Nickname, "membership", fmt.Sprintf("%s: %s", t.To, t.Reason))
+			td.Messages = append(td.Messages, Message{
+				SUCCESS,
+				fmt.Sprintf("%s ist jetzt %s", td.Nickname, t.To),
+			})
+		}
+	}
+
+	td.State, td.Transitions, err = ldap.Membership(td.Nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Member konnte nicht gefunden werden",
+		})
+		return
+	}
+	td.Found = true
+	return
+}
+
+func (web *Web) handleOffboard(r *http.Request, admin string) (td *MembershipTemplateData) {
+	td = &MembershipTemplateData{
+		Nickname: r.PostFormValue("nickname"),
+		Messages: []Message{},
+	}
+	if r.Method != "POST" || td.Nickname == "" {
+		return
+	}
+	reason := strings.Join(strings.Fields(r.PostFormValue("reason")), " ")
+	if reason == "" {
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Bitte gib einen Grund für das Offboarding an",
+		})
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	err = web.offboarder.Offboard(ldap, td.Nickname, admin, reason)
+	if err != nil {
+		log.Printf("offboarding error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Offboarding ist fehlgeschlagen, die bisherigen Schritte wurden protokolliert. Bitte erneut versuchen.",
+		})
+		return
+	}
+	// logged in sessions would otherwise outlive the disabled login
+	err = web.sessions.DeleteAll(td.Nickname, "")
+	if err != nil {
+		log.Printf("session error: %s", err)
+	}
+	// the member left all groups and with them all roles
+	web.roleCache.Invalidate(td.Nickname)
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		fmt.Sprintf("%s wurde archiviert und wird am %s gelöscht",
+			td.Nickname, time.Now().Add(web.retention).Format("02.01.2006")),
+	})
+	return
+}
+
+func (web *Web) audit(actor, subject, action, detail string) {
+	err := web.auditLog.Record(audit.Event{
+		Actor:   actor,
+		Subject: subject,
+		Action:  action,
+		Detail:  detail,
+	})
+	if err != nil {
+		log.Printf("audit error: %s", err)
+	}
+}
+
+// notify tells the member about a security relevant change of their account.
+// The change already happened, so failures are only logged.
+func (web *Web) notify(r *http.Request, ldap core.LdapWrap, nickname, change string) {
+	_, email, err := ldap.MlAddress(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return
+	}
+	web.sendNotice(r, email, nickname, change)
+}
+
+// sendNotice sends the security notice to the given address, e.g. the
+// previous one after an email change
+func (web *Web) sendNotice(r *http.Request, to, nickname, change string) {
+	if to == "" {
+		return
+	}
+	err := web.sendMail(r, to, core.MailSecurityNotice, core.MailData{
+		Nickname: nickname,
+		Notice: core.SecurityNotice{
+			Change:     change,
+			Time:       web.now(),
+			RemoteAddr: clientAddr(r),
+			UserAgent:  r.UserAgent(),
+		},
+	})
+	if err != nil {
+		log.Printf("mail error: %s", err)
+	}
+}
+
+const directoryPageSize = 50
+
+func parseDirectoryQuery(r *http.Request) (q core.DirectoryQuery) {
+	query := r.URL.Query()
+	q = core.DirectoryQuery{
+		OU:       query.Get("ou"),
+		Service:  query.Get("service"),
+		State:    membership.State(query.Get("state")),
+		Search:   strings.TrimSpace(query.Get("q")),
+		PageSize: directoryPageSize,
+	}
+	q.Page, _ = strconv.Atoi(query.Get("page"))
+	if q.Page < 0 {
+		q.Page = 0
+	}
+	return q
+}
+
+func directoryURL(q core.DirectoryQuery, page int, format string) string {
+	v := url.Values{}
+	for key, value := range map[string]string{
+		"ou": q.OU, "service": q.Service, "state": string(q.State), "q": q.Search, "format": format,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	if page > 0 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return "/admin/members?" + v.Encode()
+}
+
+func (web *Web) handleDirectory(r *http.Request) (td *DirectoryTemplateData) {
+	q := parseDirectoryQuery(r)
+	td = &DirectoryTemplateData{
+		Query:    q,
+		OUs:      ldapwrap.DirectoryOUs,
+		Services: web.services.Services,
+		States:   membership.States(),
+		CSVURL:   directoryURL(q, 0, "csv"),
+		JSONURL:  directoryURL(q, 0, "json"),
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	td.Entries, td.More, err = ldap.Directory(q)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Mitglieder konnten nicht geladen werden",
+		})
+		return
+	}
+	if q.Page > 0 {
+		td.PrevURL = directoryURL(q, q.Page-1, "")
+	}
+	if td.More {
+		td.NextURL = directoryURL(q, q.Page+1, "")
+	}
+	return
+}
+
+// handleDirectoryExport writes all members matching the query as csv or
+// json, e.g. for the treasurer
+func (web *Web) handleDirectoryExport(w http.ResponseWriter, r *http.Request, format string) {
+	q := parseDirectoryQuery(r)
+	q.Page, q.PageSize = 0, 0
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		http.Error(w, "ldap unavailable", http.StatusBadGateway)
+		return
+	}
+	entries, _, err := ldap.Directory(q)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		http.Error(w, "unable to load members", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []core.DirectoryEntry{}
+	}
+
+	filename := fmt.Sprintf("members-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(entries)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"nickname", "ou", "state", "email", "alternateEmail", "mlAddress", "services"})
+		for _, e := range entries {
+			_ = cw.Write([]string{
+				csvField(e.Nickname), csvField(e.OU), csvField(string(e.State)),
+				csvField(e.Email), csvField(e.AlternateEmail), csvField(e.MlAddress),
+				csvField(strings.Join(e.Services, " ")),
+			})
+		}
+		cw.Flush()
+		err = cw.Error()
+	default:
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("unable to write export: %s", err)
+	}
+}
+
+// csvField keeps spreadsheets from evaluating member supplied values as
+// formula
+func csvField(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// handleAdminBadges lets door admins enroll badges for other members, e.g.
+// at the reader in the space
+func (web *Web) handleAdminBadges(r *http.Request, admin string) (td *BadgeTemplateData) {
+	nickname := strings.TrimSpace(r.FormValue("nickname"))
+	if nickname == "" {
+		return &BadgeTemplateData{
+			Admin:    true,
+			Form:     &BadgeForm{},
+			Messages: []Message{},
+		}
+	}
+	td = web.handleBadges(r, nickname, admin)
+	td.Admin = true
+	return td
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/authz"
+	"github.com/b4ckspace/members/internal/session"
+)
+
+const (
+	sessionCookie   = "members_session"
+	twoFactorCookie = "members_2fa"
+)
+
+type memberHandlerFunc func(w http.ResponseWriter, r *http.Request, nickname string)
+
+// currentSession returns the session of the logged in member
+func (web *Web) currentSession(r *http.Request) (s session.Session, ok bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return s, false
+	}
+	return web.sessions.Get(c.Value)
+}
+
+// currentMember returns the nickname of the logged in member
+func (web *Web) currentMember(r *http.Request) (nickname string, ok bool) {
+	s, ok := web.currentSession(r)
+	if !ok {
+		return "", false
+	}
+	return s.Nickname, true
+}
+
+func (web *Web) startSession(w http.ResponseWriter, r *http.Request, nickname string, secondFactor bool) (err error) {
+	s, err := web.sessions.Start(session.Session{
+		Nickname:     nickname,
+		SecondFactor: secondFactor,
+		RemoteAddr:   clientAddr(r),
+		UserAgent:    r.UserAgent(),
+	})
+	if err != nil {
+		return err
+	}
+	web.setCookie(w, sessionCookie, s.ID)
+	return nil
+}
+
+func (web *Web) endSession(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(sessionCookie)
+	if err == nil {
+		web.sessions.Delete(c.Value)
+	}
+	web.setCookie(w, sessionCookie, "")
+}
+
+// startTwoFactor remembers a member whose password was correct until the
+// one-time password is entered on /login/totp
+func (web *Web) startTwoFactor(w http.ResponseWriter, nickname string) (err error) {
+	s, err := web.twoFactorLogins.Create(nickname)
+	if err != nil {
+		return err
+	}
+	web.setCookie(w, twoFactorCookie, s.ID)
+	return nil
+}
+
+// twoFactorMember returns the nickname of a login waiting for the one-time
+// password
+func (web *Web) twoFactorMember(r *http.Request) (nickname string, ok bool) {
+	c, err := r.Cookie(twoFactorCookie)
+	if err != nil {
+		return "", false
+	}
+	s, ok := web.twoFactorLogins.Get(c.Value)
+	if !ok {
+		return "", false
+	}
+	return s.Nickname, true
+}
+
+func (web *Web) endTwoFactor(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(twoFactorCookie)
+	if err == nil {
+		web.twoFactorLogins.Delete(c.Value)
+	}
+	web.setCookie(w, twoFactorCookie, "")
+}
+
+// setCookie sets a session cookie, an empty value removes it
+func (web *Web) setCookie(w http.ResponseWriter, name, value string) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   web.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+// requireLogin redirects to the login page if nobody is logged in
+func (web *Web) requireLogin(next memberHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nickname, ok := web.currentMember(r)
+		if !ok {
+			target := fmt.Sprintf("/login?next=%s", url.QueryEscape(r.URL.RequestURI()))
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		next(w, r, nickname)
+	}
+}
+
+// redirectTarget only allows local paths to prevent open redirects
+func redirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") ||
+		strings.HasPrefix(next, "/\\") {
+		return "/profile"
+	}
+	return next
+}
+
+// roles resolves the groups of a member to roles, cached for a while
+func (web *Web) roles(r *http.Request, nickname string) (roles []authz.Role, err error) {
+	roles, ok := web.roleCache.Get(nickname)
+	if ok {
+		return roles, nil
+	}
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	groups, err := ldap.MemberGroups(nickname)
+	if err != nil {
+		return nil, err
+	}
+	roles = []authz.Role{}
+	for _, group := range groups {
+		roles = append(roles, authz.Role(group))
+	}
+	web.roleCache.Set(nickname, roles)
+	return roles, nil
+}
+
+// permissions returns what the member may do, nothing if the roles can not
+// be resolved
+func (web *Web) permissions(r *http.Request, nickname string) map[authz.Permission]bool {
+	roles, err := web.roles(r, nickname)
+	if err != nil {
+		log.Printf("unable to resolve roles of %s: %s", nickname, err)
+	}
+	return web.policy.Permissions(roles)
+}
+
+// requirePermission only lets members through whose roles grant permission.
+// With enforced two-factor authentication the login has to be confirmed with
+// a one-time password, members without one are sent to the enrollment.
+func (web *Web) requirePermission(permission authz.Permission, next memberHandlerFunc) http.HandlerFunc {
+	return web.requireLogin(func(w http.ResponseWriter, r *http.Request, nickname string) {
+		if !web.permissions(r, nickname)[permission] {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if web.enforceTwoFactor {
+			s, ok := web.currentSession(r)
+			if !ok || !s.SecondFactor {
+				target := fmt.Sprintf("/totp?next=%s", url.QueryEscape(r.URL.RequestURI()))
+				http.Redirect(w, r, target, http.StatusSeeOther)
+				return
+			}
+		}
+		next(w, r, nickname)
+	})
+}
+
+// twoFactorRequired tells whether the roles of a member require a second
+// factor
+func (web *Web) twoFactorRequired(r *http.Request, nickname string) bool {
+	if !web.enforceTwoFactor {
+		return false
+	}
+	for _, ok := range web.permissions(r, nickname) {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestAuthorization(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+
+	dir := fakeldap.New()
+	for _, nickname := range []string{"member", "treasurer", "dooradmin", "board"} {
+		dir.Seed("uid="+nickname+",ou=member,dc=backspace", map[string][]string{
+			"objectClass": {"backspaceMember"},
+			"uid":         {nickname},
+		})
+	}
+	dir.Seed("cn=treasurer,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"treasurer"},
+		"memberUid":   {"treasurer"},
+	})
+	dir.Seed("cn=door-admin,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"door-admin"},
+		"member":      {"uid=dooradmin,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=board,ou=member,dc=backspace"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+
+	web, err := New(mockMailer, ld)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	sessions := map[string]string{}
+	for _, nickname := range []string{"member", "treasurer", "dooradmin", "board"} {
+		s, _ := web.sessions.Create(nickname)
+		sessions[nickname] = s.ID
+	}
+
+	get := func(nickname, url string) (status int, body string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", url, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessions[nickname]})
+		web.GetMux().ServeHTTP(rr, req)
+		b, _ := io.ReadAll(rr.Result().Body)
+		return rr.Code, string(b)
+	}
+
+	authzOpts := []struct {
+		nickname string
+		url      string
+		status   int
+	}{
+		{"member", "/admin/members", http.StatusForbidden},
+		{"member", "/admin/badges", http.StatusForbidden},
+		{"treasurer", "/admin/members", http.StatusOK},
+		{"treasurer", "/admin/members?format=csv", http.StatusOK},
+		{"treasurer", "/admin/membership", http.StatusForbidden},
+		{"treasurer", "/admin/badges", http.StatusForbidden},
+		{"dooradmin", "/admin/badges", http.StatusOK},
+		{"dooradmin", "/admin/members?format=csv", http.StatusForbidden},
+		{"board", "/admin/membership", http.StatusOK},
+		{"board", "/admin/services", http.StatusOK},
+	}
+	for _, o := range authzOpts {
+		status, _ := get(o.nickname, o.url)
+		if status != o.status {
+			t.Fatalf("invalid status for %s on %s: %d", o.nickname, o.url, status)
+		}
+	}
+
+	_, body := get("member", "/profile")
+	if strings.Contains(body, "/admin/") {
+		t.Fatalf("admin links shown to member")
+	}
+	_, body = get("treasurer", "/profile")
+	if !strings.Contains(body, "/admin/members") || strings.Contains(body, "/admin/membership") {
+		t.Fatalf("invalid admin links for treasurer")
+	}
+
+	// roles stay cached until invalidated
+	req := ldap.NewModifyRequest("cn=board,ou=groups,dc=backspace", nil)
+	req.Delete("member", []string{"uid=board,ou=member,dc=backspace"})
+	err = dir.Modify(req)
+	if err != nil {
+		t.Fatalf("unable to remove board member: %s", err)
+	}
+	if status, _ := get("board", "/admin/membership"); status != http.StatusOK {
+		t.Fatalf("roles not cached: %d", status)
+	}
+	web.roleCache.Invalidate("board")
+	if status, _ := get("board", "/admin/membership"); status != http.StatusForbidden {
+		t.Fatalf("removed role still granted: %d", status)
+	}
+}
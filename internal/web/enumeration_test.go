@@ -0,0 +1,129 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestEnumerationProtection(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	minResponseTime := 20 * time.Millisecond
+	web, err := New(mockMailer, mockLdapDailer, WithEnumerationProtection(minResponseTime))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+
+	// reset of a known and an unknown member
+	mockLdapWrap.EXPECT().PasswordReset("member").Return([]core.PasswordResetToken{
+		{Nickname: "member", Email: "member@email.local", Token: "t0k3n"},
+	}, nil)
+	mockMailer.EXPECT().Send(gomock.Any(), "member@email.local", core.MailPasswordReset, core.MailData{
+		Nickname: "member",
+		Token:    "t0k3n",
+	})
+	known, duration := post(web, "/reset", "nickname=member")
+	if duration < minResponseTime {
+		t.Fatalf("response faster than %s: %s", minResponseTime, duration)
+	}
+	mockLdapWrap.EXPECT().PasswordReset("nobody").Return(nil, nil)
+	unknown, duration := post(web, "/reset", "nickname=nobody")
+	if duration < minResponseTime {
+		t.Fatalf("response faster than %s: %s", minResponseTime, duration)
+	}
+	if !bytes.Equal(known, unknown) {
+		t.Fatalf("reset responses differ:\n%s\nvs\n%s", known, unknown)
+	}
+
+	// registration of a taken and a free nickname
+	form := "nickname=member&email=member@email.local&mladdr=own"
+	mockLdapWrap.EXPECT().MemberExists("member").Return(true, nil)
+	mockMailer.EXPECT().Send(gomock.Any(), "member@email.local", core.MailNicknameTaken, core.MailData{
+		Nickname: "member",
+	})
+	taken, _ := post(web, "/register", form)
+	mockLdapWrap.EXPECT().MemberExists("member").Return(false, nil)
+	mockMailer.EXPECT().Send(gomock.Any(), "member@email.local", core.MailRegistration, gomock.Any())
+	free, _ := post(web, "/register", form)
+	if !bytes.Equal(taken, free) {
+		t.Fatalf("register responses differ:\n%s\nvs\n%s", taken, free)
+	}
+	if bytes.Contains(taken, []byte("bereits vergeben")) {
+		t.Fatalf("register response leaks existing nickname")
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	now := time.Now()
+	web.availabilityLimiter = newRateLimiter(1, 2)
+	web.availabilityLimiter.now = func() time.Time { return now }
+
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).Times(2)
+	mockLdapWrap.EXPECT().MemberExists("member").Return(true, nil)
+	mockLdapWrap.EXPECT().MemberExists("other").Return(false, nil)
+
+	availableOpts := []struct {
+		nickname  string
+		status    int
+		available bool
+	}{
+		{"member", http.StatusOK, false},
+		{"other", http.StatusOK, true},
+		{"member", http.StatusTooManyRequests, false},
+	}
+	for _, o := range availableOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/register/available?nickname="+o.nickname, nil)
+		web.GetMux().ServeHTTP(rr, req)
+		if rr.Code != o.status {
+			t.Fatalf("invalid status for %s: %d", o.nickname, rr.Code)
+		}
+		res := AvailableResponse{}
+		err := json.NewDecoder(rr.Body).Decode(&res)
+		if err != nil {
+			t.Fatalf("unable to decode response: %s", err)
+		}
+		if res.Available != o.available {
+			t.Fatalf("invalid availability for %s: %t", o.nickname, res.Available)
+		}
+	}
+}
+
+func post(web *Web, url, form string) (body []byte, duration time.Duration) {
+	req := httptest.NewRequest("POST", url, strings.NewReader(form))
+	req = req.WithContext(context.Background())
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	web.GetMux().ServeHTTP(rr, req)
+	duration = time.Since(start)
+	body, _ = io.ReadAll(rr.Result().Body)
+	return body, duration
+}
@@ -1,16 +1,26 @@
 package web
 
 import (
+	"fmt"
 	"log"
 	"net/http"
-	"fmt"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ldapwrap"
 )
 
 func (web *Web) handlePassword(r *http.Request) (td *PasswordTemplateData) {
 	qs := r.URL.Query()
 	token := qs.Get("t")
 
-	f, posted, err := parsePasswordForm(r)
+	// an invalid token is rejected by SetPassword later on
+	nickname := ""
+	if t, err := ldapwrap.ParseToken(token); err == nil {
+		nickname = t.Nickname
+	}
+
+	f, posted, err := parsePasswordForm(r, nickname, web.passwordPolicy, web.doorpassPolicy)
 	td = &PasswordTemplateData{
 		Form:     f,
 		Messages: []Message{},
@@ -42,6 +52,14 @@ func (web *Web) handlePassword(r *http.Request) (td *PasswordTemplateData) {
 		})
 		return
 	}
+	// whoever knew the old password is logged out everywhere
+	if nickname != "" {
+		err = web.sessions.DeleteAll(nickname, "")
+		if err != nil {
+			log.Printf("session error: %s", err)
+		}
+		web.notify(r, ldap, nickname, "Passwort und Türsystem Passwort wurden neu gesetzt")
+	}
 
 	td.Messages = append(
 		td.Messages,
@@ -84,7 +102,8 @@ func (web *Web) handleRegister(r *http.Request) (td *RegisterTemplateData) {
 		})
 		return
 	}
-	if exists {
+	taken := exists || web.registrations.Reserved(td.Form.Nickname)
+	if taken && !web.enumerationProtection {
 		td.Messages = append(td.Messages, Message{
 			DANGER,
 			fmt.Sprintf(
@@ -95,33 +114,112 @@ func (web *Web) handleRegister(r *http.Request) (td *RegisterTemplateData) {
 		return
 	}
 
-	token, err := ldap.RegisterMember(td.Form.Nickname, td.Form.EMail, td.Form.MlAddr)
+	if taken {
+		// tell the owner of the address instead of the requester
+		err = web.sendThirdPartyMail(r, td.Form.EMail, core.MailNicknameTaken, core.MailData{
+			Nickname: td.Form.Nickname,
+		})
+	} else {
+		var token string
+		token, err = web.registrations.Reserve(td.Form.Nickname, td.Form.EMail, td.Form.MlAddr)
+		if err != nil {
+			log.Printf("registration error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Registrierung konnte nicht gespeichert werden",
+			})
+			return
+		}
+		err = web.sendMail(r, td.Form.EMail, core.MailRegistration, core.MailData{
+			Nickname: td.Form.Nickname,
+			Token:    token,
+		})
+		if err != nil {
+			web.registrations.Release(token)
+		}
+	}
 	if err != nil {
-		log.Printf("ldap error: %s", err)
+		log.Printf("mail error: %s", err.Error())
 		td.Messages = append(td.Messages, Message{
-			DANGER,
-			"Member konnte nicht angelegt werden",
+			WARNING,
+			"Bestätigungs-Mail konnte nicht gesendet werden",
 		})
 		return
 	}
 	td.Messages = append(td.Messages, Message{
 		SUCCESS,
 		"Registrierung erfolgreich. " +
-			"Bitte klicke auf den Passwort Link in der soeben gesendeten Mail",
+			"Bitte bestätige deine E-Mail-Adresse über den Link in der soeben gesendeten Mail",
 	},
 	)
+	td.Form = &RegisterForm{}
+	return
+}
+
+// handleConfirm creates the member of a confirmed registration and returns
+// the token for setting the password. Opening the link only shows the
+// registration, mail scanners following it must not use it up.
+func (web *Web) handleConfirm(r *http.Request) (token string, td *ConfirmTemplateData) {
+	td = &ConfirmTemplateData{
+		Messages: []Message{},
+	}
+
+	if r.Method != "POST" {
+		confirmToken := r.URL.Query().Get("t")
+		reg, err := web.registrations.Lookup(confirmToken)
+		if err != nil {
+			log.Printf("registration error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				WARNING,
+				"Der Bestätigungs-Link ist ungültig oder abgelaufen",
+			})
+			return
+		}
+		td.Token = confirmToken
+		td.Nickname = reg.Nickname
+		return
+	}
 
-	err = web.mailer.SendPassword(td.Form.EMail, td.Form.Nickname, token)
+	// the registration is only released once the member exists, so the
+	// link can be used again if ldap fails
+	confirmToken := r.PostFormValue("t")
+	reg, err := web.registrations.Claim(confirmToken)
 	if err != nil {
-		log.Printf("mail error: %s", err.Error())
+		log.Printf("registration error: %s", err)
 		td.Messages = append(td.Messages, Message{
 			WARNING,
-			"Registrierungs-Mail konnte nicht gesendet werden",
+			"Der Bestätigungs-Link ist ungültig oder abgelaufen",
 		})
 		return
 	}
-	td.Form = &RegisterForm{}
-	return
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		web.registrations.Unclaim(confirmToken)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	token, err = ldap.RegisterMember(reg.Nickname, reg.EMail, reg.MlAddr, web.services.Defaults())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		web.registrations.Unclaim(confirmToken)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Member konnte nicht angelegt werden",
+		})
+		return "", td
+	}
+	err = web.registrations.Release(confirmToken)
+	if err != nil {
+		log.Printf("registration error: %s", err)
+	}
+	web.subscribeDefaultLists(reg.MlAddr)
+	return token, td
 }
 
 func (web *Web) handleReset(r *http.Request) (td *ResetTemplateData) {
@@ -147,26 +245,235 @@ func (web *Web) handleReset(r *http.Request) (td *ResetTemplateData) {
 		return
 	}
 
-	token, email, err := ldap.PasswordReset(f.Nickname)
+	// the response must not tell whether a member was found
+	resets, err := ldap.PasswordReset(f.Nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	for _, reset := range resets {
+		err = web.sendThirdPartyMail(r, reset.Email, core.MailPasswordReset, core.MailData{
+			Nickname: reset.Nickname,
+			Token:    reset.Token,
+		})
+		if err != nil {
+			log.Printf("email error: %s", err)
+		}
+	}
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Falls ein passender Account existiert, wurde eine Passwort Mail gesendet",
+	})
+	td.Form = &ResetForm{}
+	return
+}
+
+func (web *Web) handleEmail(r *http.Request) (td *EmailTemplateData) {
+	f, posted, err := parseEmailForm(r)
+	td = &EmailTemplateData{
+		Form:     f,
+		Messages: []Message{},
+	}
+	if !posted {
+		return
+	}
+	if err != nil {
+		td.Messages = append(td.Messages, Message{DANGER, err.Error()})
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
 	if err != nil {
 		log.Printf("ldap error: %s", err)
 		td.Messages = append(td.Messages, Message{
 			DANGER,
-			"Token zum Passwort zurücksetzen konnte nicht gesetzt werden",
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if !web.passwordLimiter.AllowKey(passwordKey(r, f.Nickname)) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Zu viele Versuche, bitte warte einen Moment",
+		})
+		return
+	}
+	nickname, ok, err := ldap.Authenticate(f.Nickname, f.Password)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		f.Password = ""
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Nickname oder Passwort falsch",
 		})
 		return
 	}
 
-	err = web.mailer.SendPassword(email, f.Nickname, token)
+	confirmToken, revertToken, oldEmail, err := ldap.RequestEmailChange(nickname, f.EMail)
 	if err != nil {
-		log.Printf("email error: %s", err)
+		log.Printf("ldap error: %s", err)
 		td.Messages = append(td.Messages, Message{
 			DANGER,
-			"Passwort Mail konnte nicht gesendet werden",
+			"Änderung der E-Mail-Adresse konnte nicht gespeichert werden",
 		})
 		return
 	}
-	td.Messages = append(td.Messages, Message{SUCCESS, "Passwort Mail wurde gesendet"})
-	td.Form = &ResetForm{}
+
+	err = web.sendMail(r, f.EMail, core.MailEmailConfirm, core.MailData{
+		Nickname: nickname,
+		EMail:    f.EMail,
+		Token:    confirmToken,
+	})
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Bestätigungs-Mail konnte nicht gesendet werden",
+		})
+		return
+	}
+	err = web.sendThirdPartyMail(r, oldEmail, core.MailEmailRevert, core.MailData{
+		Nickname: nickname,
+		EMail:    f.EMail,
+		Token:    revertToken,
+	})
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Benachrichtigung an die bisherige Adresse konnte nicht gesendet werden",
+		})
+	}
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Bitte bestätige die neue Adresse über den Link in der soeben gesendeten Mail",
+	})
+	td.Form = &EmailForm{}
+	return
+}
+
+func (web *Web) handleEmailConfirm(r *http.Request) (td *EmailTemplateData) {
+	td = &EmailTemplateData{
+		Form:     &EmailForm{},
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	nickname, oldEmail, email, err := ldap.ConfirmEmailChange(r.URL.Query().Get("t"))
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Der Bestätigungs-Link ist ungültig oder abgelaufen",
+		})
+		return
+	}
+	// members using their own address on the lists follow the change
+	mlAddress, _, err := ldap.MlAddress(nickname)
+	if err == nil && strings.EqualFold(mlAddress, oldEmail) {
+		err = web.moveMlAddress(ldap, nickname, mlAddress, email)
+	}
+	if err != nil {
+		log.Printf("unable to change ml address of %s: %s", nickname, err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Mailinglisten-Adresse konnte nicht geändert werden",
+		})
+	}
+	// the new address is confirmed already, the old one has to learn about it
+	web.sendNotice(r, oldEmail, nickname, fmt.Sprintf("E-Mail-Adresse wurde auf %s geändert", email))
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		fmt.Sprintf("Deine E-Mail-Adresse lautet jetzt %s", email),
+	})
+	return
+}
+
+func (web *Web) handleEmailRevert(r *http.Request) (td *EmailTemplateData) {
+	td = &EmailTemplateData{
+		Form:     &EmailForm{},
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	nickname, replacedEmail, email, err := ldap.RevertEmailChange(r.URL.Query().Get("t"))
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Der Link ist ungültig oder abgelaufen",
+		})
+		return
+	}
+	// whoever changed the address may still be logged in
+	err = web.sessions.DeleteAll(nickname, "")
+	if err != nil {
+		log.Printf("session error: %s", err)
+	}
+	// lists which followed a confirmed change move back as well
+	mlAddress, _, err := ldap.MlAddress(nickname)
+	if err == nil && !strings.EqualFold(replacedEmail, email) &&
+		strings.EqualFold(mlAddress, replacedEmail) {
+		err = web.moveMlAddress(ldap, nickname, mlAddress, email)
+	}
+	if err != nil {
+		log.Printf("unable to change ml address of %s: %s", nickname, err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Mailinglisten-Adresse konnte nicht geändert werden",
+		})
+	}
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		fmt.Sprintf(
+			"Die Änderung wurde rückgängig gemacht, deine E-Mail-Adresse lautet wieder %s. "+
+				"Bitte setze auch dein Passwort zurück.",
+			email,
+		),
+	})
 	return
 }
+
+func (web *Web) handleAvailable(r *http.Request) (res *AvailableResponse, status int) {
+	nickname := r.URL.Query().Get("nickname")
+	res = &AvailableResponse{Nickname: nickname}
+	if !web.availabilityLimiter.Allow(r) {
+		return res, http.StatusTooManyRequests
+	}
+	if len(nickname) < 2 || !nickValid.MatchString(nickname) {
+		return res, http.StatusOK
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return res, http.StatusServiceUnavailable
+	}
+	exists, err := ldap.MemberExists(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return res, http.StatusServiceUnavailable
+	}
+	res.Available = !exists && !web.registrations.Reserved(nickname)
+	return res, http.StatusOK
+}
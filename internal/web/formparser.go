@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/passwordpolicy"
+	"github.com/b4ckspace/members/internal/sshkey"
 )
 
 type (
@@ -20,6 +24,39 @@ type (
 		Error    string
 		ErrorMsg string
 	}
+	EmailForm struct {
+		Nickname string
+		Password string
+		EMail    string
+		Error    string
+		ErrorMsg string
+	}
+	LoginForm struct {
+		Nickname string
+		Password string
+		Next     string
+		Error    string
+		ErrorMsg string
+	}
+	DoorForm struct {
+		Password  string
+		Doorpass  string
+		Doorpass2 string
+		Error     string
+		ErrorMsg  string
+	}
+	BadgeForm struct {
+		BadgeUID string
+		Label    string
+		Error    string
+		ErrorMsg string
+	}
+	SSHKeyForm struct {
+		Key      string
+		Label    string
+		Error    string
+		ErrorMsg string
+	}
 	PasswordForm struct {
 		Password  string
 		Password2 string
@@ -31,6 +68,8 @@ type (
 )
 
 var nickValid = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*[a-zA-Z0-9]$`)
+var badgeValid = regexp.MustCompile(`^([0-9A-F]{8}|[0-9A-F]{14}|[0-9A-F]{20})$`)
+var badgeSeparators = strings.NewReplacer(":", "", " ", "", "-", "")
 var mailValid = regexp.MustCompile("^[a-zA-Z0-9.!#$%&’*+/=?^_`{|}~-]+@[a-zA-Z0-9-]+(?:\\.[a-zA-Z0-9-]+)*$")
 
 func parseRegisterForm(r *http.Request) (f *RegisterForm, posted bool, err error) {
@@ -95,7 +134,43 @@ func parseResetForm(r *http.Request) (f *ResetForm, posted bool, err error) {
 	return
 }
 
-func parsePasswordForm(r *http.Request) (f *PasswordForm, posted bool, err error) {
+func parseEmailForm(r *http.Request) (f *EmailForm, posted bool, err error) {
+	if r.Method != "POST" {
+		return &EmailForm{}, false, nil
+	}
+	posted = true
+
+	f = &EmailForm{
+		Nickname: r.PostFormValue("nickname"),
+		Password: r.PostFormValue("password"),
+		EMail:    r.PostFormValue("email"),
+	}
+	if len(f.Nickname) < 2 {
+		err = fmt.Errorf("%s is to short", f.Nickname)
+		f.Error = "nickname"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	if f.Password == "" {
+		err = errors.New("password missing")
+		f.Error = "password"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	if !mailValid.MatchString(f.EMail) {
+		err = errors.New("invalid email address")
+		f.Error = "email"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	return
+}
+
+func parsePasswordForm(
+	r *http.Request, nickname string, passwordPolicy, doorpassPolicy *passwordpolicy.Policy,
+) (
+	f *PasswordForm, posted bool, err error,
+) {
 	if r.Method != "POST" {
 		return &PasswordForm{}, false, nil
 	}
@@ -107,8 +182,12 @@ func parsePasswordForm(r *http.Request) (f *PasswordForm, posted bool, err error
 		Doorpass:  r.PostFormValue("doorpass"),
 		Doorpass2: r.PostFormValue("doorpass2"),
 	}
-	if len(f.Password) < 8 {
-		err = errors.New("password to short, needs more than eight characters")
+	err = passwordPolicy.Check(passwordpolicy.Input{
+		Password: f.Password,
+		Nickname: nickname,
+	})
+	if err != nil {
+		err = fmt.Errorf("password %s", err)
 		f.Error = "password"
 		f.ErrorMsg = err.Error()
 		return
@@ -120,8 +199,13 @@ func parsePasswordForm(r *http.Request) (f *PasswordForm, posted bool, err error
 		return
 	}
 
-	if len(f.Doorpass) < 8 {
-		err = errors.New("door password to short, needs more than eight characters")
+	err = doorpassPolicy.Check(passwordpolicy.Input{
+		Password:     f.Doorpass,
+		Nickname:     nickname,
+		MainPassword: f.Password,
+	})
+	if err != nil {
+		err = fmt.Errorf("door password %s", err)
 		f.Error = "doorpass"
 		f.ErrorMsg = err.Error()
 		return
@@ -134,3 +218,116 @@ func parsePasswordForm(r *http.Request) (f *PasswordForm, posted bool, err error
 	}
 	return
 }
+
+func parseLoginForm(r *http.Request) (f *LoginForm, posted bool, err error) {
+	if r.Method != "POST" {
+		return &LoginForm{Next: r.URL.Query().Get("next")}, false, nil
+	}
+	posted = true
+
+	f = &LoginForm{
+		Nickname: r.PostFormValue("nickname"),
+		Password: r.PostFormValue("password"),
+		Next:     r.PostFormValue("next"),
+	}
+	if len(f.Nickname) < 2 {
+		err = fmt.Errorf("%s is to short", f.Nickname)
+		f.Error = "nickname"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	if f.Password == "" {
+		err = errors.New("password missing")
+		f.Error = "password"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	return
+}
+
+func parseDoorForm(
+	r *http.Request, nickname string, doorpassPolicy *passwordpolicy.Policy,
+) (
+	f *DoorForm, posted bool, err error,
+) {
+	if r.Method != "POST" {
+		return &DoorForm{}, false, nil
+	}
+	posted = true
+
+	f = &DoorForm{
+		Password:  r.PostFormValue("password"),
+		Doorpass:  r.PostFormValue("doorpass"),
+		Doorpass2: r.PostFormValue("doorpass2"),
+	}
+	if f.Password == "" {
+		err = errors.New("password missing")
+		f.Error = "password"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	err = doorpassPolicy.Check(passwordpolicy.Input{
+		Password:     f.Doorpass,
+		Nickname:     nickname,
+		MainPassword: f.Password,
+	})
+	if err != nil {
+		err = fmt.Errorf("door password %s", err)
+		f.Error = "doorpass"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	if f.Doorpass != f.Doorpass2 {
+		err = errors.New("door passwords do not match")
+		f.Error = "doorpass"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	return
+}
+
+// parseBadgeForm accepts 4, 7 or 10 byte badge uids as hex, with or without
+// separators
+func parseBadgeForm(r *http.Request) (f *BadgeForm, posted bool, err error) {
+	if r.Method != "POST" {
+		return &BadgeForm{}, false, nil
+	}
+	posted = true
+
+	f = &BadgeForm{
+		BadgeUID: strings.ToUpper(badgeSeparators.Replace(r.PostFormValue("badge"))),
+		Label:    strings.TrimSpace(r.PostFormValue("label")),
+	}
+	if !badgeValid.MatchString(f.BadgeUID) {
+		err = errors.New("invalid badge uid")
+		f.Error = "badge"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	if len(f.Label) > 64 {
+		err = errors.New("label to long")
+		f.Error = "label"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	return
+}
+
+func parseSSHKeyForm(r *http.Request) (f *SSHKeyForm, key sshkey.Key, posted bool, err error) {
+	if r.Method != "POST" {
+		return &SSHKeyForm{}, key, false, nil
+	}
+	posted = true
+
+	f = &SSHKeyForm{
+		Key:   r.PostFormValue("key"),
+		Label: r.PostFormValue("label"),
+	}
+	key, err = sshkey.Parse(f.Key, f.Label)
+	if err != nil {
+		f.Error = "key"
+		f.ErrorMsg = err.Error()
+		return
+	}
+	return
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/b4ckspace/members/internal/passwordpolicy"
 )
 
 func TestParseRegisterForm(t *testing.T) {
@@ -75,9 +77,9 @@ func TestParsePasswordForm(t *testing.T) {
 	}{
 		{"GET", "", "", "", "", false, nil},
 		{"POST", "p4ssw0rd", "p4ssw0rd", "p4ssw1rd", "p4ssw1rd", true, nil},
-		{"POST", "p4ss", "p4ss", "p4ssw1rd", "p4ssw1rd", true, errors.New("password to short, needs more than eight characters")},
+		{"POST", "p4ss", "p4ss", "p4ssw1rd", "p4ssw1rd", true, errors.New("password to short, needs at least 8 characters")},
 		{"POST", "p4ssw0rd", "p4ssw0rdx", "p4ssw1rd", "p4ssw1rd", true, errors.New("passwords do not match")},
-		{"POST", "p4ssw0rd", "p4ssw0rd", "p4ss", "p4s", true, errors.New("door password to short, needs more than eight characters")},
+		{"POST", "p4ssw0rd", "p4ssw0rd", "p4ss", "p4s", true, errors.New("door password to short, needs at least 8 characters")},
 		{"POST", "p4ssw0rd", "p4ssw0rd", "p4ssw1rd", "p4ssw1rdx", true, errors.New("door passwords do not match")},
 	}
 	for _, d := range passwordFormData {
@@ -87,7 +89,7 @@ func TestParsePasswordForm(t *testing.T) {
 		))
 		r := httptest.NewRequest(d.method, "/", body)
 		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		f, posted, err := parsePasswordForm(r)
+		f, posted, err := parsePasswordForm(r, "member", passwordpolicy.Default(), passwordpolicy.Default())
 		if posted != d.posted {
 			t.Fatalf("posted is not detected")
 		}
@@ -111,3 +113,64 @@ func TestParsePasswordForm(t *testing.T) {
 
 	}
 }
+
+func TestParsePasswordFormPolicy(t *testing.T) {
+	passwordPolicy := passwordpolicy.New(
+		passwordpolicy.MinLength(8),
+		passwordpolicy.NotNickname(),
+	)
+	doorpassPolicy := passwordpolicy.New(
+		passwordpolicy.MinLength(8),
+		passwordpolicy.DifferentFromMain(),
+	)
+	policyData := []struct {
+		password string
+		doorpass string
+		err      error
+	}{
+		{"p4ssw0rd", "p4ssw1rd", nil},
+		{"xxMeMbErxx", "p4ssw1rd", errors.New("password must not contain the nickname")},
+		{"p4ssw0rd", "p4ssw0rd", errors.New("door password must differ from the password")},
+	}
+	for _, d := range policyData {
+		body := bytes.NewBufferString(fmt.Sprintf(
+			"password=%s&password2=%s&doorpass=%s&doorpass2=%s",
+			d.password, d.password, d.doorpass, d.doorpass,
+		))
+		r := httptest.NewRequest("POST", "/", body)
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		_, _, err := parsePasswordForm(r, "member", passwordPolicy, doorpassPolicy)
+		if (err != nil || d.err != nil) && (err != nil && d.err == nil ||
+			d.err != nil && err == nil ||
+			err.Error() != d.err.Error()) {
+			t.Fatalf("mismatching error:\n  %s\nvs\n  %s", err, d.err)
+		}
+	}
+}
+
+func TestParseBadgeForm(t *testing.T) {
+	badgeFormData := []struct {
+		badge    string
+		badgeUID string
+		err      error
+	}{
+		{"04:a2:3b:1c:5d:80:00", "04A23B1C5D8000", nil},
+		{"DEADBEEF", "DEADBEEF", nil},
+		{"04-A2-3B", "", errors.New("invalid badge uid")},
+		{"xyzxyzxy", "", errors.New("invalid badge uid")},
+	}
+	for _, d := range badgeFormData {
+		body := bytes.NewBufferString(fmt.Sprintf("badge=%s&label=keys", d.badge))
+		r := httptest.NewRequest("POST", "/", body)
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		f, _, err := parseBadgeForm(r)
+		if (err != nil || d.err != nil) && (err != nil && d.err == nil ||
+			d.err != nil && err == nil ||
+			err.Error() != d.err.Error()) {
+			t.Fatalf("mismatching error:\n  %s\nvs\n  %s", err, d.err)
+		}
+		if err == nil && f.BadgeUID != d.badgeUID {
+			t.Fatalf("invalid badge uid: %s %s", f.BadgeUID, d.badgeUID)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestGroups(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+
+	dir := fakeldap.New()
+	for _, nickname := range []string{"member", "owner", "board"} {
+		dir.Seed("uid="+nickname+",ou=member,dc=backspace", map[string][]string{
+			"objectClass": {"backspaceMember"},
+			"uid":         {nickname},
+		})
+	}
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=board,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=laser,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"laser"},
+		"gidNumber":   {"2001"},
+		"owner":       {"uid=owner,ou=member,dc=backspace"},
+	})
+	dir.Seed("cn=door-admin,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"posixGroup"},
+		"cn":          {"door-admin"},
+		"gidNumber":   {"2002"},
+		"owner":       {"uid=owner,ou=member,dc=backspace"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+
+	auditLog := audit.NewMemory()
+	web, err := New(mockMailer, ld, WithAuditLog(auditLog))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	sessions := map[string]string{}
+	for _, nickname := range []string{"member", "owner", "board"} {
+		s, _ := web.sessions.Create(nickname)
+		sessions[nickname] = s.ID
+	}
+
+	do := func(nickname, method, target string, form url.Values) (body string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessions[nickname]})
+		web.GetMux().ServeHTTP(rr, req)
+		b, _ := io.ReadAll(rr.Result().Body)
+		return string(b)
+	}
+
+	// owners manage members, but not the group itself
+	body := do("owner", "POST", "/groups/edit?cn=laser", url.Values{
+		"action": {"add-member"}, "value": {"member"},
+	})
+	if !strings.Contains(body, "member wurde hinzugefügt") {
+		t.Fatalf("owner unable to add member: %s", body)
+	}
+	body = do("owner", "POST", "/groups/edit?cn=laser", url.Values{
+		"action": {"delete"},
+	})
+	if !strings.Contains(body, "Gruppe konnte nicht geändert werden") {
+		t.Fatalf("owner deleted group")
+	}
+	body = do("member", "POST", "/groups/edit?cn=laser", url.Values{
+		"action": {"remove-member"}, "value": {"member"},
+	})
+	if !strings.Contains(body, "Du darfst diese Gruppe nicht verwalten") {
+		t.Fatalf("member changed group")
+	}
+	// role groups grant permissions, owners can't change them
+	body = do("owner", "POST", "/groups/edit?cn=door-admin", url.Values{
+		"action": {"add-member"}, "value": {"member"},
+	})
+	if !strings.Contains(body, "Du darfst diese Gruppe nicht verwalten") {
+		t.Fatalf("owner changed role group")
+	}
+	body = do("owner", "GET", "/groups", nil)
+	if strings.Contains(body, "cn=door-admin") {
+		t.Fatalf("role group listed as managed: %s", body)
+	}
+	body = do("member", "GET", "/groups", nil)
+	if !strings.Contains(body, "<strong>laser</strong>") || strings.Contains(body, "/groups/edit") {
+		t.Fatalf("invalid groups for member: %s", body)
+	}
+
+	// the board creates and renames groups
+	body = do("board", "POST", "/groups", url.Values{
+		"cn": {"server"}, "description": {"Serverraum"},
+	})
+	if !strings.Contains(body, "Gruppe server wurde angelegt") {
+		t.Fatalf("board unable to create group: %s", body)
+	}
+	body = do("board", "POST", "/groups/edit?cn=laser", url.Values{
+		"action": {"rename"}, "value": {"lasercutter"},
+	})
+	if !strings.Contains(body, "Gruppe heißt jetzt lasercutter") {
+		t.Fatalf("board unable to rename group: %s", body)
+	}
+	conn, _ := ld.Dial(context.Background())
+	groups, _ := conn.MemberGroups("member")
+	if len(groups) != 1 || groups[0] != "lasercutter" {
+		t.Fatalf("invalid groups after rename: %v", groups)
+	}
+
+	events, _ := auditLog.Events("group:laser")
+	if len(events) != 2 || events[0].Actor != "owner" || events[1].Action != "group rename" {
+		t.Fatalf("invalid audit events: %+v", events)
+	}
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/authz"
+	"github.com/b4ckspace/members/internal/core"
+)
+
+// Admins with the groups permission manage all groups, owners only the
+// members of their groups. Groups named after a role of the policy are left
+// to admins, an owner could otherwise hand out permissions.
+
+func (web *Web) handleGroups(r *http.Request, nickname string) (td *GroupsTemplateData) {
+	td = &GroupsTemplateData{
+		Nickname: nickname,
+		Admin:    web.permissions(r, nickname)[authz.ManageGroups],
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" && td.Admin {
+		cn := strings.TrimSpace(r.PostFormValue("cn"))
+		if !nickValid.MatchString(cn) {
+			err = fmt.Errorf("invalid group name: %s", cn)
+		} else {
+			_, err = ldap.CreateGroup(cn, strings.TrimSpace(r.PostFormValue("description")))
+		}
+		if err != nil {
+			log.Printf("group error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Gruppe konnte nicht angelegt werden",
+			})
+		} else {
+			web.audit(nickname, "group:"+cn, "group created", "")
+			td.Messages = append(td.Messages, Message{
+				SUCCESS,
+				fmt.Sprintf("Gruppe %s wurde angelegt", cn),
+			})
+		}
+	}
+
+	groups, err := ldap.Groups()
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Gruppen konnten nicht geladen werden",
+		})
+		return
+	}
+	for _, group := range groups {
+		if slices.Contains(group.Members, nickname) {
+			td.MemberOf = append(td.MemberOf, group)
+		}
+		if td.Admin || web.owns(group, nickname) {
+			td.Managed = append(td.Managed, group)
+		}
+	}
+	return
+}
+
+func (web *Web) handleGroup(r *http.Request, nickname string) (td *GroupTemplateData) {
+	td = &GroupTemplateData{
+		Nickname: nickname,
+		Admin:    web.permissions(r, nickname)[authz.ManageGroups],
+		Messages: []Message{},
+	}
+	cn := r.FormValue("cn")
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	td.Group, err = ldap.Group(cn)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Gruppe wurde nicht gefunden",
+		})
+		return
+	}
+	if !td.Admin && !web.owns(td.Group, nickname) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Du darfst diese Gruppe nicht verwalten",
+		})
+		return
+	}
+	td.Found = true
+
+	if r.Method == "POST" {
+		action := r.PostFormValue("action")
+		msg, err := web.changeGroup(ldap, td, action, strings.TrimSpace(r.PostFormValue("value")))
+		if err != nil {
+			log.Printf("group error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Gruppe konnte nicht geändert werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{SUCCESS, msg})
+		}
+		if action == "delete" && err == nil {
+			td.Found = false
+			return
+		}
+		td.Group, err = ldap.Group(td.Group.Name)
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Found = false
+		}
+	}
+	return
+}
+
+var errNotAllowed = errors.New("not allowed")
+
+// owns reports whether nickname may manage the members of group as owner
+func (web *Web) owns(group core.Group, nickname string) bool {
+	return slices.Contains(group.Owners, nickname) && !web.policy.Has(authz.Role(group.Name))
+}
+
+// changeGroup runs a single action on the group of td. Owners may only change
+// members, everything else needs the groups permission.
+func (web *Web) changeGroup(ldap core.LdapWrap, td *GroupTemplateData, action, value string) (msg string, err error) {
+	cn := td.Group.Name
+	switch action {
+	case "add-member":
+		err = ldap.AddGroupMember(cn, value)
+		msg = fmt.Sprintf("%s wurde hinzugefügt", value)
+	case "remove-member":
+		err = ldap.RemoveGroupMember(cn, value)
+		msg = fmt.Sprintf("%s wurde entfernt", value)
+	case "add-owner", "remove-owner", "rename", "delete":
+		if !td.Admin {
+			return "", errNotAllowed
+		}
+		switch action {
+		case "add-owner":
+			err = ldap.AddGroupOwner(cn, value)
+			msg = fmt.Sprintf("%s verwaltet jetzt die Gruppe", value)
+		case "remove-owner":
+			err = ldap.RemoveGroupOwner(cn, value)
+			msg = fmt.Sprintf("%s verwaltet die Gruppe nicht mehr", value)
+		case "rename":
+			if !nickValid.MatchString(value) {
+				return "", fmt.Errorf("invalid group name: %s", value)
+			}
+			err = ldap.RenameGroup(cn, value)
+			msg = fmt.Sprintf("Gruppe heißt jetzt %s", value)
+			td.Group.Name = value
+		case "delete":
+			err = ldap.DeleteGroup(cn)
+			msg = fmt.Sprintf("Gruppe %s wurde gelöscht", cn)
+		}
+	default:
+		return "", fmt.Errorf("invalid action: %s", action)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	web.audit(td.Nickname, "group:"+cn, "group "+action, value)
+	// group names are roles, so every member may have lost or gained one
+	switch action {
+	case "add-member", "remove-member":
+		web.roleCache.Invalidate(value)
+	case "rename", "delete":
+		for _, member := range td.Group.Members {
+			web.roleCache.Invalidate(member)
+		}
+	}
+	return msg, nil
+}
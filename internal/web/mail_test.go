@@ -0,0 +1,133 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/devmode"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/mailer"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestMailPreview(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockSmtp := mocks.NewMockSmtpConn(mockCtrl)
+
+	dir := fakeldap.New()
+	dir.Seed("uid=board,ou=member,dc=backspace", map[string][]string{
+		"objectClass":    {"backspaceMember"},
+		"uid":            {"board"},
+		"alternateEmail": {"board@example.com"},
+	})
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass": {"backspaceMember"},
+		"uid":         {"member"},
+	})
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=board,ou=member,dc=backspace"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+	preview, err := mailer.New(func() (core.SmtpConn, error) { return mockSmtp, nil })
+	if err != nil {
+		t.Fatalf("unable to create mailer: %s", err)
+	}
+
+	web, err := New(mockMailer, ld, WithMailPreview(preview))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	board, _ := web.sessions.Create("board")
+	member, _ := web.sessions.Create("member")
+
+	do := func(method, url, sessionID string) (status int, body string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionID})
+		web.GetMux().ServeHTTP(rr, req)
+		b, _ := io.ReadAll(rr.Result().Body)
+		return rr.Code, string(b)
+	}
+
+	if status, _ := do("GET", "/admin/mails", member.ID); status != http.StatusForbidden {
+		t.Fatalf("preview shown to member: %d", status)
+	}
+	_, body := do("GET", "/admin/mails?template=password_reset&locale=en", board.ID)
+	for _, want := range []string{
+		"Hackerspace Bamberg - Password reset",
+		"password?t=t0k3n",
+		`srcdoc="&lt;!DOCTYPE html&gt;`,
+		"Content-Type: multipart/alternative",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("%q missing in preview: %s", want, body)
+		}
+	}
+
+	// test mails go to the admin through the configured smtp connection
+	mailBody := &closeBuffer{}
+	mockSmtp.EXPECT().StartTLS(gomock.Any())
+	mockSmtp.EXPECT().Mail("register@hackerspace-bamberg.de")
+	mockSmtp.EXPECT().Rcpt("board@example.com")
+	mockSmtp.EXPECT().Data().Return(mailBody, nil)
+	mockSmtp.EXPECT().Close()
+	_, body = do("POST", "/admin/mails?template=security_notice&locale=de", board.ID)
+	if !strings.Contains(body, "Test-Mail wurde an board@example.com gesendet") {
+		t.Fatalf("test mail not sent: %s", body)
+	}
+	if !strings.Contains(mailBody.String(), "Sicherheitshinweis") {
+		t.Fatalf("invalid test mail: %s", mailBody.String())
+	}
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+}
+
+func (b *closeBuffer) Close() error {
+	return nil
+}
+
+func TestDevMailbox(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+
+	mailbox := devmode.NewMailbox()
+	mlr, err := mailer.New(mailbox.ConnFactory())
+	if err != nil {
+		t.Fatalf("unable to create mailer: %s", err)
+	}
+	web, err := New(mlr, mockLdapDailer, WithMailbox(mailbox))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().MemberExists("newbie").Return(false, nil)
+	ok, err := postOk(web, "/register", bytes.NewBufferString(
+		"nickname=newbie&email=newbie@example.com&mladdr=own",
+	), "Registrierung erfolgreich")
+	if err != nil || !ok {
+		t.Fatalf("registration failed: %s", err)
+	}
+
+	rr := httptest.NewRecorder()
+	web.GetMux().ServeHTTP(rr, httptest.NewRequest("GET", "/dev/mailbox", nil))
+	body, _ := io.ReadAll(rr.Result().Body)
+	if !strings.Contains(string(body), "newbie@example.com") || !strings.Contains(string(body), `href="/confirm?t=`) {
+		t.Fatalf("registration mail not in mailbox: %s", body)
+	}
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/b4ckspace/members/internal/mailer"
+)
+
+// handleMailPreview renders a mail template with sample data, posting sends
+// it to the admin's own address
+func (web *Web) handleMailPreview(r *http.Request, nickname string) (td *MailPreviewTemplateData) {
+	qs := r.URL.Query()
+	td = &MailPreviewTemplateData{
+		Nickname: nickname,
+		Template: qs.Get("template"),
+		Locale:   qs.Get("locale"),
+		Messages: []Message{},
+	}
+	var locales []string
+	for _, name := range web.mailPreview.Templates() {
+		t := MailTemplate{Name: name, Locales: web.mailPreview.Locales(name)}
+		td.Templates = append(td.Templates, t)
+		if name == td.Template {
+			locales = t.Locales
+		}
+	}
+	if locales == nil {
+		td.Template = td.Templates[0].Name
+		locales = td.Templates[0].Locales
+	}
+	if !slices.Contains(locales, td.Locale) {
+		td.Locale = mailer.DefaultLocale
+	}
+
+	msg, err := web.mailPreview.Render(td.Template, td.Locale, mailer.Preview)
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			fmt.Sprintf("Vorlage konnte nicht gerendert werden: %s", err),
+		})
+		return
+	}
+	td.Message = msg
+	td.MIME = string(msg.MIME(mailer.Preview.EMail, web.now()))
+	if r.Method != "POST" {
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	_, email, err := ldap.MlAddress(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if email == "" {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Für deinen Account ist keine E-Mail-Adresse hinterlegt",
+		})
+		return
+	}
+	ctx := mailer.WithLocale(r.Context(), td.Locale)
+	err = web.mailPreview.Send(ctx, email, td.Template, mailer.Preview)
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			fmt.Sprintf("Test-Mail konnte nicht gesendet werden: %s", err),
+		})
+		return
+	}
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		fmt.Sprintf("Test-Mail wurde an %s gesendet", email),
+	})
+	return
+}
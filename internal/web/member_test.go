@@ -0,0 +1,827 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/authz"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/membership"
+	"github.com/b4ckspace/members/internal/services"
+	"github.com/b4ckspace/members/internal/session"
+	"github.com/b4ckspace/members/internal/sshkey"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestLogin(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+
+	rr := httptest.NewRecorder()
+	web.GetMux().ServeHTTP(rr, httptest.NewRequest("GET", "/door", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login?next=%2Fdoor" {
+		t.Fatalf("not redirected to login: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// the session belongs to the nickname as stored in ldap
+	mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().Authenticate("MEMBER", "p4ssw0rd").Return("member", true, nil)
+	mockLdapWrap.EXPECT().TOTP("member").Return("", 0, nil)
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(
+		"POST", "/login",
+		strings.NewReader("nickname=MEMBER&password=p4ssw0rd&next=//evil.example.com"),
+	)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	web.GetMux().ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/profile" {
+		t.Fatalf("not redirected to profile: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("invalid session cookie: %+v", cookies)
+	}
+	if s, ok := web.sessions.Get(cookies[0].Value); !ok || s.Nickname != "member" {
+		t.Fatalf("invalid session: %+v", s)
+	}
+
+	web.roleCache.Set("member", []authz.Role{})
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/profile", nil)
+	req.AddCookie(cookies[0])
+	web.GetMux().ServeHTTP(rr, req)
+	body, _ := io.ReadAll(rr.Result().Body)
+	if !strings.Contains(string(body), "member") {
+		t.Fatalf("profile not shown: %s", body)
+	}
+
+	// logging out changes state, a link must not do it
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/logout", nil)
+	req.AddCookie(cookies[0])
+	web.GetMux().ServeHTTP(rr, req)
+	if _, ok := web.sessions.Get(cookies[0].Value); rr.Code != http.StatusMethodNotAllowed || !ok {
+		t.Fatalf("logged out by GET: %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(cookies[0])
+	web.GetMux().ServeHTTP(rr, req)
+	if _, ok := web.sessions.Get(cookies[0].Value); rr.Code != http.StatusSeeOther || ok {
+		t.Fatalf("not logged out: %d", rr.Code)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	web.passwordLimiter = newRateLimiter(1, 2)
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	mockLdapWrap.EXPECT().Authenticate("member", "wrong").Return("", false, nil).Times(3)
+
+	// the limit holds for the nickname from one address, guesses from there
+	// do not lock the member out elsewhere
+	attempts := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:1234", "Nickname oder Passwort falsch"},
+		{"192.0.2.1:1234", "Nickname oder Passwort falsch"},
+		{"192.0.2.1:1234", "Zu viele Versuche"},
+		{"192.0.2.2:1234", "Nickname oder Passwort falsch"},
+	}
+	for _, a := range attempts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", strings.NewReader("nickname=member&password=wrong"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = a.remoteAddr
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !strings.Contains(string(body), a.want) {
+			t.Fatalf("login from %s: missing '%s'", a.remoteAddr, a.want)
+		}
+	}
+}
+
+func TestDoor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	s, err := web.sessions.Create("member")
+	if err != nil {
+		t.Fatalf("unable to create session: %s", err)
+	}
+	cookie := &http.Cookie{Name: sessionCookie, Value: s.ID}
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+
+	doorOpts := []struct {
+		testName string
+		url      string
+		form     string
+		want     string
+	}{{
+		"wrong password",
+		"/door", "password=wrong&doorpass=d00rp4ss&doorpass2=d00rp4ss",
+		"Passwort falsch",
+	}, {
+		"valid",
+		"/door", "password=p4ssw0rd&doorpass=d00rp4ss&doorpass2=d00rp4ss",
+		"Türsystem Passwort wurde aktualisiert",
+	}, {
+		"compromised",
+		"/door/compromised", "",
+		"Dein Türsystem Passwort wurde gesperrt",
+	}}
+	mockLdapWrap.EXPECT().Authenticate("member", "wrong").Return("", false, nil)
+	mockLdapWrap.EXPECT().Authenticate("member", "p4ssw0rd").Return("member", true, nil)
+	mockLdapWrap.EXPECT().SetDoorPassword("member", "d00rp4ss")
+	mockLdapWrap.EXPECT().MlAddress("member").Return("", "member@example.com", nil)
+	mockMailer.EXPECT().Send(gomock.Any(), "member@example.com", core.MailSecurityNotice, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, to, name string, data interface{}) error {
+			notice := data.(core.MailData).Notice
+			if notice.Change != "Türsystem Passwort wurde geändert" || notice.RemoteAddr != "192.0.2.1" || notice.Time.IsZero() {
+				t.Fatalf("invalid security notice: %+v", notice)
+			}
+			return nil
+		},
+	)
+	mockLdapWrap.EXPECT().InvalidateDoorPassword("member")
+	mockMailer.EXPECT().Send(gomock.Any(), "vorstand@hackerspace-bamberg.de", core.MailDoorCompromised, core.MailData{
+		Nickname: "member",
+	})
+	for _, o := range doorOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", o.url, strings.NewReader(o.form))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s, missing: '%s'", o.testName, o.want)
+		}
+	}
+}
+
+func TestBadges(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	member, _ := web.sessions.Create("member")
+	doorAdmin, _ := web.sessions.Create("dooradmin")
+	web.roleCache.Set("member", []authz.Role{})
+	web.roleCache.Set("dooradmin", []authz.Role{authz.DoorAdmin})
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	mockLdapWrap.EXPECT().MlAddress(gomock.Any()).Return("", "member@example.com", nil).AnyTimes()
+	mockMailer.EXPECT().Send(gomock.Any(), "member@example.com", core.MailSecurityNotice, gomock.Any()).AnyTimes()
+
+	keys := core.Badge{ID: "b1", Label: "keys", Created: time.Now()}
+	badgeOpts := []struct {
+		testName string
+		url      string
+		session  string
+		form     string
+		status   int
+		want     string
+		expect   func()
+	}{{
+		"list",
+		"/badges", member.ID, "",
+		http.StatusOK, "keys",
+		func() {
+			mockLdapWrap.EXPECT().Badges("member").Return([]core.Badge{keys}, nil)
+		},
+	}, {
+		"enroll",
+		"/badges", member.ID, "badge=04:a2:3b:1c&label=keys",
+		http.StatusOK, "Badge wurde registriert",
+		func() {
+			mockLdapWrap.EXPECT().AddBadge("member", "04A23B1C", "keys").Return(keys, nil)
+			mockLdapWrap.EXPECT().Badges("member").Return([]core.Badge{keys}, nil)
+		},
+	}, {
+		"invalid uid",
+		"/badges", member.ID, "badge=xyz&label=keys",
+		http.StatusOK, "invalid badge uid",
+		func() {
+			mockLdapWrap.EXPECT().Badges("member").Return(nil, nil)
+		},
+	}, {
+		"already enrolled",
+		"/badges", member.ID, "badge=04:a2:3b:1c&label=keys",
+		http.StatusOK, "Dieser Badge ist bereits registriert",
+		func() {
+			mockLdapWrap.EXPECT().AddBadge("member", "04A23B1C", "keys").Return(core.Badge{}, ldapwrap.ErrBadgeExists)
+			mockLdapWrap.EXPECT().Badges("member").Return([]core.Badge{keys}, nil)
+		},
+	}, {
+		"revoke",
+		"/badges/revoke", member.ID, "id=b1",
+		http.StatusOK, "Badge wurde entfernt",
+		func() {
+			mockLdapWrap.EXPECT().RevokeBadge("member", "b1")
+			mockLdapWrap.EXPECT().Badges("member").Return(nil, nil)
+		},
+	}, {
+		"revoke unknown",
+		"/badges/revoke", member.ID, "id=b2",
+		http.StatusOK, "Badge konnte nicht entfernt werden",
+		func() {
+			mockLdapWrap.EXPECT().RevokeBadge("member", "b2").Return(errors.New("no such badge"))
+			mockLdapWrap.EXPECT().Badges("member").Return([]core.Badge{keys}, nil)
+		},
+	}, {
+		"enroll as member for other",
+		"/admin/badges", member.ID, "nickname=other&badge=04:a2:3b:1c&label=keys",
+		http.StatusForbidden, "forbidden",
+		func() {},
+	}, {
+		"enroll as door admin",
+		"/admin/badges", doorAdmin.ID, "nickname=other&badge=04:a2:3b:1c&label=keys",
+		http.StatusOK, "Badge wurde registriert",
+		func() {
+			mockLdapWrap.EXPECT().AddBadge("other", "04A23B1C", "keys").Return(keys, nil)
+			mockLdapWrap.EXPECT().Badges("other").Return([]core.Badge{keys}, nil)
+		},
+	}}
+	for _, o := range badgeOpts {
+		o.expect()
+		method := "POST"
+		if o.form == "" {
+			method = "GET"
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, o.url, strings.NewReader(o.form))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: o.session})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if rr.Code != o.status || !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s: %d, missing: '%s'", o.testName, rr.Code, o.want)
+		}
+	}
+}
+
+func TestSSHKeys(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	s, _ := web.sessions.Create("member")
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	mockLdapWrap.EXPECT().MlAddress("member").Return("", "member@example.com", nil).AnyTimes()
+	mockMailer.EXPECT().Send(gomock.Any(), "member@example.com", core.MailSecurityNotice, gomock.Any()).AnyTimes()
+
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate rsa key: %s", err)
+	}
+	edLine := authorizedKey(t, edPub, "laptop")
+	key, err := sshkey.Parse(edLine, "")
+	if err != nil {
+		t.Fatalf("unable to parse key: %s", err)
+	}
+
+	sshKeyOpts := []struct {
+		testName string
+		url      string
+		form     url.Values
+		stored   []string
+		want     string
+		expect   func()
+	}{{
+		"add",
+		"/sshkeys", url.Values{"key": {edLine}},
+		nil, "SSH Key wurde hinzugefügt",
+		func() {
+			mockLdapWrap.EXPECT().AddSSHKey("member", edLine)
+		},
+	}, {
+		"duplicate",
+		"/sshkeys", url.Values{"key": {edLine}},
+		[]string{edLine}, "Dieser SSH Key ist bereits hinterlegt",
+		func() {},
+	}, {
+		"invalid key",
+		"/sshkeys", url.Values{"key": {"ssh-ed25519 AAAAnotakey"}},
+		nil, "unable to parse key",
+		func() {},
+	}, {
+		"short rsa key",
+		"/sshkeys", url.Values{"key": {authorizedKey(t, &rsaKey.PublicKey, "")}},
+		nil, "rsa keys need at least",
+		func() {},
+	}, {
+		"delete",
+		"/sshkeys/delete", url.Values{"fingerprint": {key.Fingerprint}},
+		[]string{edLine}, "SSH Key wurde entfernt",
+		func() {
+			mockLdapWrap.EXPECT().DeleteSSHKey("member", edLine)
+		},
+	}, {
+		"delete unknown",
+		"/sshkeys/delete", url.Values{"fingerprint": {"SHA256:unknown"}},
+		[]string{edLine}, "SSH Key nicht gefunden",
+		func() {},
+	}}
+	for _, o := range sshKeyOpts {
+		mockLdapWrap.EXPECT().SSHKeys("member").Return(o.stored, nil)
+		o.expect()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", o.url, strings.NewReader(o.form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.ID})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s, missing: '%s'", o.testName, o.want)
+		}
+	}
+}
+
+func authorizedKey(t *testing.T, key interface{}, comment string) string {
+	pub, err := ssh.NewPublicKey(key)
+	if err != nil {
+		t.Fatalf("unable to create ssh key: %s", err)
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+func TestServices(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	catalog := &services.Catalog{Services: []services.Service{
+		{Name: "wiki", SelfService: true},
+		{Name: "lasercutter", NeedsApproval: true},
+		{Name: "mail"},
+	}}
+	web, err := New(mockMailer, mockLdapDailer, WithServices(catalog))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	member, _ := web.sessions.Create("member")
+	admin, _ := web.sessions.Create("admin")
+	web.roleCache.Set("member", []authz.Role{})
+	web.roleCache.Set("admin", []authz.Role{authz.Board})
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	mockLdapWrap.EXPECT().Services("member").Return([]string{"mail"}, nil, nil).AnyTimes()
+
+	serviceOpts := []struct {
+		testName string
+		url      string
+		session  string
+		form     string
+		status   int
+		want     string
+	}{{
+		"self service",
+		"/services", member.ID, "service=wiki&action=enable",
+		http.StatusOK, "Dienst wurde geändert",
+	}, {
+		"needs approval",
+		"/services", member.ID, "service=lasercutter&action=enable",
+		http.StatusOK, "Dienst wurde geändert",
+	}, {
+		"admin only",
+		"/services", member.ID, "service=mail&action=disable",
+		http.StatusOK, "Dienst konnte nicht geändert werden",
+	}, {
+		"approve as member",
+		"/admin/services", member.ID, "nickname=member&service=lasercutter&action=approve",
+		http.StatusForbidden, "forbidden",
+	}, {
+		"approve as admin",
+		"/admin/services", admin.ID, "nickname=member&service=lasercutter&action=approve",
+		http.StatusOK, "Anfrage von member für lasercutter wurde bearbeitet",
+	}, {
+		"decline as admin",
+		"/admin/services", admin.ID, "nickname=member&service=lasercutter&action=decline",
+		http.StatusOK, "Anfrage von member für lasercutter wurde bearbeitet",
+	}, {
+		"approve unknown service",
+		"/admin/services", admin.ID, "nickname=member&service=rootshell&action=approve",
+		http.StatusOK, "Anfrage konnte nicht bearbeitet werden",
+	}}
+	mockLdapWrap.EXPECT().EnableService("member", "wiki")
+	mockLdapWrap.EXPECT().RequestService("member", "lasercutter")
+	mockLdapWrap.EXPECT().EnableService("member", "lasercutter")
+	mockLdapWrap.EXPECT().DeclineService("member", "lasercutter")
+	mockLdapWrap.EXPECT().ServiceRequests().Times(3)
+	for _, o := range serviceOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", o.url, strings.NewReader(o.form))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: o.session})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if rr.Code != o.status || !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s: %d, missing: '%s'", o.testName, rr.Code, o.want)
+		}
+	}
+}
+
+func TestMailingLists(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	ml := mailinglist.NewFake(
+		core.MailingList{ID: "intern.hackerspace-bamberg.de", Name: "intern"},
+		core.MailingList{ID: "public.hackerspace-bamberg.de", Name: "public"},
+		core.MailingList{ID: "vorstand.hackerspace-bamberg.de", Name: "vorstand"},
+	)
+	err := ml.Subscribe("intern.hackerspace-bamberg.de", "member@example.com")
+	if err != nil {
+		t.Fatalf("unable to subscribe: %s", err)
+	}
+	web, err := New(mockMailer, mockLdapDailer,
+		WithMailingLists(ml),
+		WithSelfServiceLists("intern.hackerspace-bamberg.de", "public.hackerspace-bamberg.de"),
+	)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	s, _ := web.sessions.Create("member")
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	gomock.InOrder(
+		mockLdapWrap.EXPECT().MlAddress("member").Return("member@example.com", "member@example.com", nil).Times(2),
+		mockLdapWrap.EXPECT().SetMlAddress("member", "member@hackerspace-bamberg.de"),
+		mockLdapWrap.EXPECT().MlAddress("member").Return("member@hackerspace-bamberg.de", "member@example.com", nil).Times(2),
+	)
+
+	listOpts := []struct {
+		testName string
+		form     string
+		want     string
+	}{{
+		"subscribe",
+		"action=subscribe&list=public.hackerspace-bamberg.de",
+		"Mailinglisten wurden geändert",
+	}, {
+		"change address",
+		"action=address&mladdr=space",
+		"Mailinglisten wurden geändert",
+	}, {
+		"unknown list",
+		"action=subscribe&list=secret.hackerspace-bamberg.de",
+		"Mailinglisten konnten nicht geändert werden",
+	}, {
+		"not self-service",
+		"action=subscribe&list=vorstand.hackerspace-bamberg.de",
+		"Mailinglisten konnten nicht geändert werden",
+	}}
+	for _, o := range listOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/lists", strings.NewReader(o.form))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.ID})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if rr.Code != http.StatusOK || !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s: %d, missing: '%s'", o.testName, rr.Code, o.want)
+		}
+		if strings.Contains(string(body), "vorstand") {
+			t.Fatalf("list not configured for self-service shown for %s", o.testName)
+		}
+	}
+
+	old, _ := ml.Subscriptions("member@example.com")
+	moved, _ := ml.Subscriptions("member@hackerspace-bamberg.de")
+	if len(old) != 0 || len(moved) != 2 {
+		t.Fatalf("subscriptions not moved: %v %v", old, moved)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	admin, _ := web.sessions.Create("admin")
+	web.roleCache.Set("admin", []authz.Role{authz.Board})
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	mockLdapWrap.EXPECT().Membership("member").Return(membership.Trial, nil, nil).AnyTimes()
+	mockLdapWrap.EXPECT().ChangeMembership(
+		"member",
+		membership.Transition{To: membership.Active, By: "admin", Reason: "trial passed"},
+		web.services.Defaults(),
+	)
+
+	membershipOpts := []struct {
+		testName string
+		form     string
+		want     string
+	}{{
+		"change",
+		"nickname=member&state=active&reason=trial+%0A passed",
+		"member ist jetzt active",
+	}, {
+		"missing reason",
+		"nickname=member&state=left&reason=+",
+		"Status konnte nicht geändert werden",
+	}}
+	for _, o := range membershipOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/admin/membership", strings.NewReader(o.form))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: admin.ID})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if rr.Code != http.StatusOK || !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s: %d, missing: '%s'", o.testName, rr.Code, o.want)
+		}
+	}
+}
+
+func TestOffboard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	auditLog := audit.NewMemory()
+	web, err := New(mockMailer, mockLdapDailer, WithAuditLog(auditLog))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	admin, _ := web.sessions.Create("admin")
+	member, _ := web.sessions.Create("member")
+	web.roleCache.Set("admin", []authz.Role{authz.Board})
+	web.roleCache.Set("member", []authz.Role{authz.DoorAdmin})
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().DisableLogin("member")
+	mockLdapWrap.EXPECT().InvalidateDoorPassword("member")
+	mockLdapWrap.EXPECT().SSHKeys("member")
+	mockLdapWrap.EXPECT().Badges("member")
+	mockLdapWrap.EXPECT().LeaveGroups("member").Return([]string{"door-admin"}, nil)
+	mockLdapWrap.EXPECT().Membership("member").Return(membership.Left, nil, nil)
+	mockLdapWrap.EXPECT().Archive("member", gomock.Any())
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/admin/offboard", strings.NewReader("nickname=member&reason=moved+away"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: admin.ID})
+	web.GetMux().ServeHTTP(rr, req)
+	body, _ := io.ReadAll(rr.Result().Body)
+	if !strings.Contains(string(body), "member wurde archiviert") {
+		t.Fatalf("member not offboarded: %s", body)
+	}
+	events, _ := auditLog.Events("member")
+	if len(events) != 8 {
+		t.Fatalf("steps not recorded: %+v", events)
+	}
+	if _, ok := web.sessions.Get(member.ID); ok {
+		t.Fatalf("session of offboarded member still valid")
+	}
+	if _, ok := web.roleCache.Get("member"); ok {
+		t.Fatalf("roles of offboarded member still cached")
+	}
+}
+
+func TestExport(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	member, _ := web.sessions.Create("member")
+	other, _ := web.sessions.Create("other")
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().MemberData("member").Return(map[string][]string{"uid": {"member"}}, nil)
+	mockLdapWrap.EXPECT().MlAddress("member").Return("member@example.com", "member@example.com", nil)
+	token := ""
+	mockMailer.EXPECT().Send(gomock.Any(), "member@example.com", core.MailDataExport, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, to, name string, data interface{}) error {
+			token = data.(core.MailData).Token
+			return nil
+		},
+	)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/export", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: member.ID})
+	web.GetMux().ServeHTTP(rr, req)
+	body, _ := io.ReadAll(rr.Result().Body)
+	if !strings.Contains(string(body), "Download-Link wurde an deine E-Mail-Adresse geschickt") {
+		t.Fatalf("export not requested: %s", body)
+	}
+
+	downloadOpts := []struct {
+		testName    string
+		session     string
+		contentType string
+	}{
+		{"other member", other.ID, "text/html; charset=utf-8"},
+		{"member", member.ID, "application/zip"},
+	}
+	for _, o := range downloadOpts {
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/export/download?t="+token, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: o.session})
+		web.GetMux().ServeHTTP(rr, req)
+		if rr.Header().Get("Content-Type") != o.contentType {
+			t.Fatalf("invalid download for %s: %s", o.testName, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	admin, _ := web.sessions.Create("admin")
+	web.roleCache.Set("admin", []authz.Role{authz.Board})
+	mockLdapDailer.EXPECT().Dial(gomock.Any()).Return(mockLdapWrap, nil).AnyTimes()
+	entries := []core.DirectoryEntry{{
+		Nickname:       "member",
+		OU:             "member",
+		State:          membership.Active,
+		AlternateEmail: "member@example.com",
+		Services:       []string{"mail", "wiki"},
+	}, {
+		Nickname:       "formula",
+		OU:             "member",
+		State:          membership.Active,
+		AlternateEmail: "=HYPERLINK(\"http://example.com\")@example.com",
+	}}
+	mockLdapWrap.EXPECT().Directory(core.DirectoryQuery{
+		State: membership.Active, Search: "mem", Page: 1, PageSize: directoryPageSize,
+	}).Return(entries, true, nil)
+	mockLdapWrap.EXPECT().Directory(core.DirectoryQuery{
+		State: membership.Active, Search: "mem",
+	}).Return(entries, false, nil).Times(2)
+
+	directoryOpts := []struct {
+		testName string
+		url      string
+		want     string
+	}{{
+		"page",
+		"/admin/members?state=active&q=mem&page=1",
+		"/admin/members?page=2&amp;q=mem&amp;state=active",
+	}, {
+		"csv",
+		"/admin/members?state=active&q=mem&format=csv",
+		"member,member,active,,member@example.com,,mail wiki",
+	}, {
+		"csv formula",
+		"/admin/members?state=active&q=mem&format=csv",
+		`formula,member,active,,"'=HYPERLINK(""http://example.com"")@example.com",,`,
+	}}
+	for _, o := range directoryOpts {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", o.url, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: admin.ID})
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !strings.Contains(string(body), o.want) {
+			t.Fatalf("invalid response for %s, missing '%s': %s", o.testName, o.want, body)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	web.roleCache.Set("member", []authz.Role{})
+	laptop, _ := web.sessions.Start(session.Session{Nickname: "member", UserAgent: "Laptop"})
+	phone, _ := web.sessions.Start(session.Session{Nickname: "member", UserAgent: "Phone"})
+	other, _ := web.sessions.Create("other")
+
+	profile := func(s session.Session, body string) string {
+		rr := httptest.NewRecorder()
+		method := "GET"
+		if body != "" {
+			method = "POST"
+		}
+		req := httptest.NewRequest(method, "/profile", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.ID})
+		web.GetMux().ServeHTTP(rr, req)
+		b, _ := io.ReadAll(rr.Result().Body)
+		return string(b)
+	}
+
+	body := profile(laptop, "")
+	if !strings.Contains(body, "Phone") || !strings.Contains(body, "Laptop") {
+		t.Fatalf("sessions not listed: %s", body)
+	}
+	// keys of other members are ignored
+	profile(laptop, "action=revoke&key="+other.Key)
+	if _, ok := web.sessions.Get(other.ID); !ok {
+		t.Fatalf("session of other member revoked")
+	}
+	profile(laptop, "action=revoke&key="+phone.Key)
+	if _, ok := web.sessions.Get(phone.ID); ok {
+		t.Fatalf("session not revoked")
+	}
+
+	// setting a new password logs out everywhere
+	token, _ := ldapwrap.GenerateToken("member")
+	mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().SetPassword(token, "n3w-p4ssw0rd", "n3w-d00rp4ss")
+	mockLdapWrap.EXPECT().MlAddress("member").Return("", "member@example.com", nil)
+	mockMailer.EXPECT().Send(gomock.Any(), "member@example.com", core.MailSecurityNotice, gomock.Any())
+	ok, err := postOk(web, "/password?t="+token, bytes.NewBufferString(
+		"password=n3w-p4ssw0rd&password2=n3w-p4ssw0rd&doorpass=n3w-d00rp4ss&doorpass2=n3w-d00rp4ss",
+	), "Passwort wurde aktualisiert")
+	if err != nil || !ok {
+		t.Fatalf("unable to set password: %s", err)
+	}
+	if _, ok := web.sessions.Get(laptop.ID); ok {
+		t.Fatalf("session valid after password change")
+	}
+	if _, ok := web.sessions.Get(other.ID); !ok {
+		t.Fatalf("session of other member ended")
+	}
+}
@@ -0,0 +1,765 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/export"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/sshkey"
+)
+
+func (web *Web) handleLogin(r *http.Request) (td *LoginTemplateData, nickname string) {
+	f, posted, err := parseLoginForm(r)
+	td = &LoginTemplateData{
+		Form:     f,
+		Passkeys: web.passkeys != nil,
+		Messages: []Message{},
+	}
+	if !posted {
+		return
+	}
+	if err != nil {
+		td.Messages = append(td.Messages, Message{DANGER, err.Error()})
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if !web.passwordLimiter.AllowKey(passwordKey(r, f.Nickname)) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Zu viele Versuche, bitte warte einen Moment",
+		})
+		return
+	}
+	// only the nickname as stored in ldap is used from here on
+	nickname, ok, err := ldap.Authenticate(f.Nickname, f.Password)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		f.Password = ""
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Nickname oder Passwort falsch",
+		})
+		return
+	}
+
+	secret, _, err := ldap.TOTP(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Login fehlgeschlagen",
+		})
+		return
+	}
+	td.TwoFactor = secret != ""
+	return td, nickname
+}
+
+func (web *Web) handleProfile(r *http.Request, nickname string) (td *ProfileTemplateData) {
+	td = &ProfileTemplateData{
+		Nickname:     nickname,
+		Permissions:  map[string]bool{},
+		MailingLists: web.mailingLists != nil,
+		Passkeys:     web.passkeys != nil,
+		Messages:     []Message{},
+	}
+	// templates can only index with plain strings
+	for permission, ok := range web.permissions(r, nickname) {
+		td.Permissions[string(permission)] = ok
+	}
+	if current, ok := web.currentSession(r); ok {
+		td.CurrentKey = current.Key
+	}
+
+	if r.Method == "POST" {
+		var err error
+		switch r.PostFormValue("action") {
+		case "revoke":
+			err = web.revokeSession(nickname, r.PostFormValue("key"))
+		case "revoke-all":
+			err = web.sessions.DeleteAll(nickname, td.CurrentKey)
+		}
+		if err != nil {
+			log.Printf("session error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Sitzung konnte nicht beendet werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{
+				SUCCESS,
+				"Sitzung wurde beendet",
+			})
+		}
+	}
+
+	sessions, err := web.sessions.List(nickname)
+	if err != nil {
+		log.Printf("session error: %s", err)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	td.Sessions = sessions
+	return
+}
+
+// revokeSession ends a session of the member, keys of other members are
+// ignored
+func (web *Web) revokeSession(nickname, key string) (err error) {
+	sessions, err := web.sessions.List(nickname)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.Key == key {
+			return web.sessions.Revoke(key)
+		}
+	}
+	return fmt.Errorf("session %s not found for %s", key, nickname)
+}
+
+func (web *Web) handleDoor(r *http.Request, nickname string) (td *DoorTemplateData) {
+	f, posted, err := parseDoorForm(r, nickname, web.doorpassPolicy)
+	td = &DoorTemplateData{
+		Nickname: nickname,
+		Form:     f,
+		Messages: []Message{},
+	}
+	if !posted {
+		return
+	}
+	if err != nil {
+		td.Messages = append(td.Messages, Message{DANGER, err.Error()})
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if !web.passwordLimiter.AllowKey(passwordKey(r, nickname)) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Zu viele Versuche, bitte warte einen Moment",
+		})
+		return
+	}
+	_, ok, err := ldap.Authenticate(nickname, f.Password)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		td.Form = &DoorForm{Error: "password"}
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Passwort falsch",
+		})
+		return
+	}
+
+	err = ldap.SetDoorPassword(nickname, f.Doorpass)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Türsystem Passwort konnte nicht gesetzt werden",
+		})
+		return
+	}
+	web.notify(r, ldap, nickname, "Türsystem Passwort wurde geändert")
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Türsystem Passwort wurde aktualisiert",
+	})
+	td.Form = &DoorForm{}
+	return
+}
+
+// handleDoorCompromised disables the door password right away and tells the
+// board about it
+func (web *Web) handleDoorCompromised(r *http.Request, nickname string) (td *DoorTemplateData) {
+	td = &DoorTemplateData{
+		Nickname: nickname,
+		Form:     &DoorForm{},
+		Messages: []Message{},
+	}
+	if r.Method != "POST" {
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	err = ldap.InvalidateDoorPassword(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Türsystem Passwort konnte nicht gesperrt werden",
+		})
+		return
+	}
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Dein Türsystem Passwort wurde gesperrt. Bitte setze ein neues Passwort",
+	})
+
+	err = web.sendThirdPartyMail(r, web.boardMail, core.MailDoorCompromised, core.MailData{
+		Nickname: nickname,
+	})
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Der Vorstand konnte nicht benachrichtigt werden",
+		})
+	}
+	return
+}
+
+// handleBadges enrolls badges for nickname, either by the member or by a
+// door admin given as actor
+func (web *Web) handleBadges(r *http.Request, nickname, actor string) (td *BadgeTemplateData) {
+	f, posted, err := parseBadgeForm(r)
+	td = &BadgeTemplateData{
+		Nickname: nickname,
+		Form:     f,
+		Messages: []Message{},
+	}
+	if posted && err != nil {
+		td.Messages = append(td.Messages, Message{DANGER, err.Error()})
+		posted = false
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if posted {
+		_, err = ldap.AddBadge(nickname, f.BadgeUID, f.Label)
+		if errors.Is(err, ldapwrap.ErrBadgeExists) {
+			td.Messages = append(td.Messages, Message{
+				WARNING,
+				"Dieser Badge ist bereits registriert",
+			})
+		} else if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Badge konnte nicht registriert werden",
+			})
+		} else {
+			web.audit(actor, nickname, "badge enrolled", f.Label)
+			web.notify(r, ldap, nickname, fmt.Sprintf("RFID Badge \"%s\" wurde registriert", f.Label))
+			td.Messages = append(td.Messages, Message{SUCCESS, "Badge wurde registriert"})
+			td.Form = &BadgeForm{}
+		}
+	}
+
+	td.Badges, err = ldap.Badges(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Badges konnten nicht geladen werden",
+		})
+	}
+	return
+}
+
+func (web *Web) handleBadgeRevoke(r *http.Request, nickname string) (td *BadgeTemplateData) {
+	td = &BadgeTemplateData{
+		Nickname: nickname,
+		Form:     &BadgeForm{},
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		err = ldap.RevokeBadge(nickname, r.PostFormValue("id"))
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Badge konnte nicht entfernt werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{SUCCESS, "Badge wurde entfernt"})
+		}
+	}
+
+	td.Badges, err = ldap.Badges(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Badges konnten nicht geladen werden",
+		})
+	}
+	return
+}
+
+func (web *Web) handleSSHKeys(r *http.Request, nickname string) (td *SSHKeyTemplateData) {
+	f, key, posted, err := parseSSHKeyForm(r)
+	td = &SSHKeyTemplateData{
+		Nickname: nickname,
+		Form:     f,
+		Messages: []Message{},
+	}
+	if posted && err != nil {
+		td.Messages = append(td.Messages, Message{DANGER, err.Error()})
+		posted = false
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	td.Keys, err = loadSSHKeys(ldap, nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"SSH Keys konnten nicht geladen werden",
+		})
+		return
+	}
+	if !posted {
+		return
+	}
+
+	for _, existing := range td.Keys {
+		if existing.Fingerprint == key.Fingerprint {
+			td.Messages = append(td.Messages, Message{
+				WARNING,
+				"Dieser SSH Key ist bereits hinterlegt",
+			})
+			return
+		}
+	}
+	err = ldap.AddSSHKey(nickname, key.Line)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"SSH Key konnte nicht hinzugefügt werden",
+		})
+		return
+	}
+	web.notify(r, ldap, nickname, fmt.Sprintf("SSH Key %s wurde hinzugefügt", key.Fingerprint))
+	td.Keys = append(td.Keys, key)
+	td.Messages = append(td.Messages, Message{SUCCESS, "SSH Key wurde hinzugefügt"})
+	td.Form = &SSHKeyForm{}
+	return
+}
+
+func (web *Web) handleSSHKeyDelete(r *http.Request, nickname string) (td *SSHKeyTemplateData) {
+	td = &SSHKeyTemplateData{
+		Nickname: nickname,
+		Form:     &SSHKeyForm{},
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	td.Keys, err = loadSSHKeys(ldap, nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"SSH Keys konnten nicht geladen werden",
+		})
+		return
+	}
+	if r.Method != "POST" {
+		return
+	}
+
+	fingerprint := r.PostFormValue("fingerprint")
+	for i, key := range td.Keys {
+		if key.Fingerprint != fingerprint {
+			continue
+		}
+		err = ldap.DeleteSSHKey(nickname, key.Line)
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"SSH Key konnte nicht entfernt werden",
+			})
+			return
+		}
+		td.Keys = append(td.Keys[:i], td.Keys[i+1:]...)
+		td.Messages = append(td.Messages, Message{SUCCESS, "SSH Key wurde entfernt"})
+		return
+	}
+	td.Messages = append(td.Messages, Message{WARNING, "SSH Key nicht gefunden"})
+	return
+}
+
+// loadSSHKeys parses the stored keys, keys added by admins by hand may not
+// pass the validation and are shown with their raw value only
+func loadSSHKeys(ldap core.LdapWrap, nickname string) (keys []sshkey.Key, err error) {
+	lines, err := ldap.SSHKeys(nickname)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		key, err := sshkey.Parse(line, "")
+		if err != nil {
+			key = sshkey.Key{Type: "unbekannt", Line: line}
+		}
+		key.Line = line
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (web *Web) handleServices(r *http.Request, nickname string) (td *ServicesTemplateData) {
+	td = &ServicesTemplateData{
+		Nickname: nickname,
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		service, ok := web.services.Get(r.PostFormValue("service"))
+		action := r.PostFormValue("action")
+		switch {
+		case !ok:
+			err = fmt.Errorf("unknown service: %s", r.PostFormValue("service"))
+		case action == "enable" && service.NeedsApproval:
+			err = ldap.RequestService(nickname, service.Name)
+		case action == "enable" && service.SelfService:
+			err = ldap.EnableService(nickname, service.Name)
+		case action == "disable" && service.Disableable():
+			err = ldap.DisableService(nickname, service.Name)
+		default:
+			err = fmt.Errorf("action %s not allowed for %s", action, service.Name)
+		}
+		if err != nil {
+			log.Printf("service error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Dienst konnte nicht geändert werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{SUCCESS, "Dienst wurde geändert"})
+		}
+	}
+
+	enabled, requested, err := ldap.Services(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Dienste konnten nicht geladen werden",
+		})
+		return
+	}
+	for _, service := range web.services.Services {
+		td.Services = append(td.Services, ServiceState{
+			Service:   service,
+			Enabled:   slices.Contains(enabled, service.Name),
+			Requested: slices.Contains(requested, service.Name),
+		})
+	}
+	return
+}
+
+func (web *Web) handleMailingLists(r *http.Request, nickname string) (td *MailingListsTemplateData) {
+	td = &MailingListsTemplateData{
+		Nickname:     nickname,
+		SpaceAddress: fmt.Sprintf("%s@hackerspace-bamberg.de", nickname),
+		Messages:     []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	td.MlAddress, td.Email, err = ldap.MlAddress(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Mailinglisten-Adresse konnte nicht geladen werden",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		switch r.PostFormValue("action") {
+		case "address":
+			err = web.changeMlAddress(ldap, td, r.PostFormValue("mladdr"))
+		case "subscribe", "unsubscribe":
+			err = web.changeSubscription(r.PostFormValue("action"), r.PostFormValue("list"), td.MlAddress)
+		default:
+			err = fmt.Errorf("unknown action: %s", r.PostFormValue("action"))
+		}
+		if err != nil {
+			log.Printf("mailing list error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Mailinglisten konnten nicht geändert werden",
+			})
+		} else {
+			td.Messages = append(td.Messages, Message{SUCCESS, "Mailinglisten wurden geändert"})
+		}
+	}
+
+	lists, err := web.mailingLists.Lists()
+	if err != nil {
+		log.Printf("mailing list error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Mailinglisten konnten nicht geladen werden",
+		})
+		return
+	}
+	subscribed, err := web.mailingLists.Subscriptions(td.MlAddress)
+	if err != nil {
+		log.Printf("mailing list error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Mailinglisten konnten nicht geladen werden",
+		})
+		return
+	}
+	for _, list := range lists {
+		if !slices.Contains(web.selfService, list.ID) {
+			continue
+		}
+		td.Lists = append(td.Lists, MailingListState{
+			MailingList: list,
+			Subscribed:  slices.Contains(subscribed, list.ID),
+		})
+	}
+	return
+}
+
+// changeSubscription subscribes or unsubscribes mlAddress, only lists
+// configured for self-service can be changed by members
+func (web *Web) changeSubscription(action, listID, mlAddress string) error {
+	if !slices.Contains(web.selfService, listID) {
+		return fmt.Errorf("list %s is not self-service", listID)
+	}
+	if action == "subscribe" {
+		return web.mailingLists.Subscribe(listID, mlAddress)
+	}
+	return web.mailingLists.Unsubscribe(listID, mlAddress)
+}
+
+// changeMlAddress switches between the own and the space address
+func (web *Web) changeMlAddress(ldap core.LdapWrap, td *MailingListsTemplateData, choice string) (err error) {
+	var mlAddress string
+	switch choice {
+	case "own":
+		mlAddress = td.Email
+	case "space":
+		mlAddress = td.SpaceAddress
+	default:
+		return fmt.Errorf("invalid ml address: %s", choice)
+	}
+	if mlAddress == td.MlAddress {
+		return nil
+	}
+	err = web.moveMlAddress(ldap, td.Nickname, td.MlAddress, mlAddress)
+	if err != nil {
+		return err
+	}
+	td.MlAddress = mlAddress
+	return nil
+}
+
+// moveMlAddress stores the new address in ldap and moves the subscriptions.
+// If the list server fails, ldap is reset to the old address.
+func (web *Web) moveMlAddress(ldap core.LdapWrap, nickname, from, to string) (err error) {
+	err = ldap.SetMlAddress(nickname, to)
+	if err != nil || web.mailingLists == nil {
+		return err
+	}
+	err = mailinglist.Move(web.mailingLists, from, to)
+	if err != nil {
+		resetErr := ldap.SetMlAddress(nickname, from)
+		if resetErr != nil {
+			log.Printf("unable to reset ml address of %s: %s", nickname, resetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (web *Web) subscribeDefaultLists(mlAddress string) {
+	if web.mailingLists == nil {
+		return
+	}
+	for _, listID := range web.defaultLists {
+		err := web.mailingLists.Subscribe(listID, mlAddress)
+		if err != nil {
+			log.Printf("unable to subscribe %s to %s: %s", mlAddress, listID, err)
+		}
+	}
+}
+
+func (web *Web) handleExport(r *http.Request, nickname string) (td *ExportTemplateData) {
+	td = &ExportTemplateData{
+		Nickname: nickname,
+		Messages: []Message{},
+	}
+	if r.Method != "POST" {
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	token, email, err := web.createExport(ldap, nickname)
+	if err != nil {
+		log.Printf("export error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Deine Daten konnten nicht zusammengestellt werden",
+		})
+		return
+	}
+	err = web.sendMail(r, email, core.MailDataExport, core.MailData{
+		Nickname: nickname,
+		Token:    token,
+	})
+	if err != nil {
+		log.Printf("mail error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Mail mit dem Download-Link konnte nicht verschickt werden",
+		})
+		return
+	}
+	web.audit(nickname, nickname, "data export", "")
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Der Download-Link wurde an deine E-Mail-Adresse geschickt",
+	})
+	return
+}
+
+// createExport collects the data of nickname and returns the download token
+// together with the verified address the link has to be sent to
+func (web *Web) createExport(ldap core.LdapWrap, nickname string) (token, email string, err error) {
+	d := export.Data{
+		Generated:    time.Now(),
+		Nickname:     nickname,
+		MailingLists: []string{},
+	}
+	d.Attributes, err = ldap.MemberData(nickname)
+	if err != nil {
+		return "", "", err
+	}
+	mlAddress, email, err := ldap.MlAddress(nickname)
+	if err != nil {
+		return "", "", err
+	}
+	if email == "" {
+		return "", "", errors.New("no verified email address")
+	}
+	if web.mailingLists != nil {
+		d.MailingLists, err = web.mailingLists.Subscriptions(mlAddress)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to load subscriptions: %s", err)
+		}
+	}
+	d.AuditEvents, err = web.auditLog.Events(nickname)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to load audit events: %s", err)
+	}
+
+	archive, err := export.Archive(d)
+	if err != nil {
+		return "", "", err
+	}
+	token, err = web.exports.Put(nickname, archive)
+	return token, email, err
+}
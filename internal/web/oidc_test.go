@@ -0,0 +1,140 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/oidc"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestOIDC(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass":    {"backspaceMember"},
+		"uid":            {"member"},
+		"alternateEmail": {"member@example.com"},
+		"serviceEnabled": {"mail", "wiki"},
+	})
+	dir.Seed("uid=other,ou=member,dc=backspace", map[string][]string{
+		"objectClass":    {"backspaceMember"},
+		"uid":            {"other"},
+		"serviceEnabled": {"mail"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider := oidc.New("https://members.example.com", key, []oidc.Client{{
+		ID:           "wiki",
+		Name:         "Wiki",
+		RedirectURIs: []string{"https://wiki.example.com/callback"},
+		Service:      "wiki",
+	}})
+	web, err := New(mockMailer, ld, WithOIDC(provider))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+
+	do := func(nickname string, req *http.Request) (rr *httptest.ResponseRecorder, body string) {
+		if nickname != "" {
+			s, _ := web.sessions.Create(nickname)
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: s.ID})
+		}
+		rr = httptest.NewRecorder()
+		web.GetMux().ServeHTTP(rr, req)
+		b, _ := io.ReadAll(rr.Result().Body)
+		return rr, string(b)
+	}
+
+	_, body := do("", httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	discovery := oidc.Discovery{}
+	_ = json.Unmarshal([]byte(body), &discovery)
+	if discovery.TokenEndpoint != "https://members.example.com/oidc/token" {
+		t.Fatalf("invalid discovery document: %s", body)
+	}
+
+	verifier := "a-long-random-code-verifier-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := "/oidc/authorize?" + url.Values{
+		"client_id":             {"wiki"},
+		"redirect_uri":          {"https://wiki.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"st4te"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	// members are logged in first
+	rr, _ := do("", httptest.NewRequest("GET", authorize, nil))
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/login?next=%2Foidc%2Fauthorize") {
+		t.Fatalf("not redirected to login: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	rr, _ = do("other", httptest.NewRequest("GET", authorize, nil))
+	if !strings.HasPrefix(rr.Header().Get("Location"), "https://wiki.example.com/callback?error=access_denied") {
+		t.Fatalf("member without service authorized: %s", rr.Header().Get("Location"))
+	}
+	_, body = do("member", httptest.NewRequest("GET", strings.Replace(authorize, "wiki.example.com", "evil.example.com", 1), nil))
+	if !strings.Contains(body, "ungültige Anmelde-Anfrage") {
+		t.Fatalf("unknown redirect uri not rejected: %s", body)
+	}
+	rr, _ = do("member", httptest.NewRequest("GET", authorize, nil))
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	if location.Host != "wiki.example.com" || location.Query().Get("code") == "" {
+		t.Fatalf("no code issued: %s", rr.Header().Get("Location"))
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"wiki"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {"https://wiki.example.com/callback"},
+		"code_verifier": {verifier},
+	}
+	req := httptest.NewRequest("POST", "/oidc/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr, body = do("", req)
+	token := oidc.TokenResponse{}
+	_ = json.Unmarshal([]byte(body), &token)
+	if rr.Code != http.StatusOK || token.AccessToken == "" || token.IDToken == "" {
+		t.Fatalf("unable to redeem code: %d %s", rr.Code, body)
+	}
+
+	userinfo := func() (status int, claims map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/oidc/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		rr, body := do("", req)
+		_ = json.Unmarshal([]byte(body), &claims)
+		return rr.Code, claims
+	}
+	status, claims := userinfo()
+	if status != http.StatusOK || claims["sub"] != "member" || claims["email"] != "member@example.com" {
+		t.Fatalf("invalid userinfo: %d %v", status, claims)
+	}
+
+	// disabling the service locks the member out
+	mod := ldap.NewModifyRequest("uid=member,ou=member,dc=backspace", nil)
+	mod.Delete("serviceEnabled", []string{"wiki"})
+	_ = dir.Modify(mod)
+	if status, _ := userinfo(); status != http.StatusUnauthorized {
+		t.Fatalf("userinfo for disabled service: %d", status)
+	}
+}
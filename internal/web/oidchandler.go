@@ -0,0 +1,132 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/oidc"
+)
+
+// Services of the space log members in through the oidc provider. A client
+// belongs to a service and only members with it in serviceEnabled get a
+// code or userinfo.
+
+func (web *Web) handleAuthorize(r *http.Request, nickname string) (td *OIDCTemplateData, redirect string) {
+	td = &OIDCTemplateData{
+		Nickname: nickname,
+		Messages: []Message{},
+	}
+	req, client, err := web.oidc.ParseAuthRequest(r.URL.Query())
+	var oe *oidc.Error
+	if errors.As(err, &oe) {
+		return td, oidc.ErrorRedirect(req, oe)
+	}
+	if err != nil {
+		log.Printf("oidc error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Ungültige Anmelde-Anfrage",
+		})
+		return
+	}
+	td.Client = client.Name
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	claims, err := web.oidcClaims(ldap, nickname, client.Service)
+	if errors.Is(err, errServiceDisabled) {
+		return td, oidc.ErrorRedirect(req, &oidc.Error{
+			Code:        "access_denied",
+			Description: "service not enabled for member",
+		})
+	}
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Anmeldung fehlgeschlagen",
+		})
+		return
+	}
+	redirect, err = web.oidc.Authorize(req, nickname, claims)
+	if err != nil {
+		log.Printf("oidc error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Anmeldung fehlgeschlagen",
+		})
+		return
+	}
+	return td, redirect
+}
+
+func (web *Web) handleToken(r *http.Request) (res interface{}, status int) {
+	if r.Method != "POST" {
+		return &oidc.Error{Code: "invalid_request"}, http.StatusMethodNotAllowed
+	}
+	token, err := web.oidc.Exchange(r)
+	var oe *oidc.Error
+	if errors.As(err, &oe) {
+		if oe.Code == "invalid_client" {
+			return oe, http.StatusUnauthorized
+		}
+		return oe, http.StatusBadRequest
+	}
+	if err != nil {
+		log.Printf("oidc error: %s", err)
+		return &oidc.Error{Code: "server_error"}, http.StatusInternalServerError
+	}
+	return token, http.StatusOK
+}
+
+// handleUserInfo checks the service again, disabling it locks the member out
+// once the client asks
+func (web *Web) handleUserInfo(r *http.Request) (res interface{}, status int) {
+	grant, err := web.oidc.Token(r)
+	if err != nil {
+		return err, http.StatusUnauthorized
+	}
+	client, ok := web.oidc.Client(grant.ClientID)
+	if !ok {
+		return &oidc.Error{Code: "invalid_token"}, http.StatusUnauthorized
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &oidc.Error{Code: "server_error"}, http.StatusServiceUnavailable
+	}
+	claims, err := web.oidcClaims(ldap, grant.Nickname, client.Service)
+	if errors.Is(err, errServiceDisabled) {
+		return &oidc.Error{Code: "invalid_token", Description: err.Error()}, http.StatusUnauthorized
+	}
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &oidc.Error{Code: "server_error"}, http.StatusServiceUnavailable
+	}
+	return web.oidc.UserInfo(grant, claims), http.StatusOK
+}
+
+var errServiceDisabled = errors.New("service not enabled for member")
+
+func (web *Web) oidcClaims(ldap core.LdapWrap, nickname, service string) (claims oidc.UserClaims, err error) {
+	enabled, _, err := ldap.Services(nickname)
+	if err != nil {
+		return claims, err
+	}
+	if !slices.Contains(enabled, service) {
+		return claims, errServiceDisabled
+	}
+	_, claims.Email, err = ldap.MlAddress(nickname)
+	return claims, err
+}
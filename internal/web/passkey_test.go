@@ -0,0 +1,133 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/fakewebauthn"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/passkey"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestPasskeys(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+
+	dir := fakeldap.New()
+	dir.Seed("uid=member,ou=member,dc=backspace", map[string][]string{
+		"objectClass":  {"backspaceMember"},
+		"uid":          {"member"},
+		"userPassword": {"{SSHA}x"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+	pk, err := passkey.New("members.example.com", "https://members.example.com")
+	if err != nil {
+		t.Fatalf("unable to create passkeys: %s", err)
+	}
+	web, err := New(mockMailer, ld, WithPasskeys(pk))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	web.roleCache.Set("member", nil)
+	authenticator := fakewebauthn.New("https://members.example.com")
+
+	cookies := map[string]string{}
+	do := func(method, target, contentType, body string) (rr *httptest.ResponseRecorder, res string) {
+		rr = httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		web.GetMux().ServeHTTP(rr, req)
+		for _, c := range rr.Result().Cookies() {
+			cookies[c.Name] = c.Value
+		}
+		b, _ := io.ReadAll(rr.Result().Body)
+		return rr, string(b)
+	}
+	ceremony := func(begin, finish string, answer func([]byte) ([]byte, error)) (status int, res PasskeyResponse) {
+		rr, options := do("POST", begin, "application/json", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unable to begin ceremony: %d %s", rr.Code, options)
+		}
+		response, err := answer([]byte(options))
+		if err != nil {
+			t.Fatalf("authenticator failed: %s", err)
+		}
+		rr, body := do("POST", finish, "application/json", string(response))
+		_ = json.Unmarshal([]byte(body), &res)
+		return rr.Code, res
+	}
+
+	// a passkey registered under another spelling still logs in as member
+	s, _ := web.sessions.Create("Member")
+	cookies[sessionCookie] = s.ID
+	status, res := ceremony("/passkeys/register", "/passkeys/register/finish?label=YubiKey", authenticator.Create)
+	if status != http.StatusOK || !res.OK {
+		t.Fatalf("unable to register passkey: %d %+v", status, res)
+	}
+	if _, body := do("GET", "/passkeys", "", ""); !strings.Contains(body, "YubiKey") {
+		t.Fatalf("passkey not listed: %s", body)
+	}
+
+	// log in without password
+	delete(cookies, sessionCookie)
+	status, res = ceremony("/login/passkey", "/login/passkey/finish?next=%2Fdoor", authenticator.Get)
+	if status != http.StatusOK || res.Next != "/door" {
+		t.Fatalf("unable to login with passkey: %d %+v", status, res)
+	}
+	session, ok := web.sessions.Get(cookies[sessionCookie])
+	if !ok || session.Nickname != "member" || !session.SecondFactor {
+		t.Fatalf("invalid session after passkey login: %+v", session)
+	}
+
+	// passkeys don't work once the login is disabled
+	setPassword := func(hash string) {
+		req := ldap.NewModifyRequest("uid=member,ou=member,dc=backspace", nil)
+		req.Replace("userPassword", []string{hash})
+		if err := dir.Modify(req); err != nil {
+			t.Fatalf("unable to set password: %s", err)
+		}
+	}
+	setPassword("-")
+	delete(cookies, sessionCookie)
+	status, _ = ceremony("/login/passkey", "/login/passkey/finish", authenticator.Get)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("passkey accepted for disabled login: %d", status)
+	}
+	setPassword("{SSHA}x")
+	cookies[sessionCookie] = session.ID
+
+	// revoked keys no longer work
+	conn, _ := ld.Dial(context.Background())
+	passkeys, _ := conn.Passkeys("member")
+	if len(passkeys) != 1 || passkeys[0].Credential.Authenticator.SignCount != 1 {
+		t.Fatalf("sign counter not stored: %+v", passkeys)
+	}
+	form := url.Values{"id": {passkeys[0].ID}}
+	if _, body := do("POST", "/passkeys", "application/x-www-form-urlencoded", form.Encode()); !strings.Contains(body, "Passkey wurde entfernt") {
+		t.Fatalf("unable to revoke passkey: %s", body)
+	}
+	delete(cookies, sessionCookie)
+	status, _ = ceremony("/login/passkey", "/login/passkey/finish", authenticator.Get)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("revoked passkey accepted: %d", status)
+	}
+	if _, ok := cookies[sessionCookie]; ok {
+		t.Fatalf("session started with revoked passkey")
+	}
+}
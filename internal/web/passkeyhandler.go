@@ -0,0 +1,182 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/passkey"
+)
+
+const passkeyCookie = "members_passkey"
+
+// The ceremonies are run by web/static/js/passkey.js, which posts the options
+// to the authenticator and its response back as JSON.
+
+func (web *Web) handlePasskeys(r *http.Request, nickname string) (td *PasskeysTemplateData) {
+	td = &PasskeysTemplateData{
+		Nickname: nickname,
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		id := r.PostFormValue("id")
+		err = ldap.RevokePasskey(nickname, id)
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Passkey konnte nicht entfernt werden",
+			})
+		} else {
+			web.audit(nickname, nickname, "passkey revoked", id)
+			td.Messages = append(td.Messages, Message{
+				SUCCESS,
+				"Passkey wurde entfernt",
+			})
+		}
+	}
+
+	td.Passkeys, err = ldap.Passkeys(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Passkeys konnten nicht geladen werden",
+		})
+	}
+	return
+}
+
+func (web *Web) handlePasskeyRegister(w http.ResponseWriter, r *http.Request, nickname string) (res interface{}, status int) {
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	passkeys, err := ldap.Passkeys(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	options, token, err := web.passkeys.BeginRegistration(passkey.User{
+		Nickname: nickname,
+		Passkeys: passkeys,
+	})
+	if err != nil {
+		log.Printf("passkey error: %s", err)
+		return &PasskeyResponse{Error: "webauthn"}, http.StatusInternalServerError
+	}
+	web.setCookie(w, passkeyCookie, token)
+	return options, http.StatusOK
+}
+
+func (web *Web) handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request, nickname string) (res *PasskeyResponse, status int) {
+	label := strings.TrimSpace(r.URL.Query().Get("label"))
+	if len(label) > 64 {
+		label = label[:64]
+	}
+	c, err := r.Cookie(passkeyCookie)
+	if err != nil {
+		return &PasskeyResponse{Error: "ceremony"}, http.StatusBadRequest
+	}
+	web.setCookie(w, passkeyCookie, "")
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	passkeys, err := ldap.Passkeys(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	credential, err := web.passkeys.FinishRegistration(passkey.User{
+		Nickname: nickname,
+		Passkeys: passkeys,
+	}, c.Value, r)
+	if err != nil {
+		log.Printf("passkey error: %s", err)
+		return &PasskeyResponse{Error: "webauthn"}, http.StatusBadRequest
+	}
+	pk, err := ldap.AddPasskey(nickname, label, credential)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	web.audit(nickname, nickname, "passkey registered", pk.ID)
+	web.notify(r, ldap, nickname, fmt.Sprintf("Passkey \"%s\" wurde registriert", pk.Label))
+	return &PasskeyResponse{OK: true, Next: "/passkeys"}, http.StatusOK
+}
+
+func (web *Web) handlePasskeyLogin(w http.ResponseWriter, r *http.Request) (res interface{}, status int) {
+	options, token, err := web.passkeys.BeginLogin()
+	if err != nil {
+		log.Printf("passkey error: %s", err)
+		return &PasskeyResponse{Error: "webauthn"}, http.StatusInternalServerError
+	}
+	web.setCookie(w, passkeyCookie, token)
+	return options, http.StatusOK
+}
+
+// handlePasskeyLoginFinish logs the member in. The authenticator verified the
+// member, so the login counts as two-factor.
+func (web *Web) handlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) (res *PasskeyResponse, status int) {
+	c, err := r.Cookie(passkeyCookie)
+	if err != nil {
+		return &PasskeyResponse{Error: "ceremony"}, http.StatusBadRequest
+	}
+	web.setCookie(w, passkeyCookie, "")
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	// the user handle stays as registered, the session gets the nickname as
+	// stored in ldap
+	var nickname string
+	lookup := func(handle string) (user passkey.User, err error) {
+		var enabled bool
+		nickname, enabled, err = ldap.LoginEnabled(handle)
+		if err != nil {
+			return user, err
+		}
+		if !enabled {
+			return user, fmt.Errorf("login of %s is disabled", handle)
+		}
+		passkeys, err := ldap.Passkeys(handle)
+		if err != nil {
+			return user, err
+		}
+		return passkey.User{Nickname: handle, Passkeys: passkeys}, nil
+	}
+	_, credential, err := web.passkeys.FinishLogin(c.Value, r, lookup)
+	if err != nil {
+		log.Printf("passkey error: %s", err)
+		return &PasskeyResponse{Error: "webauthn"}, http.StatusUnauthorized
+	}
+	err = ldap.UpdatePasskey(nickname, credential)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		return &PasskeyResponse{Error: "ldap"}, http.StatusServiceUnavailable
+	}
+	err = web.startSession(w, r, nickname, true)
+	if err != nil {
+		log.Printf("session error: %s", err)
+		return &PasskeyResponse{Error: "session"}, http.StatusInternalServerError
+	}
+	return &PasskeyResponse{OK: true, Next: redirectTarget(r.URL.Query().Get("next"))}, http.StatusOK
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// rateLimiter is a token bucket per client address or other key, e.g.
+	// the nickname
+	rateLimiter struct {
+		rate  float64
+		burst float64
+		now   func() time.Time
+
+		m       sync.Mutex
+		buckets map[string]*bucket
+	}
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (rl *rateLimiter) Allow(r *http.Request) bool {
+	return rl.AllowKey(clientAddr(r))
+}
+
+func (rl *rateLimiter) AllowKey(key string) bool {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rl.rate
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.last = now
+
+	// forget full buckets to keep the map small
+	for k, other := range rl.buckets {
+		if k != key && now.Sub(other.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, k)
+		}
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// passwordKey limits password guesses per nickname and client address, so
+// guesses from one address cannot lock the member out everywhere
+func passwordKey(r *http.Request, nickname string) string {
+	return strings.ToLower(nickname) + " " + clientAddr(r)
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
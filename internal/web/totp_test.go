@@ -0,0 +1,172 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/fakeldap"
+	"github.com/b4ckspace/members/internal/ldapwrap"
+	"github.com/b4ckspace/members/internal/ssha"
+	"github.com/b4ckspace/members/internal/totp"
+	"github.com/b4ckspace/members/mocks"
+)
+
+func TestTOTP(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+
+	dir := fakeldap.New()
+	hash, _ := ssha.Hash("p4ssw0rd", ssha.SSHA)
+	dir.Seed("uid=board,ou=member,dc=backspace", map[string][]string{
+		"objectClass":  {"backspaceMember"},
+		"uid":          {"board"},
+		"userPassword": {hash},
+	})
+	dir.Seed("cn=board,ou=groups,dc=backspace", map[string][]string{
+		"objectClass": {"groupOfNames"},
+		"cn":          {"board"},
+		"member":      {"uid=board,ou=member,dc=backspace"},
+	})
+	ld, _ := ldapwrap.New(func() (core.LdapConn, error) { return dir, nil })
+
+	web, err := New(mockMailer, ld, WithTwoFactorEnforcement())
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	web.now = func() time.Time { return now }
+	web.twoFactorLimiter.now = web.now
+
+	cookies := map[string]string{}
+	do := func(method, target string, form url.Values) (rr *httptest.ResponseRecorder, body string) {
+		rr = httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		web.GetMux().ServeHTTP(rr, req)
+		for _, c := range rr.Result().Cookies() {
+			cookies[c.Name] = c.Value
+		}
+		b, _ := io.ReadAll(rr.Result().Body)
+		return rr, string(b)
+	}
+	// logging in as BOARD ends up with the nickname stored in ldap
+	login := func() {
+		rr, _ := do("POST", "/login", url.Values{
+			"nickname": {"BOARD"}, "password": {"p4ssw0rd"}, "next": {"/admin/membership"},
+		})
+		if rr.Code != http.StatusSeeOther {
+			t.Fatalf("login failed: %d", rr.Code)
+		}
+	}
+
+	// admins without a second factor are sent to the enrollment
+	login()
+	rr, _ := do("GET", "/admin/membership", nil)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/totp?next=%2Fadmin%2Fmembership" {
+		t.Fatalf("not redirected to enrollment: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	_, body := do("GET", "/totp", nil)
+	m := regexp.MustCompile(`name="secret" value="([A-Z2-7]+)"`).FindStringSubmatch(body)
+	if m == nil || !strings.Contains(body, "data:image/png;base64,") {
+		t.Fatalf("enrollment not shown: %s", body)
+	}
+	secret := m[1]
+	_, body = do("POST", "/totp", url.Values{
+		"action": {"enable"}, "secret": {secret}, "code": {"000000"},
+	})
+	if !strings.Contains(body, "Code ungültig") {
+		t.Fatalf("invalid code accepted")
+	}
+	code, _ := totp.Code(secret, now)
+	_, body = do("POST", "/totp", url.Values{
+		"action": {"enable"}, "secret": {secret}, "code": {code},
+	})
+	recoveryCodes := regexp.MustCompile(`<li>([a-z2-7]{5}-[a-z2-7]{5})</li>`).FindAllStringSubmatch(body, -1)
+	if len(recoveryCodes) != totpRecoveryCodes {
+		t.Fatalf("recovery codes not shown: %s", body)
+	}
+	if rr, _ := do("GET", "/admin/membership", nil); rr.Code != http.StatusOK {
+		t.Fatalf("enrolled session not allowed: %d", rr.Code)
+	}
+	if _, body = do("POST", "/totp", url.Values{"action": {"disable"}, "code": {code}}); !strings.Contains(body, "nicht deaktiviert werden") {
+		t.Fatalf("admin disabled second factor")
+	}
+
+	// the password alone does not log in anymore
+	do("POST", "/logout", nil)
+	login()
+	rr, _ = do("GET", "/admin/membership", nil)
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/login?") {
+		t.Fatalf("logged in without second factor: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	now = now.Add(5 * totp.Period)
+	_, body = do("POST", "/login/totp", url.Values{"code": {code}})
+	if !strings.Contains(body, "Code ungültig") {
+		t.Fatalf("expired code accepted")
+	}
+	code, _ = totp.Code(secret, now)
+	rr, _ = do("POST", "/login/totp", url.Values{"code": {code}, "next": {"/admin/membership"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/membership" {
+		t.Fatalf("login not confirmed: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr, _ := do("GET", "/admin/membership", nil); rr.Code != http.StatusOK {
+		t.Fatalf("confirmed session not allowed: %d", rr.Code)
+	}
+	if s, _ := web.sessions.Get(cookies[sessionCookie]); s.Nickname != "board" {
+		t.Fatalf("session not bound to ldap nickname: %+v", s)
+	}
+
+	// a code works only once
+	do("GET", "/logout", nil)
+	login()
+	_, body = do("POST", "/login/totp", url.Values{"code": {code}})
+	if !strings.Contains(body, "Code ungültig") {
+		t.Fatalf("used code accepted again")
+	}
+
+	// the pending login ends after too many wrong codes, the reused code
+	// counts as well
+	for i := 2; i < totpMaxFailures; i++ {
+		do("POST", "/login/totp", url.Values{"code": {"000000"}})
+	}
+	if _, body = do("POST", "/login/totp", url.Values{"code": {"000000"}}); !strings.Contains(body, "bitte melde dich erneut an") {
+		t.Fatalf("pending login not ended: %s", body)
+	}
+	now = now.Add(totp.Period)
+	code, _ = totp.Code(secret, now)
+	rr, _ = do("POST", "/login/totp", url.Values{"code": {code}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login" {
+		t.Fatalf("ended login confirmed: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// recovery codes work exactly once
+	now = now.Add(time.Minute)
+	recoveryCode := strings.ToUpper(recoveryCodes[0][1])
+	for i, status := range []int{http.StatusSeeOther, http.StatusOK} {
+		do("POST", "/logout", nil)
+		login()
+		rr, _ = do("POST", "/login/totp", url.Values{"code": {recoveryCode}})
+		if rr.Code != status {
+			t.Fatalf("invalid status for recovery code use %d: %d", i, rr.Code)
+		}
+	}
+	conn, _ := ld.Dial(context.Background())
+	_, left, _ := conn.TOTP("board")
+	if left != totpRecoveryCodes-1 {
+		t.Fatalf("used recovery code not removed: %d", left)
+	}
+}
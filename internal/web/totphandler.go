@@ -0,0 +1,285 @@
+package web
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/totp"
+)
+
+const (
+	totpIssuer          = "backspace"
+	totpRecoveryCodes   = 10
+	totpRecoveryCodeLen = 11
+	// a pending login is dropped after this many wrong codes, the password
+	// has to be entered again
+	totpMaxFailures = 3
+)
+
+func (web *Web) handleTwoFactorLogin(r *http.Request, nickname string) (td *TwoFactorLoginTemplateData, confirmed bool) {
+	td = &TwoFactorLoginTemplateData{
+		Next:     r.FormValue("next"),
+		Messages: []Message{},
+	}
+	if r.Method != "POST" {
+		return
+	}
+	if !web.twoFactorLimiter.AllowKey(strings.ToLower(nickname)) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Zu viele Versuche, bitte warte einen Moment",
+		})
+		return
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	ok, err := web.verifySecondFactor(ldap, nickname, r.PostFormValue("code"))
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		c, err := r.Cookie(twoFactorCookie)
+		if err == nil && web.twoFactorLogins.AddFailure(c.Value) >= totpMaxFailures {
+			web.twoFactorLogins.Delete(c.Value)
+			td.Messages = append(td.Messages, Message{
+				WARNING,
+				"Zu viele ungültige Codes, bitte melde dich erneut an",
+			})
+			return
+		}
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Code ungültig",
+		})
+		return
+	}
+	return td, true
+}
+
+// verifySecondFactor accepts the current one-time password or an unused
+// recovery code
+func (web *Web) verifySecondFactor(ldap core.LdapWrap, nickname, code string) (ok bool, err error) {
+	secret, _, err := ldap.TOTP(nickname)
+	if err != nil || secret == "" {
+		return false, err
+	}
+	if _, ok := totp.Match(secret, code, web.now()); ok {
+		return web.useTOTP(ldap, nickname, secret, code)
+	}
+	code = totp.NormalizeRecoveryCode(code)
+	if len(code) != totpRecoveryCodeLen {
+		return false, nil
+	}
+	ok, err = ldap.UseRecoveryCode(nickname, code)
+	if ok {
+		web.audit(nickname, nickname, "totp recovery code used", "")
+	}
+	return ok, err
+}
+
+// useTOTP accepts every one-time password only once, a code seen by
+// someone else can't be replayed within its period
+func (web *Web) useTOTP(ldap core.LdapWrap, nickname, secret, code string) (ok bool, err error) {
+	counter, ok := totp.Match(secret, code, web.now())
+	if !ok {
+		return false, nil
+	}
+	return ldap.UseTOTP(nickname, counter)
+}
+
+func (web *Web) handleTOTP(r *http.Request, nickname string) (td *TOTPTemplateData) {
+	td = &TOTPTemplateData{
+		Nickname: nickname,
+		Required: web.twoFactorRequired(r, nickname),
+		Next:     r.FormValue("next"),
+		Messages: []Message{},
+	}
+
+	ldap, err := web.ldapDialer.Dial(r.Context())
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Verbindung zum LDAP Server nicht möglich",
+		})
+		return
+	}
+	secret, recoveryLeft, err := ldap.TOTP(nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Zwei-Faktor-Status konnte nicht geladen werden",
+		})
+		return
+	}
+	td.Enabled = secret != ""
+	td.RecoveryLeft = recoveryLeft
+
+	if r.Method == "POST" {
+		switch r.PostFormValue("action") {
+		case "enable":
+			web.enableTOTP(r, ldap, td)
+		case "recovery":
+			web.renewRecoveryCodes(r, ldap, td, secret)
+		case "disable":
+			web.disableTOTP(r, ldap, td)
+		}
+	}
+
+	if !td.Enabled && td.Secret == "" {
+		td.Secret, err = totp.GenerateSecret()
+		if err != nil {
+			log.Printf("totp error: %s", err)
+			return
+		}
+	}
+	if !td.Enabled {
+		png, err := totp.QRCode(totp.URI(td.Secret, totpIssuer, nickname))
+		if err != nil {
+			log.Printf("totp error: %s", err)
+			return
+		}
+		td.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+	if td.Required && !td.Enabled {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Für Admin-Funktionen ist eine Zwei-Faktor-Anmeldung nötig",
+		})
+	}
+	return
+}
+
+func (web *Web) enableTOTP(r *http.Request, ldap core.LdapWrap, td *TOTPTemplateData) {
+	td.Secret = strings.TrimSpace(r.PostFormValue("secret"))
+	if td.Enabled {
+		return
+	}
+	if !totp.Verify(td.Secret, r.PostFormValue("code"), web.now()) {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Code ungültig, prüfe die Uhrzeit deines Geräts",
+		})
+		return
+	}
+	codes, err := totp.RecoveryCodes(totpRecoveryCodes)
+	if err == nil {
+		err = ldap.EnableTOTP(td.Nickname, td.Secret, codes)
+	}
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Zwei-Faktor-Anmeldung konnte nicht aktiviert werden",
+		})
+		return
+	}
+	// the enrollment code can't be used for a login afterwards
+	counter, _ := totp.Match(td.Secret, r.PostFormValue("code"), web.now())
+	_, err = ldap.UseTOTP(td.Nickname, counter)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	web.audit(td.Nickname, td.Nickname, "totp enabled", "")
+	web.notify(r, ldap, td.Nickname, "Zwei-Faktor-Anmeldung wurde aktiviert")
+	// the code just entered confirms the current session as well
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		web.sessions.SetSecondFactor(c.Value)
+	}
+	td.Enabled = true
+	td.Secret = ""
+	td.RecoveryCodes = codes
+	td.RecoveryLeft = len(codes)
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Zwei-Faktor-Anmeldung wurde aktiviert",
+	})
+}
+
+func (web *Web) renewRecoveryCodes(r *http.Request, ldap core.LdapWrap, td *TOTPTemplateData, secret string) {
+	if !td.Enabled {
+		return
+	}
+	ok, err := web.useTOTP(ldap, td.Nickname, secret, r.PostFormValue("code"))
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Code ungültig",
+		})
+		return
+	}
+	codes, err := totp.RecoveryCodes(totpRecoveryCodes)
+	if err == nil {
+		err = ldap.EnableTOTP(td.Nickname, secret, codes)
+	}
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Wiederherstellungscodes konnten nicht erneuert werden",
+		})
+		return
+	}
+	web.audit(td.Nickname, td.Nickname, "totp recovery codes renewed", "")
+	web.notify(r, ldap, td.Nickname, "Wiederherstellungscodes wurden erneuert")
+	td.RecoveryCodes = codes
+	td.RecoveryLeft = len(codes)
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Neue Wiederherstellungscodes wurden erstellt",
+	})
+}
+
+func (web *Web) disableTOTP(r *http.Request, ldap core.LdapWrap, td *TOTPTemplateData) {
+	if td.Required {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Mit Admin-Rechten kann die Zwei-Faktor-Anmeldung nicht deaktiviert werden",
+		})
+		return
+	}
+	ok, err := web.verifySecondFactor(ldap, td.Nickname, r.PostFormValue("code"))
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+	}
+	if !ok {
+		td.Messages = append(td.Messages, Message{
+			WARNING,
+			"Code ungültig",
+		})
+		return
+	}
+	err = ldap.DisableTOTP(td.Nickname)
+	if err != nil {
+		log.Printf("ldap error: %s", err)
+		td.Messages = append(td.Messages, Message{
+			DANGER,
+			"Zwei-Faktor-Anmeldung konnte nicht deaktiviert werden",
+		})
+		return
+	}
+	web.audit(td.Nickname, td.Nickname, "totp disabled", "")
+	web.notify(r, ldap, td.Nickname, "Zwei-Faktor-Anmeldung wurde deaktiviert")
+	td.Enabled = false
+	td.RecoveryLeft = 0
+	td.Messages = append(td.Messages, Message{
+		SUCCESS,
+		"Zwei-Faktor-Anmeldung wurde deaktiviert",
+	})
+}
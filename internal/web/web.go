@@ -1,14 +1,31 @@
 package web
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/authz"
 	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/export"
+	"github.com/b4ckspace/members/internal/mailer"
+	"github.com/b4ckspace/members/internal/membership"
+	"github.com/b4ckspace/members/internal/offboarding"
+	"github.com/b4ckspace/members/internal/oidc"
+	"github.com/b4ckspace/members/internal/passkey"
+	"github.com/b4ckspace/members/internal/passwordpolicy"
+	"github.com/b4ckspace/members/internal/pending"
+	"github.com/b4ckspace/members/internal/services"
+	"github.com/b4ckspace/members/internal/session"
+	"github.com/b4ckspace/members/internal/sshkey"
 	"github.com/b4ckspace/members/internal/statics"
 	_ "github.com/b4ckspace/members/statik"
 )
@@ -26,7 +43,43 @@ type (
 		ldapDialer core.LdapDialer
 		templates  map[string]*template.Template
 		statics    http.FileSystem
+
+		passwordPolicy *passwordpolicy.Policy
+		doorpassPolicy *passwordpolicy.Policy
+		registrations  *pending.Registrations
+
+		enumerationProtection bool
+		minResponseTime       time.Duration
+		availabilityLimiter   *rateLimiter
+		passwordLimiter       *rateLimiter
+
+		sessions      *session.Store
+		secureCookies bool
+		boardMail     string
+
+		twoFactorLogins  *session.Store
+		twoFactorLimiter *rateLimiter
+		enforceTwoFactor bool
+		now              func() time.Time
+		passkeys         *passkey.Manager
+		oidc             *oidc.Provider
+		mailPreview      *mailer.Mailer
+		mailbox          core.Mailbox
+
+		services  *services.Catalog
+		policy    authz.Policy
+		roleCache *authz.Cache
+
+		mailingLists core.MailingLists
+		defaultLists []string
+		selfService  []string
+
+		auditLog   core.AuditLog
+		retention  time.Duration
+		offboarder *offboarding.Offboarder
+		exports    *export.Store
 	}
+	Option      func(web *Web)
 	MessageKind string
 	Message     struct {
 		Kind    MessageKind
@@ -45,9 +98,172 @@ type (
 		Form     *PasswordForm
 		Messages []Message
 	}
+	EmailTemplateData struct {
+		Form     *EmailForm
+		Messages []Message
+	}
+	ConfirmTemplateData struct {
+		Token    string
+		Nickname string
+		Messages []Message
+	}
+
+	LoginTemplateData struct {
+		Form      *LoginForm
+		TwoFactor bool
+		Passkeys  bool
+		Messages  []Message
+	}
+	TwoFactorLoginTemplateData struct {
+		Next     string
+		Messages []Message
+	}
+	TOTPTemplateData struct {
+		Nickname      string
+		Enabled       bool
+		Required      bool
+		Next          string
+		Secret        string
+		QRCode        template.URL
+		RecoveryCodes []string
+		RecoveryLeft  int
+		Messages      []Message
+	}
+	ProfileTemplateData struct {
+		Nickname     string
+		Permissions  map[string]bool
+		MailingLists bool
+		Passkeys     bool
+		Sessions     []session.Session
+		CurrentKey   string
+		Messages     []Message
+	}
+	DoorTemplateData struct {
+		Nickname string
+		Form     *DoorForm
+		Messages []Message
+	}
+
+	BadgeTemplateData struct {
+		Nickname string
+		Admin    bool
+		Form     *BadgeForm
+		Badges   []core.Badge
+		Messages []Message
+	}
+
+	PasskeysTemplateData struct {
+		Nickname string
+		Passkeys []core.Passkey
+		Messages []Message
+	}
+
+	SSHKeyTemplateData struct {
+		Nickname string
+		Form     *SSHKeyForm
+		Keys     []sshkey.Key
+		Messages []Message
+	}
+
+	ServicesTemplateData struct {
+		Nickname string
+		Services []ServiceState
+		Messages []Message
+	}
+	ServiceState struct {
+		services.Service
+		Enabled   bool
+		Requested bool
+	}
+	MailingListsTemplateData struct {
+		Nickname     string
+		MlAddress    string
+		Email        string
+		SpaceAddress string
+		Lists        []MailingListState
+		Messages     []Message
+	}
+	MailingListState struct {
+		core.MailingList
+		Subscribed bool
+	}
+	ServiceRequestsTemplateData struct {
+		Requests []core.ServiceRequest
+		Messages []Message
+	}
+	ExportTemplateData struct {
+		Nickname string
+		Messages []Message
+	}
+	DirectoryTemplateData struct {
+		Query    core.DirectoryQuery
+		OUs      []string
+		Services []services.Service
+		States   []membership.State
+		Entries  []core.DirectoryEntry
+		More     bool
+		PrevURL  string
+		NextURL  string
+		CSVURL   string
+		JSONURL  string
+		Messages []Message
+	}
+	GroupsTemplateData struct {
+		Nickname string
+		Admin    bool
+		MemberOf []core.Group
+		Managed  []core.Group
+		Messages []Message
+	}
+	GroupTemplateData struct {
+		Nickname string
+		Admin    bool
+		Found    bool
+		Group    core.Group
+		Messages []Message
+	}
+	MembershipTemplateData struct {
+		Nickname    string
+		Found       bool
+		State       membership.State
+		Transitions []membership.Transition
+		Messages    []Message
+	}
+
+	OIDCTemplateData struct {
+		Nickname string
+		Client   string
+		Messages []Message
+	}
+	MailPreviewTemplateData struct {
+		Nickname  string
+		Templates []MailTemplate
+		Template  string
+		Locale    string
+		Message   mailer.Message
+		MIME      string
+		Messages  []Message
+	}
+	MailTemplate struct {
+		Name    string
+		Locales []string
+	}
+	MailboxTemplateData struct {
+		Mails    []core.CapturedMail
+		Messages []Message
+	}
+	PasskeyResponse struct {
+		OK    bool   `json:"ok"`
+		Next  string `json:"next,omitempty"`
+		Error string `json:"error,omitempty"`
+	}
+	AvailableResponse struct {
+		Nickname  string `json:"nickname"`
+		Available bool   `json:"available"`
+	}
 )
 
-func New(mailer core.Mailer, ld core.LdapDialer) (web *Web, err error) {
+func New(mailer core.Mailer, ld core.LdapDialer, opts ...Option) (web *Web, err error) {
 	mux := http.NewServeMux()
 	web = &Web{
 		mailer:     mailer,
@@ -55,8 +271,43 @@ func New(mailer core.Mailer, ld core.LdapDialer) (web *Web, err error) {
 		ldapDialer: ld,
 		templates:  map[string]*template.Template{},
 		statics:    statics.MustStatics(),
+
+		passwordPolicy: passwordpolicy.Default(),
+		doorpassPolicy: passwordpolicy.Default(),
+		registrations:  pending.NewRegistrations(24 * time.Hour),
+
+		availabilityLimiter: newRateLimiter(10, 5),
+		passwordLimiter:     newRateLimiter(5, 10),
+
+		sessions:      session.NewStore(session.NewMemory(), time.Hour, 7*24*time.Hour),
+		secureCookies: true,
+		boardMail:     "vorstand@hackerspace-bamberg.de",
+
+		twoFactorLogins:  session.NewStore(session.NewMemory(), 5*time.Minute, 5*time.Minute),
+		twoFactorLimiter: newRateLimiter(5, 5),
+		now:              time.Now,
+
+		services:  services.Default(),
+		policy:    authz.DefaultPolicy(),
+		roleCache: authz.NewCache(5 * time.Minute),
+
+		auditLog:  audit.NewMemory(),
+		retention: 2 * 365 * 24 * time.Hour,
+		exports:   export.NewStore(24 * time.Hour),
+	}
+	for _, opt := range opts {
+		opt(web)
+	}
+	web.offboarder = offboarding.New(web.mailingLists, web.auditLog, web.retention)
+	templates := []string{
+		"index.html", "register.html", "reset.html", "password.html",
+		"confirm.html", "email.html", "login.html", "profile.html",
+		"door.html", "badges.html", "sshkeys.html", "services.html",
+		"admin_services.html", "lists.html", "admin_membership.html",
+		"export.html", "admin_members.html", "groups.html", "group.html",
+		"login_totp.html", "totp.html", "passkeys.html",
+		"oidc.html", "admin_mails.html", "dev_mailbox.html",
 	}
-	templates := []string{"index.html", "register.html", "reset.html", "password.html"}
 	for _, tplFile := range templates {
 		tt, err := web.templateParseFilesFromFs(
 			"/templates/base.html",
@@ -74,6 +325,144 @@ func New(mailer core.Mailer, ld core.LdapDialer) (web *Web, err error) {
 	return web, nil
 }
 
+// WithPasswordPolicy replaces the default policies for the password and the
+// door password
+func WithPasswordPolicy(password, doorpass *passwordpolicy.Policy) Option {
+	return func(web *Web) {
+		web.passwordPolicy = password
+		web.doorpassPolicy = doorpass
+	}
+}
+
+// WithRegistrations replaces the store for unconfirmed registrations
+func WithRegistrations(registrations *pending.Registrations) Option {
+	return func(web *Web) {
+		web.registrations = registrations
+	}
+}
+
+// WithEnumerationProtection hides whether a nickname or email address is
+// known on the register and reset pages. Their POST responses take at least
+// minResponseTime, nicknames can only be checked through the rate limited
+// /register/available endpoint.
+func WithEnumerationProtection(minResponseTime time.Duration) Option {
+	return func(web *Web) {
+		web.enumerationProtection = true
+		web.minResponseTime = minResponseTime
+	}
+}
+
+// WithSessions replaces the store for sessions of logged in members, e.g. to
+// keep them in a file
+func WithSessions(sessions *session.Store) Option {
+	return func(web *Web) {
+		web.sessions = sessions
+	}
+}
+
+// WithInsecureCookies allows session cookies over plain http
+func WithInsecureCookies() Option {
+	return func(web *Web) {
+		web.secureCookies = false
+	}
+}
+
+// WithTwoFactorEnforcement requires members whose roles grant any permission
+// to confirm their login with a one-time password before using it
+func WithTwoFactorEnforcement() Option {
+	return func(web *Web) {
+		web.enforceTwoFactor = true
+	}
+}
+
+// WithPasskeys enables logging in with security keys and passkeys
+func WithPasskeys(passkeys *passkey.Manager) Option {
+	return func(web *Web) {
+		web.passkeys = passkeys
+	}
+}
+
+// WithOIDC lets services of the space log members in through the portal
+func WithOIDC(provider *oidc.Provider) Option {
+	return func(web *Web) {
+		web.oidc = provider
+	}
+}
+
+// WithMailPreview lets admins preview the mail templates and send test mails
+// through the mailer
+func WithMailPreview(m *mailer.Mailer) Option {
+	return func(web *Web) {
+		web.mailPreview = m
+	}
+}
+
+// WithMailbox shows the mails captured in development mode on /dev/mailbox
+func WithMailbox(mailbox core.Mailbox) Option {
+	return func(web *Web) {
+		web.mailbox = mailbox
+	}
+}
+
+// WithBoardMail sets the address of the board for notifications
+func WithBoardMail(boardMail string) Option {
+	return func(web *Web) {
+		web.boardMail = boardMail
+	}
+}
+
+// WithServices sets the catalog of services members can enable
+func WithServices(catalog *services.Catalog) Option {
+	return func(web *Web) {
+		web.services = catalog
+	}
+}
+
+// WithPolicy replaces the permissions granted to each role
+func WithPolicy(policy authz.Policy) Option {
+	return func(web *Web) {
+		web.policy = policy
+	}
+}
+
+// WithRoleCache sets how long the roles of a member are cached
+func WithRoleCache(ttl time.Duration) Option {
+	return func(web *Web) {
+		web.roleCache = authz.NewCache(ttl)
+	}
+}
+
+// WithMailingLists enables the mailing list page. New members get subscribed
+// to the defaultLists after confirming their registration.
+func WithMailingLists(ml core.MailingLists, defaultLists ...string) Option {
+	return func(web *Web) {
+		web.mailingLists = ml
+		web.defaultLists = defaultLists
+	}
+}
+
+// WithSelfServiceLists sets the lists members may subscribe to and
+// unsubscribe from on the mailing list page, other lists are not shown
+func WithSelfServiceLists(listIDs ...string) Option {
+	return func(web *Web) {
+		web.selfService = listIDs
+	}
+}
+
+// WithAuditLog sets where admin actions are recorded
+func WithAuditLog(auditLog core.AuditLog) Option {
+	return func(web *Web) {
+		web.auditLog = auditLog
+	}
+}
+
+// WithRetention sets how long offboarded members are kept in the archive
+func WithRetention(retention time.Duration) Option {
+	return func(web *Web) {
+		web.retention = retention
+	}
+}
+
 func (web *Web) GetMux() http.Handler {
 	return web.mux
 }
@@ -94,6 +483,7 @@ func (web *Web) registerRoutes(mux *http.ServeMux) {
 		}
 	})
 	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		defer web.normalizeTiming(r, time.Now())
 		td := web.handleReset(r)
 		err := web.templates["reset.html"].Execute(w, td)
 		if err != nil {
@@ -101,12 +491,50 @@ func (web *Web) registerRoutes(mux *http.ServeMux) {
 		}
 	})
 	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		defer web.normalizeTiming(r, time.Now())
 		td := web.handleRegister(r)
 		err := web.templates["register.html"].Execute(w, td)
 		if err != nil {
 			log.Printf("unable to render template: %s", err)
 		}
 	})
+	mux.HandleFunc("/register/available", func(w http.ResponseWriter, r *http.Request) {
+		res, status := web.handleAvailable(r)
+		writeJSON(w, res, status)
+	})
+	mux.HandleFunc("/confirm", func(w http.ResponseWriter, r *http.Request) {
+		token, td := web.handleConfirm(r)
+		if token != "" {
+			target := fmt.Sprintf("/password?t=%s", url.QueryEscape(token))
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		err := web.templates["confirm.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
+	mux.HandleFunc("/email", func(w http.ResponseWriter, r *http.Request) {
+		td := web.handleEmail(r)
+		err := web.templates["email.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
+	mux.HandleFunc("/email/confirm", func(w http.ResponseWriter, r *http.Request) {
+		td := web.handleEmailConfirm(r)
+		err := web.templates["email.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
+	mux.HandleFunc("/email/revert", func(w http.ResponseWriter, r *http.Request) {
+		td := web.handleEmailRevert(r)
+		err := web.templates["email.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
 	mux.HandleFunc("/password", func(w http.ResponseWriter, r *http.Request) {
 		td := web.handlePassword(r)
 		err := web.templates["password.html"].Execute(w, td)
@@ -114,11 +542,398 @@ func (web *Web) registerRoutes(mux *http.ServeMux) {
 			log.Printf("unable to render template: %s", err)
 		}
 	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		td, nickname := web.handleLogin(r)
+		if nickname != "" && td.TwoFactor {
+			err := web.startTwoFactor(w, nickname)
+			if err == nil {
+				target := fmt.Sprintf("/login/totp?next=%s", url.QueryEscape(td.Form.Next))
+				http.Redirect(w, r, target, http.StatusSeeOther)
+				return
+			}
+			log.Printf("session error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Login fehlgeschlagen",
+			})
+		} else if nickname != "" {
+			err := web.startSession(w, r, nickname, false)
+			if err == nil {
+				http.Redirect(w, r, redirectTarget(td.Form.Next), http.StatusSeeOther)
+				return
+			}
+			log.Printf("session error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Login fehlgeschlagen",
+			})
+		}
+		err := web.templates["login.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
+	mux.HandleFunc("/login/totp", func(w http.ResponseWriter, r *http.Request) {
+		nickname, ok := web.twoFactorMember(r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		td, confirmed := web.handleTwoFactorLogin(r, nickname)
+		if confirmed {
+			web.endTwoFactor(w, r)
+			err := web.startSession(w, r, nickname, true)
+			if err == nil {
+				http.Redirect(w, r, redirectTarget(td.Next), http.StatusSeeOther)
+				return
+			}
+			log.Printf("session error: %s", err)
+			td.Messages = append(td.Messages, Message{
+				DANGER,
+				"Login fehlgeschlagen",
+			})
+		}
+		err := web.templates["login_totp.html"].Execute(w, td)
+		if err != nil {
+			log.Printf("unable to render template: %s", err)
+		}
+	})
+	mux.HandleFunc("/totp", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleTOTP(r, nickname)
+			err := web.templates["totp.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		web.endSession(w, r)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/profile", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleProfile(r, nickname)
+			err := web.templates["profile.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/door", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleDoor(r, nickname)
+			err := web.templates["door.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/door/compromised", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleDoorCompromised(r, nickname)
+			err := web.templates["door.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/badges", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleBadges(r, nickname, nickname)
+			err := web.templates["badges.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/badges/revoke", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleBadgeRevoke(r, nickname)
+			err := web.templates["badges.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/sshkeys", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleSSHKeys(r, nickname)
+			err := web.templates["sshkeys.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/sshkeys/delete", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleSSHKeyDelete(r, nickname)
+			err := web.templates["sshkeys.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/services", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleServices(r, nickname)
+			err := web.templates["services.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/groups", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleGroups(r, nickname)
+			err := web.templates["groups.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/groups/edit", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleGroup(r, nickname)
+			err := web.templates["group.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/export", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleExport(r, nickname)
+			err := web.templates["export.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/export/download", web.requireLogin(
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			archive, err := web.exports.Get(r.URL.Query().Get("t"), nickname)
+			if err != nil {
+				td := &ExportTemplateData{
+					Nickname: nickname,
+					Messages: []Message{{WARNING, "Der Download-Link ist ungültig oder abgelaufen"}},
+				}
+				err = web.templates["export.html"].Execute(w, td)
+				if err != nil {
+					log.Printf("unable to render template: %s", err)
+				}
+				return
+			}
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", nickname+".zip"))
+			_, err = w.Write(archive)
+			if err != nil {
+				log.Printf("unable to send export: %s", err)
+			}
+		},
+	))
+	if web.passkeys != nil {
+		mux.HandleFunc("/passkeys", web.requireLogin(
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				td := web.handlePasskeys(r, nickname)
+				err := web.templates["passkeys.html"].Execute(w, td)
+				if err != nil {
+					log.Printf("unable to render template: %s", err)
+				}
+			},
+		))
+		mux.HandleFunc("/passkeys/register", web.requireLogin(
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				res, status := web.handlePasskeyRegister(w, r, nickname)
+				writeJSON(w, res, status)
+			},
+		))
+		mux.HandleFunc("/passkeys/register/finish", web.requireLogin(
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				res, status := web.handlePasskeyRegisterFinish(w, r, nickname)
+				writeJSON(w, res, status)
+			},
+		))
+		mux.HandleFunc("/login/passkey", func(w http.ResponseWriter, r *http.Request) {
+			res, status := web.handlePasskeyLogin(w, r)
+			writeJSON(w, res, status)
+		})
+		mux.HandleFunc("/login/passkey/finish", func(w http.ResponseWriter, r *http.Request) {
+			res, status := web.handlePasskeyLoginFinish(w, r)
+			writeJSON(w, res, status)
+		})
+	}
+	if web.oidc != nil {
+		mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, web.oidc.Discovery(), http.StatusOK)
+		})
+		mux.HandleFunc("/oidc/jwks", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, web.oidc.JWKS(), http.StatusOK)
+		})
+		mux.HandleFunc("/oidc/authorize", web.requireLogin(
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				td, redirect := web.handleAuthorize(r, nickname)
+				if redirect != "" {
+					http.Redirect(w, r, redirect, http.StatusFound)
+					return
+				}
+				err := web.templates["oidc.html"].Execute(w, td)
+				if err != nil {
+					log.Printf("unable to render template: %s", err)
+				}
+			},
+		))
+		mux.HandleFunc("/oidc/token", func(w http.ResponseWriter, r *http.Request) {
+			res, status := web.handleToken(r)
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, res, status)
+		})
+		mux.HandleFunc("/oidc/userinfo", func(w http.ResponseWriter, r *http.Request) {
+			res, status := web.handleUserInfo(r)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			writeJSON(w, res, status)
+		})
+	}
+	if web.mailingLists != nil {
+		mux.HandleFunc("/lists", web.requireLogin(
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				td := web.handleMailingLists(r, nickname)
+				err := web.templates["lists.html"].Execute(w, td)
+				if err != nil {
+					log.Printf("unable to render template: %s", err)
+				}
+			},
+		))
+	}
+	mux.HandleFunc("/admin/services", web.requirePermission(authz.ManageServices,
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleServiceRequests(r)
+			err := web.templates["admin_services.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/admin/members", web.requirePermission(authz.ReadDirectory,
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			format := r.URL.Query().Get("format")
+			if format != "" {
+				if !web.permissions(r, nickname)[authz.ExportDirectory] {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+				web.handleDirectoryExport(w, r, format)
+				return
+			}
+			td := web.handleDirectory(r)
+			err := web.templates["admin_members.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/admin/badges", web.requirePermission(authz.EnrollBadges,
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleAdminBadges(r, nickname)
+			err := web.templates["badges.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/admin/membership", web.requirePermission(authz.ManageMembership,
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleMembership(r, nickname)
+			err := web.templates["admin_membership.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	mux.HandleFunc("/admin/offboard", web.requirePermission(authz.Offboard,
+		func(w http.ResponseWriter, r *http.Request, nickname string) {
+			td := web.handleOffboard(r, nickname)
+			err := web.templates["admin_membership.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		},
+	))
+	if web.mailPreview != nil {
+		mux.HandleFunc("/admin/mails", web.requirePermission(authz.PreviewMails,
+			func(w http.ResponseWriter, r *http.Request, nickname string) {
+				td := web.handleMailPreview(r, nickname)
+				err := web.templates["admin_mails.html"].Execute(w, td)
+				if err != nil {
+					log.Printf("unable to render template: %s", err)
+				}
+			},
+		))
+	}
+	if web.mailbox != nil {
+		mux.HandleFunc("/dev/mailbox", func(w http.ResponseWriter, r *http.Request) {
+			td := &MailboxTemplateData{
+				Mails:    web.mailbox.Mails(),
+				Messages: []Message{},
+			}
+			err := web.templates["dev_mailbox.html"].Execute(w, td)
+			if err != nil {
+				log.Printf("unable to render template: %s", err)
+			}
+		})
+	}
 
 	// static files
 	mux.Handle("/static/", http.FileServer(web.statics))
 }
 
+// normalizeTiming delays POST responses until minResponseTime passed since
+// start, so the response time does not depend on whether a member exists
+func (web *Web) normalizeTiming(r *http.Request, start time.Time) {
+	if !web.enumerationProtection || r.Method != "POST" {
+		return
+	}
+	time.Sleep(time.Until(start.Add(web.minResponseTime)))
+}
+
+// sendMail sends the mail in the language of the browser the request came
+// from, mails without a matching translation fall back to German
+func (web *Web) sendMail(r *http.Request, to, templateName string, data core.MailData) error {
+	ctx := mailer.WithLocale(r.Context(), mailLocale(r.Header.Get("Accept-Language")))
+	return web.mailer.Send(ctx, to, templateName, data)
+}
+
+// sendThirdPartyMail sends a mail to someone other than the requester, e.g.
+// the owner of an address entered on registration. Their language is
+// unknown, so the default is used.
+func (web *Web) sendThirdPartyMail(r *http.Request, to, templateName string, data core.MailData) error {
+	return web.mailer.Send(r.Context(), to, templateName, data)
+}
+
+// mailLocale returns the primary language of the first entry of an
+// Accept-Language header
+func mailLocale(acceptLanguage string) string {
+	tag, _, _ := strings.Cut(acceptLanguage, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag, _, _ = strings.Cut(tag, "-")
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func writeJSON(w http.ResponseWriter, res interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(res)
+	if err != nil {
+		log.Printf("unable to encode response: %s", err)
+	}
+}
+
 func (web *Web) templateParseFilesFromFs(files ...string) (t *template.Template, err error) {
 	for _, file := range files {
 		fp, err := web.statics.Open(file)
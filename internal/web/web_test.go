@@ -8,13 +8,24 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/mailer"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/pending"
 	"github.com/b4ckspace/members/mocks"
 )
 
+func TestMain(m *testing.M) {
+	_ = os.Chdir("../../")
+	os.Exit(m.Run())
+}
+
 func TestWeb(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -22,8 +33,6 @@ func TestWeb(t *testing.T) {
 	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
 	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
 
-	_ = os.Chdir("../../")
-
 	web, err := New(mockMailer, mockLdapDailer)
 	if err != nil {
 		t.Fatalf("unable to create web: %s", err)
@@ -36,41 +45,27 @@ func TestWeb(t *testing.T) {
 		email        string
 		mlMailOption string
 		mlMail       string
-		token        string
-		err          error
 		mailerErr    error
 		want         string
 	}{{
 		"valid",
 		"member", "member@email.local", "space", "member@hackerspace-bamberg.de",
-		"token", nil,
 		nil,
-		"Willkommen im Backspace!",
-	}, {
-		"ldap error",
-		"member", "member@email.local", "space", "member@hackerspace-bamberg.de",
-		"token", fmt.Errorf("error 1337"),
-		nil,
-		"Member konnte nicht angelegt werden",
+		"Bitte bestätige deine E-Mail-Adresse",
 	}, {
 		"mailer err",
 		"member", "member@email.local", "space", "member@hackerspace-bamberg.de",
-		"token", nil,
 		fmt.Errorf("unable to send mail"),
-		"Registrierungs-Mail konnte nicht gesendet werden",
+		"Bestätigungs-Mail konnte nicht gesendet werden",
 	}}
 	for _, o := range registerMemberOpts {
 		t.Logf("running %s", o.testName)
+		web.registrations = pending.NewRegistrations(time.Hour)
 		mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
 		mockLdapWrap.EXPECT().MemberExists(o.nickname).Return(false, nil)
-		mockLdapWrap.EXPECT().
-			RegisterMember(o.nickname, o.email, o.mlMail).
-			Return(o.token, o.err)
-		if o.err == nil {
-			mockMailer.EXPECT().
-				SendPassword(o.email, o.nickname, o.token).
-				Return(o.mailerErr)
-		}
+		mockMailer.EXPECT().
+			Send(gomock.Any(), o.email, core.MailRegistration, gomock.Any()).
+			Return(o.mailerErr)
 
 		r := bytes.NewBufferString(fmt.Sprintf(
 			"nickname=%s&email=%s&mladdr=%s",
@@ -87,6 +82,71 @@ func TestWeb(t *testing.T) {
 			t.Logf("test: %s", o.testName)
 			t.Fatalf("invalid response, missing: '%s'", o.want)
 		}
+		if web.registrations.Reserved(o.nickname) != (o.mailerErr == nil) {
+			t.Fatalf("invalid reservation state for %s", o.testName)
+		}
+	}
+
+	// confirm registration test
+	confirmOpts := []struct {
+		testName string
+		token    string
+		err      error
+		want     string
+	}{{
+		"valid",
+		"t0k3n", nil,
+		"/password?t=t0k3n",
+	}, {
+		"ldap error",
+		"t0k3n", fmt.Errorf("error 1337"),
+		"Member konnte nicht angelegt werden",
+	}}
+	for _, o := range confirmOpts {
+		t.Logf("running %s", o.testName)
+		web.registrations = pending.NewRegistrations(time.Hour)
+		confirmToken, err := web.registrations.Reserve(
+			"member", "member@email.local", "member@hackerspace-bamberg.de",
+		)
+		if err != nil {
+			t.Fatalf("unable to reserve: %s", err)
+		}
+		// opening the link does not create the member
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/confirm?t="+confirmToken, nil)
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !bytes.Contains(body, []byte("Registrierung von <strong>member</strong>")) {
+			t.Fatalf("confirmation page missing for %s", o.testName)
+		}
+
+		mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+		mockLdapWrap.EXPECT().
+			RegisterMember(
+				"member", "member@email.local", "member@hackerspace-bamberg.de",
+				[]string{"htaccess", "mail", "redmine"},
+			).
+			Return(o.token, o.err)
+
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", "/confirm", bytes.NewBufferString("t="+confirmToken))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ = io.ReadAll(rr.Result().Body)
+		if !bytes.Contains(body, []byte(o.want)) &&
+			rr.Result().Header.Get("Location") != o.want {
+			t.Fatalf("invalid response for %s, missing: '%s'", o.testName, o.want)
+		}
+		// a failed confirmation can be retried
+		if web.registrations.Reserved("member") != (o.err != nil) {
+			t.Fatalf("invalid reservation after %s", o.testName)
+		}
+	}
+
+	// a used link cannot create the member again
+	ok, err := postOk(web, "/confirm", bytes.NewBufferString("t=used"), "Registrierung konnte nicht abgeschlossen werden")
+	if err != nil || !ok {
+		t.Fatalf("used confirmation link accepted: %s", err)
 	}
 
 	changePasswordOpts := []struct {
@@ -120,6 +180,182 @@ func TestWeb(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	web, err := New(mockMailer, mockLdapDailer)
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+
+	resetOpts := []struct {
+		testName string
+		input    string
+		resets   []core.PasswordResetToken
+	}{{
+		"nickname",
+		"member",
+		[]core.PasswordResetToken{{Nickname: "member", Email: "member@email.local", Token: "t0k3n"}},
+	}, {
+		"shared email",
+		"shared@email.local",
+		[]core.PasswordResetToken{
+			{Nickname: "member", Email: "shared@email.local", Token: "t0k3n"},
+			{Nickname: "other", Email: "shared@email.local", Token: "0th3r"},
+		},
+	}, {
+		"unknown",
+		"nobody",
+		nil,
+	}}
+	for _, o := range resetOpts {
+		t.Logf("running %s", o.testName)
+		mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+		mockLdapWrap.EXPECT().PasswordReset(o.input).Return(o.resets, nil)
+		for _, reset := range o.resets {
+			mockMailer.EXPECT().Send(gomock.Any(), reset.Email, core.MailPasswordReset, core.MailData{
+				Nickname: reset.Nickname,
+				Token:    reset.Token,
+			})
+		}
+		r := bytes.NewBufferString(fmt.Sprintf("nickname=%s", o.input))
+		want := "Falls ein passender Account existiert"
+		ok, err := postOk(web, "/reset", r, want)
+		if err != nil || !ok {
+			t.Fatalf("invalid response for %s, missing: '%s'", o.testName, want)
+		}
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMailer := mocks.NewMockMailer(mockCtrl)
+	mockLdapDailer := mocks.NewMockLdapDialer(mockCtrl)
+	mockLdapWrap := mocks.NewMockLdapWrap(mockCtrl)
+
+	ml := mailinglist.NewFake(core.MailingList{ID: "intern.hackerspace-bamberg.de", Name: "intern"})
+	err := ml.Subscribe("intern.hackerspace-bamberg.de", "old@email.local")
+	if err != nil {
+		t.Fatalf("unable to subscribe: %s", err)
+	}
+	web, err := New(mockMailer, mockLdapDailer, WithMailingLists(ml))
+	if err != nil {
+		t.Fatalf("unable to create web: %s", err)
+	}
+
+	emailOpts := []struct {
+		testName string
+		authOk   bool
+		want     string
+	}{{
+		"valid",
+		true,
+		"Bitte bestätige die neue Adresse",
+	}, {
+		"wrong password",
+		false,
+		"Nickname oder Passwort falsch",
+	}}
+	for _, o := range emailOpts {
+		t.Logf("running %s", o.testName)
+		mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+		mockLdapWrap.EXPECT().Authenticate("member", "p4ssw0rd").Return("member", o.authOk, nil)
+		if o.authOk {
+			mockLdapWrap.EXPECT().
+				RequestEmailChange("member", "new@email.local").
+				Return("c0nf1rm", "r3v3rt", "old@email.local", nil)
+			// the old address may belong to someone else by now
+			expectLocale := func(want string) func(ctx context.Context, to, name string, data interface{}) error {
+				return func(ctx context.Context, to, name string, data interface{}) error {
+					if locale := mailer.Locale(ctx); locale != want {
+						t.Fatalf("invalid locale for %s: %s", name, locale)
+					}
+					return nil
+				}
+			}
+			mockMailer.EXPECT().Send(gomock.Any(), "new@email.local", core.MailEmailConfirm, core.MailData{
+				Nickname: "member",
+				EMail:    "new@email.local",
+				Token:    "c0nf1rm",
+			}).DoAndReturn(expectLocale("en"))
+			mockMailer.EXPECT().Send(gomock.Any(), "old@email.local", core.MailEmailRevert, core.MailData{
+				Nickname: "member",
+				EMail:    "new@email.local",
+				Token:    "r3v3rt",
+			}).DoAndReturn(expectLocale(mailer.DefaultLocale))
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/email", strings.NewReader(
+			"nickname=member&password=p4ssw0rd&email=new@email.local",
+		))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Accept-Language", "en-US,en;q=0.9")
+		web.GetMux().ServeHTTP(rr, req)
+		body, _ := io.ReadAll(rr.Result().Body)
+		if !bytes.Contains(body, []byte(o.want)) {
+			t.Fatalf("invalid response for %s, missing: '%s'", o.testName, o.want)
+		}
+	}
+
+	confirmOpts := []struct {
+		testName  string
+		mlAddress string
+		moved     bool
+	}{{
+		"space address",
+		"member@hackerspace-bamberg.de", false,
+	}, {
+		"own address",
+		"old@email.local", true,
+	}}
+	for _, o := range confirmOpts {
+		t.Logf("running %s", o.testName)
+		mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+		mockLdapWrap.EXPECT().
+			ConfirmEmailChange("c0nf1rm").
+			Return("member", "old@email.local", "new@email.local", nil)
+		mockLdapWrap.EXPECT().MlAddress("member").Return(o.mlAddress, "new@email.local", nil)
+		if o.moved {
+			mockLdapWrap.EXPECT().SetMlAddress("member", "new@email.local")
+		}
+		mockMailer.EXPECT().Send(gomock.Any(), "old@email.local", core.MailSecurityNotice, gomock.Any())
+		ok, err := postOk(web, "/email/confirm?t=c0nf1rm", nil, "new@email.local")
+		if err != nil || !ok {
+			t.Fatalf("email change not confirmed: %s", err)
+		}
+	}
+	moved, _ := ml.Subscriptions("new@email.local")
+	if len(moved) != 1 {
+		t.Fatalf("subscriptions not moved: %v", moved)
+	}
+
+	// reverting the change takes the subscriptions back to the old address and
+	// ends all sessions of the member
+	s, _ := web.sessions.Create("member")
+	mockLdapDailer.EXPECT().Dial(context.Background()).Return(mockLdapWrap, nil)
+	mockLdapWrap.EXPECT().
+		RevertEmailChange("r3v3rt").
+		Return("member", "new@email.local", "old@email.local", nil)
+	mockLdapWrap.EXPECT().MlAddress("member").Return("new@email.local", "old@email.local", nil)
+	mockLdapWrap.EXPECT().SetMlAddress("member", "old@email.local")
+	ok, err := postOk(web, "/email/revert?t=r3v3rt", nil, "lautet wieder old@email.local")
+	if err != nil || !ok {
+		t.Fatalf("email change not reverted: %s", err)
+	}
+	moved, _ = ml.Subscriptions("old@email.local")
+	if len(moved) != 1 {
+		t.Fatalf("subscriptions not moved back: %v", moved)
+	}
+	if _, ok := web.sessions.Get(s.ID); ok {
+		t.Fatalf("session still valid after revert")
+	}
+}
+
 func postOk(web *Web, url string, r io.Reader, want string) (ok bool, err error) {
 	req, err := http.NewRequestWithContext(
 		context.Background(),
@@ -5,10 +5,23 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/b4ckspace/members/internal/audit"
+	"github.com/b4ckspace/members/internal/core"
+	"github.com/b4ckspace/members/internal/devmode"
 	"github.com/b4ckspace/members/internal/ldapwrap"
 	"github.com/b4ckspace/members/internal/mailer"
+	"github.com/b4ckspace/members/internal/mailinglist"
+	"github.com/b4ckspace/members/internal/oidc"
+	"github.com/b4ckspace/members/internal/passkey"
+	"github.com/b4ckspace/members/internal/passwordpolicy"
+	"github.com/b4ckspace/members/internal/pending"
+	"github.com/b4ckspace/members/internal/services"
+	"github.com/b4ckspace/members/internal/session"
 	"github.com/b4ckspace/members/internal/web"
 )
 
@@ -20,6 +33,44 @@ type (
 		LdapPass   string
 		MailServer string
 		WebListen  string
+
+		PasswordMinLength int
+		PasswordMinScore  int
+		BreachListDir     string
+		DoorpassMinLength int
+		DoorpassDistinct  bool
+
+		RegistrationTTL  time.Duration
+		RegistrationFile string
+
+		EnumerationProtection bool
+		MinResponseTime       time.Duration
+
+		SessionTimeout  time.Duration
+		SessionLifetime time.Duration
+		SessionStore    string
+		InsecureCookies bool
+		BoardMail       string
+		EnforceTOTP     bool
+		PasskeyOrigin   string
+
+		OIDCIssuer  string
+		OIDCClients string
+		OIDCKey     string
+
+		Services  string
+		RoleCache time.Duration
+
+		MailmanURL   string
+		MailmanUser  string
+		MailmanPass  string
+		DefaultLists string
+		SelfService  string
+
+		AuditLog  string
+		Retention time.Duration
+
+		Dev bool
 	}
 )
 
@@ -30,30 +81,185 @@ func main() {
 	flag.IntVar(&args.LdapPort, "port", 389, "ldap port")
 	flag.StringVar(&args.MailServer, "mailserver", "localhost:25", "email server")
 	flag.StringVar(&args.WebListen, "listen", ":8080", "address to listen on")
+	flag.IntVar(&args.PasswordMinLength, "password-min-length", 8, "minimal password length")
+	flag.IntVar(&args.PasswordMinScore, "password-min-score", 2, "minimal password strength (0-4)")
+	flag.StringVar(&args.BreachListDir, "breachlist", "", "directory with hibp range files")
+	flag.IntVar(&args.DoorpassMinLength, "doorpass-min-length", 8, "minimal door password length")
+	flag.BoolVar(&args.DoorpassDistinct, "doorpass-distinct", false, "door password has to differ from password")
+	flag.DurationVar(&args.RegistrationTTL, "registration-ttl", 24*time.Hour, "time to confirm a registration")
+	flag.StringVar(&args.RegistrationFile, "registration-file", "", "file keeping unconfirmed registrations across restarts")
+	flag.BoolVar(&args.EnumerationProtection, "enumeration-protection", false, "hide whether members exist")
+	flag.DurationVar(&args.MinResponseTime, "min-response-time", time.Second, "minimal response time with enumeration protection")
+	flag.DurationVar(&args.SessionTimeout, "session-timeout", time.Hour, "idle time until members are logged out")
+	flag.DurationVar(&args.SessionLifetime, "session-lifetime", 7*24*time.Hour, "time until members have to log in again")
+	flag.StringVar(&args.SessionStore, "session-store", "", "bbolt file sessions are kept in, in memory if empty")
+	flag.BoolVar(&args.InsecureCookies, "insecure-cookies", false, "allow session cookies over http")
+	flag.BoolVar(&args.EnforceTOTP, "enforce-totp", true, "require two-factor authentication for members with admin roles")
+	flag.StringVar(&args.PasskeyOrigin, "passkey-origin", "", "public url of the portal, enables passkeys, e.g. https://members.example.com")
+	flag.StringVar(&args.OIDCIssuer, "oidc-issuer", "", "public url of the portal, enables the openid connect provider")
+	flag.StringVar(&args.OIDCClients, "oidc-clients", "oidc.json", "openid connect clients (json)")
+	flag.StringVar(&args.OIDCKey, "oidc-key", "oidc.pem", "rsa key id tokens are signed with, created if missing")
+	flag.StringVar(&args.BoardMail, "board-mail", "vorstand@hackerspace-bamberg.de", "email address of the board")
+	flag.StringVar(&args.Services, "services", "", "service catalog (json)")
+	flag.DurationVar(&args.RoleCache, "role-cache", 5*time.Minute, "time the ldap group roles of a member are cached")
+	flag.StringVar(&args.MailmanURL, "mailman-url", "", "mailman 3 rest api, e.g. http://localhost:8001/3.1")
+	flag.StringVar(&args.MailmanUser, "mailman-user", "restadmin", "mailman rest api user")
+	flag.StringVar(&args.DefaultLists, "default-lists", "", "comma separated list ids new members get subscribed to")
+	flag.StringVar(&args.SelfService, "self-service-lists", "", "comma separated list ids members may subscribe to themselves")
+	flag.StringVar(&args.AuditLog, "audit-log", "audit.log", "file admin actions are appended to")
+	flag.DurationVar(&args.Retention, "retention", 2*365*24*time.Hour, "time offboarded members are kept in the archive")
+	flag.BoolVar(&args.Dev, "dev", false, "use an in-memory directory with sample members and capture mails on /dev/mailbox")
 	flag.Parse()
 
 	// ldap
-	var ok bool
-	args.LdapPass, ok = os.LookupEnv("LDAP_PASSWORD")
-	if !ok {
-		log.Fatalf("unable to load LDAP_PASSWORD from environment")
-	}
-	ldapConnFactory := ldapwrap.NewLdapConnFactory(
-		args.LdapServer,
-		args.LdapPort,
-		args.LdapUser,
-		args.LdapPass,
-	)
+	var ldapConnFactory ldapwrap.LdapConnFactory
+	mailConnFactory := mailer.SmtpConnFactory(args.MailServer)
+	var mailbox *devmode.Mailbox
+	if args.Dev {
+		dir, err := devmode.Directory()
+		if err != nil {
+			log.Fatalf("unable to seed directory: %s", err)
+		}
+		ldapConnFactory = func() (core.LdapConn, error) { return dir, nil }
+		mailbox = devmode.NewMailbox()
+		mailConnFactory = mailbox.ConnFactory()
+		args.InsecureCookies = true
+		args.EnforceTOTP = false
+		log.Printf("dev mode: log in as member, board, treasurer or dooradmin with password %s", devmode.Password)
+	} else {
+		var ok bool
+		args.LdapPass, ok = os.LookupEnv("LDAP_PASSWORD")
+		if !ok {
+			log.Fatalf("unable to load LDAP_PASSWORD from environment")
+		}
+		ldapConnFactory = ldapwrap.NewLdapConnFactory(
+			args.LdapServer,
+			args.LdapPort,
+			args.LdapUser,
+			args.LdapPass,
+		)
+	}
 	l, err := ldapwrap.New(ldapConnFactory)
 	if err != nil {
 		log.Fatalf("unable to connect to ldap: %s", err)
 	}
 
 	// mailer
-	mlr := mailer.New(mailer.SmtpConnFactory(args.MailServer))
+	mlr, err := mailer.New(mailConnFactory)
+	if err != nil {
+		log.Fatalf("unable to load mail templates: %s", err)
+	}
+
+	// password policies
+	passwordRules := []passwordpolicy.Rule{
+		passwordpolicy.MinLength(args.PasswordMinLength),
+		passwordpolicy.NotNickname(),
+		passwordpolicy.MinStrength(args.PasswordMinScore),
+	}
+	if args.BreachListDir != "" {
+		bl, err := passwordpolicy.NewBreachList(args.BreachListDir)
+		if err != nil {
+			log.Fatalf("unable to load breach list: %s", err)
+		}
+		passwordRules = append(passwordRules, passwordpolicy.NotBreached(bl))
+	}
+	doorpassRules := []passwordpolicy.Rule{
+		passwordpolicy.MinLength(args.DoorpassMinLength),
+		passwordpolicy.NotNickname(),
+	}
+	if args.DoorpassDistinct {
+		doorpassRules = append(doorpassRules, passwordpolicy.DifferentFromMain())
+	}
+
+	// unconfirmed registrations
+	registrations := pending.NewRegistrations(args.RegistrationTTL)
+	if args.RegistrationFile != "" {
+		registrations, err = pending.OpenRegistrations(args.RegistrationFile, args.RegistrationTTL)
+		if err != nil {
+			log.Fatalf("unable to load registrations: %s", err)
+		}
+	}
+
+	// services
+	catalog := services.Default()
+	if args.Services != "" {
+		catalog, err = services.Load(args.Services)
+		if err != nil {
+			log.Fatalf("unable to load services: %s", err)
+		}
+	}
+
+	// sessions
+	var sessionBackend session.Backend = session.NewMemory()
+	if args.SessionStore != "" {
+		sessionBackend, err = session.NewBolt(args.SessionStore)
+		if err != nil {
+			log.Fatalf("unable to open session store: %s", err)
+		}
+	}
 
 	// webinterface
-	w, err := web.New(mlr, l)
+	webOpts := []web.Option{
+		web.WithPasswordPolicy(
+			passwordpolicy.New(passwordRules...),
+			passwordpolicy.New(doorpassRules...),
+		),
+		web.WithRegistrations(registrations),
+		web.WithSessions(session.NewStore(sessionBackend, args.SessionTimeout, args.SessionLifetime)),
+		web.WithMailPreview(mlr),
+		web.WithBoardMail(args.BoardMail),
+		web.WithServices(catalog),
+		web.WithRoleCache(args.RoleCache),
+		web.WithAuditLog(audit.NewFile(args.AuditLog)),
+		web.WithRetention(args.Retention),
+	}
+	if args.MailmanURL != "" {
+		args.MailmanPass = os.Getenv("MAILMAN_PASSWORD")
+		ml := mailinglist.NewMailman(args.MailmanURL, args.MailmanUser, args.MailmanPass)
+		var defaultLists []string
+		if args.DefaultLists != "" {
+			defaultLists = strings.Split(args.DefaultLists, ",")
+		}
+		webOpts = append(webOpts, web.WithMailingLists(ml, defaultLists...))
+		if args.SelfService != "" {
+			webOpts = append(webOpts, web.WithSelfServiceLists(strings.Split(args.SelfService, ",")...))
+		}
+	}
+	if args.PasskeyOrigin != "" {
+		origin, err := url.Parse(args.PasskeyOrigin)
+		if err != nil {
+			log.Fatalf("invalid passkey origin: %s", err)
+		}
+		pk, err := passkey.New(origin.Hostname(), args.PasskeyOrigin)
+		if err != nil {
+			log.Fatalf("unable to setup passkeys: %s", err)
+		}
+		webOpts = append(webOpts, web.WithPasskeys(pk))
+	}
+	if args.OIDCIssuer != "" {
+		clients, err := oidc.LoadClients(args.OIDCClients)
+		if err != nil {
+			log.Fatalf("unable to load oidc clients: %s", err)
+		}
+		key, err := oidc.LoadKey(args.OIDCKey)
+		if err != nil {
+			log.Fatalf("unable to load oidc key: %s", err)
+		}
+		webOpts = append(webOpts, web.WithOIDC(oidc.New(args.OIDCIssuer, key, clients)))
+	}
+	if mailbox != nil {
+		webOpts = append(webOpts, web.WithMailbox(mailbox))
+	}
+	if args.InsecureCookies {
+		webOpts = append(webOpts, web.WithInsecureCookies())
+	}
+	if args.EnforceTOTP {
+		webOpts = append(webOpts, web.WithTwoFactorEnforcement())
+	}
+	if args.EnumerationProtection {
+		webOpts = append(webOpts, web.WithEnumerationProtection(args.MinResponseTime))
+	}
+	w, err := web.New(mlr, l, webOpts...)
 	if err != nil {
 		log.Fatalf("unable to start webserver: %s", err)
 	}
@@ -9,7 +9,10 @@ import (
 	core "github.com/b4ckspace/members/internal/core"
 	gomock "github.com/golang/mock/gomock"
 	ldap_v3 "github.com/go-ldap/ldap/v3"
+	membership "github.com/b4ckspace/members/internal/membership"
 	reflect "reflect"
+	time "time"
+	webauthn "github.com/go-webauthn/webauthn/webauthn"
 )
 
 // MockLdapConn is a mock of LdapConn interface
@@ -49,6 +52,34 @@ func (mr *MockLdapConnMockRecorder) Add(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockLdapConn)(nil).Add), arg0)
 }
 
+// Close mocks base method
+func (m *MockLdapConn) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close
+func (mr *MockLdapConnMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockLdapConn)(nil).Close))
+}
+
+// Del mocks base method
+func (m *MockLdapConn) Del(arg0 *ldap_v3.DelRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Del", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Del indicates an expected call of Del
+func (mr *MockLdapConnMockRecorder) Del(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockLdapConn)(nil).Del), arg0)
+}
+
 // Modify mocks base method
 func (m *MockLdapConn) Modify(arg0 *ldap_v3.ModifyRequest) error {
 	m.ctrl.T.Helper()
@@ -63,6 +94,20 @@ func (mr *MockLdapConnMockRecorder) Modify(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Modify", reflect.TypeOf((*MockLdapConn)(nil).Modify), arg0)
 }
 
+// ModifyDN mocks base method
+func (m *MockLdapConn) ModifyDN(arg0 *ldap_v3.ModifyDNRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ModifyDN", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ModifyDN indicates an expected call of ModifyDN
+func (mr *MockLdapConnMockRecorder) ModifyDN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ModifyDN", reflect.TypeOf((*MockLdapConn)(nil).ModifyDN), arg0)
+}
+
 // Search mocks base method
 func (m *MockLdapConn) Search(arg0 *ldap_v3.SearchRequest) (*ldap_v3.SearchResult, error) {
 	m.ctrl.T.Helper()
@@ -78,18 +123,6 @@ func (mr *MockLdapConnMockRecorder) Search(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockLdapConn)(nil).Search), arg0)
 }
 
-// Close mocks base method
-func (m *MockLdapConn) Close() {
-	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Close")
-}
-
-// Close indicates an expected call of Close
-func (mr *MockLdapConnMockRecorder) Close() *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockLdapConn)(nil).Close))
-}
-
 // MockLdapDialer is a mock of LdapDialer interface
 type MockLdapDialer struct {
 	ctrl     *gomock.Controller
@@ -151,33 +184,429 @@ func (m *MockLdapWrap) EXPECT() *MockLdapWrapMockRecorder {
 	return m.recorder
 }
 
-// RegisterMember mocks base method
-func (m *MockLdapWrap) RegisterMember(user, email, mlEmail string) (string, error) {
+// AddBadge mocks base method
+func (m *MockLdapWrap) AddBadge(uid, badgeUID, label string) (core.Badge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBadge", uid, badgeUID, label)
+	ret0, _ := ret[0].(core.Badge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBadge indicates an expected call of AddBadge
+func (mr *MockLdapWrapMockRecorder) AddBadge(uid, badgeUID, label interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBadge", reflect.TypeOf((*MockLdapWrap)(nil).AddBadge), uid, badgeUID, label)
+}
+
+// AddGroupMember mocks base method
+func (m *MockLdapWrap) AddGroupMember(cn, uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddGroupMember", cn, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddGroupMember indicates an expected call of AddGroupMember
+func (mr *MockLdapWrapMockRecorder) AddGroupMember(cn, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGroupMember", reflect.TypeOf((*MockLdapWrap)(nil).AddGroupMember), cn, uid)
+}
+
+// AddGroupOwner mocks base method
+func (m *MockLdapWrap) AddGroupOwner(cn, uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddGroupOwner", cn, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddGroupOwner indicates an expected call of AddGroupOwner
+func (mr *MockLdapWrapMockRecorder) AddGroupOwner(cn, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGroupOwner", reflect.TypeOf((*MockLdapWrap)(nil).AddGroupOwner), cn, uid)
+}
+
+// AddPasskey mocks base method
+func (m *MockLdapWrap) AddPasskey(uid, label string, credential webauthn.Credential) (core.Passkey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPasskey", uid, label, credential)
+	ret0, _ := ret[0].(core.Passkey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddPasskey indicates an expected call of AddPasskey
+func (mr *MockLdapWrapMockRecorder) AddPasskey(uid, label, credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPasskey", reflect.TypeOf((*MockLdapWrap)(nil).AddPasskey), uid, label, credential)
+}
+
+// AddSSHKey mocks base method
+func (m *MockLdapWrap) AddSSHKey(uid, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSSHKey", uid, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddSSHKey indicates an expected call of AddSSHKey
+func (mr *MockLdapWrapMockRecorder) AddSSHKey(uid, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSSHKey", reflect.TypeOf((*MockLdapWrap)(nil).AddSSHKey), uid, key)
+}
+
+// Archive mocks base method
+func (m *MockLdapWrap) Archive(uid string, deleteAfter time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Archive", uid, deleteAfter)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Archive indicates an expected call of Archive
+func (mr *MockLdapWrapMockRecorder) Archive(uid, deleteAfter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Archive", reflect.TypeOf((*MockLdapWrap)(nil).Archive), uid, deleteAfter)
+}
+
+// Authenticate mocks base method
+func (m *MockLdapWrap) Authenticate(uid, password string) (string, bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RegisterMember", user, email, mlEmail)
+	ret := m.ctrl.Call(m, "Authenticate", uid, password)
 	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Authenticate indicates an expected call of Authenticate
+func (mr *MockLdapWrapMockRecorder) Authenticate(uid, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authenticate", reflect.TypeOf((*MockLdapWrap)(nil).Authenticate), uid, password)
+}
+
+// Badges mocks base method
+func (m *MockLdapWrap) Badges(uid string) ([]core.Badge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Badges", uid)
+	ret0, _ := ret[0].([]core.Badge)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// RegisterMember indicates an expected call of RegisterMember
-func (mr *MockLdapWrapMockRecorder) RegisterMember(user, email, mlEmail interface{}) *gomock.Call {
+// Badges indicates an expected call of Badges
+func (mr *MockLdapWrapMockRecorder) Badges(uid interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterMember", reflect.TypeOf((*MockLdapWrap)(nil).RegisterMember), user, email, mlEmail)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Badges", reflect.TypeOf((*MockLdapWrap)(nil).Badges), uid)
 }
 
-// SetPassword mocks base method
-func (m *MockLdapWrap) SetPassword(token, password, doorpass string) error {
+// ChangeMembership mocks base method
+func (m *MockLdapWrap) ChangeMembership(uid string, t membership.Transition, services []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetPassword", token, password, doorpass)
+	ret := m.ctrl.Call(m, "ChangeMembership", uid, t, services)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SetPassword indicates an expected call of SetPassword
-func (mr *MockLdapWrapMockRecorder) SetPassword(token, password, doorpass interface{}) *gomock.Call {
+// ChangeMembership indicates an expected call of ChangeMembership
+func (mr *MockLdapWrapMockRecorder) ChangeMembership(uid, t, services interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPassword", reflect.TypeOf((*MockLdapWrap)(nil).SetPassword), token, password, doorpass)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeMembership", reflect.TypeOf((*MockLdapWrap)(nil).ChangeMembership), uid, t, services)
+}
+
+// ConfirmEmailChange mocks base method
+func (m *MockLdapWrap) ConfirmEmailChange(token string) (string, string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmEmailChange", token)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(string)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ConfirmEmailChange indicates an expected call of ConfirmEmailChange
+func (mr *MockLdapWrapMockRecorder) ConfirmEmailChange(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmEmailChange", reflect.TypeOf((*MockLdapWrap)(nil).ConfirmEmailChange), token)
+}
+
+// CreateGroup mocks base method
+func (m *MockLdapWrap) CreateGroup(cn, description string) (core.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateGroup", cn, description)
+	ret0, _ := ret[0].(core.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateGroup indicates an expected call of CreateGroup
+func (mr *MockLdapWrapMockRecorder) CreateGroup(cn, description interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGroup", reflect.TypeOf((*MockLdapWrap)(nil).CreateGroup), cn, description)
+}
+
+// DeclineService mocks base method
+func (m *MockLdapWrap) DeclineService(uid, service string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeclineService", uid, service)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeclineService indicates an expected call of DeclineService
+func (mr *MockLdapWrapMockRecorder) DeclineService(uid, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeclineService", reflect.TypeOf((*MockLdapWrap)(nil).DeclineService), uid, service)
+}
+
+// DeleteArchived mocks base method
+func (m *MockLdapWrap) DeleteArchived(uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteArchived", uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteArchived indicates an expected call of DeleteArchived
+func (mr *MockLdapWrapMockRecorder) DeleteArchived(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteArchived", reflect.TypeOf((*MockLdapWrap)(nil).DeleteArchived), uid)
+}
+
+// DeleteGroup mocks base method
+func (m *MockLdapWrap) DeleteGroup(cn string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteGroup", cn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteGroup indicates an expected call of DeleteGroup
+func (mr *MockLdapWrapMockRecorder) DeleteGroup(cn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteGroup", reflect.TypeOf((*MockLdapWrap)(nil).DeleteGroup), cn)
+}
+
+// DeleteSSHKey mocks base method
+func (m *MockLdapWrap) DeleteSSHKey(uid, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSSHKey", uid, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSSHKey indicates an expected call of DeleteSSHKey
+func (mr *MockLdapWrapMockRecorder) DeleteSSHKey(uid, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSSHKey", reflect.TypeOf((*MockLdapWrap)(nil).DeleteSSHKey), uid, key)
+}
+
+// Directory mocks base method
+func (m *MockLdapWrap) Directory(q core.DirectoryQuery) ([]core.DirectoryEntry, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Directory", q)
+	ret0, _ := ret[0].([]core.DirectoryEntry)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Directory indicates an expected call of Directory
+func (mr *MockLdapWrapMockRecorder) Directory(q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Directory", reflect.TypeOf((*MockLdapWrap)(nil).Directory), q)
+}
+
+// DisableLogin mocks base method
+func (m *MockLdapWrap) DisableLogin(uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableLogin", uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableLogin indicates an expected call of DisableLogin
+func (mr *MockLdapWrapMockRecorder) DisableLogin(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableLogin", reflect.TypeOf((*MockLdapWrap)(nil).DisableLogin), uid)
+}
+
+// DisableService mocks base method
+func (m *MockLdapWrap) DisableService(uid, service string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableService", uid, service)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableService indicates an expected call of DisableService
+func (mr *MockLdapWrapMockRecorder) DisableService(uid, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableService", reflect.TypeOf((*MockLdapWrap)(nil).DisableService), uid, service)
+}
+
+// DisableTOTP mocks base method
+func (m *MockLdapWrap) DisableTOTP(uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTOTP", uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTOTP indicates an expected call of DisableTOTP
+func (mr *MockLdapWrapMockRecorder) DisableTOTP(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTOTP", reflect.TypeOf((*MockLdapWrap)(nil).DisableTOTP), uid)
+}
+
+// DoorMembers mocks base method
+func (m *MockLdapWrap) DoorMembers() ([]core.DoorMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DoorMembers")
+	ret0, _ := ret[0].([]core.DoorMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DoorMembers indicates an expected call of DoorMembers
+func (mr *MockLdapWrapMockRecorder) DoorMembers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DoorMembers", reflect.TypeOf((*MockLdapWrap)(nil).DoorMembers))
+}
+
+// EnableService mocks base method
+func (m *MockLdapWrap) EnableService(uid, service string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableService", uid, service)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableService indicates an expected call of EnableService
+func (mr *MockLdapWrapMockRecorder) EnableService(uid, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableService", reflect.TypeOf((*MockLdapWrap)(nil).EnableService), uid, service)
+}
+
+// EnableTOTP mocks base method
+func (m *MockLdapWrap) EnableTOTP(uid, secret string, recoveryCodes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", uid, secret, recoveryCodes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP
+func (mr *MockLdapWrapMockRecorder) EnableTOTP(uid, secret, recoveryCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockLdapWrap)(nil).EnableTOTP), uid, secret, recoveryCodes)
+}
+
+// ExpiredArchives mocks base method
+func (m *MockLdapWrap) ExpiredArchives(now time.Time) ([]core.Archive, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpiredArchives", now)
+	ret0, _ := ret[0].([]core.Archive)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpiredArchives indicates an expected call of ExpiredArchives
+func (mr *MockLdapWrapMockRecorder) ExpiredArchives(now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpiredArchives", reflect.TypeOf((*MockLdapWrap)(nil).ExpiredArchives), now)
+}
+
+// Group mocks base method
+func (m *MockLdapWrap) Group(cn string) (core.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Group", cn)
+	ret0, _ := ret[0].(core.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Group indicates an expected call of Group
+func (mr *MockLdapWrapMockRecorder) Group(cn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Group", reflect.TypeOf((*MockLdapWrap)(nil).Group), cn)
+}
+
+// Groups mocks base method
+func (m *MockLdapWrap) Groups() ([]core.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Groups")
+	ret0, _ := ret[0].([]core.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Groups indicates an expected call of Groups
+func (mr *MockLdapWrapMockRecorder) Groups() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Groups", reflect.TypeOf((*MockLdapWrap)(nil).Groups))
+}
+
+// InvalidateDoorPassword mocks base method
+func (m *MockLdapWrap) InvalidateDoorPassword(uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateDoorPassword", uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidateDoorPassword indicates an expected call of InvalidateDoorPassword
+func (mr *MockLdapWrapMockRecorder) InvalidateDoorPassword(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateDoorPassword", reflect.TypeOf((*MockLdapWrap)(nil).InvalidateDoorPassword), uid)
+}
+
+// LeaveGroups mocks base method
+func (m *MockLdapWrap) LeaveGroups(uid string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaveGroups", uid)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaveGroups indicates an expected call of LeaveGroups
+func (mr *MockLdapWrapMockRecorder) LeaveGroups(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaveGroups", reflect.TypeOf((*MockLdapWrap)(nil).LeaveGroups), uid)
+}
+
+// LoginEnabled mocks base method
+func (m *MockLdapWrap) LoginEnabled(uid string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginEnabled", uid)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// LoginEnabled indicates an expected call of LoginEnabled
+func (mr *MockLdapWrapMockRecorder) LoginEnabled(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginEnabled", reflect.TypeOf((*MockLdapWrap)(nil).LoginEnabled), uid)
+}
+
+// MemberData mocks base method
+func (m *MockLdapWrap) MemberData(uid string) (map[string][]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MemberData", uid)
+	ret0, _ := ret[0].(map[string][]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MemberData indicates an expected call of MemberData
+func (mr *MockLdapWrapMockRecorder) MemberData(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MemberData", reflect.TypeOf((*MockLdapWrap)(nil).MemberData), uid)
 }
 
 // MemberExists mocks base method
@@ -195,18 +624,360 @@ func (mr *MockLdapWrapMockRecorder) MemberExists(uid interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MemberExists", reflect.TypeOf((*MockLdapWrap)(nil).MemberExists), uid)
 }
 
-// PasswordReset mocks base method
-func (m *MockLdapWrap) PasswordReset(nickname string) (string, string, error) {
+// MemberGroups mocks base method
+func (m *MockLdapWrap) MemberGroups(uid string) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PasswordReset", nickname)
+	ret := m.ctrl.Call(m, "MemberGroups", uid)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MemberGroups indicates an expected call of MemberGroups
+func (mr *MockLdapWrapMockRecorder) MemberGroups(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MemberGroups", reflect.TypeOf((*MockLdapWrap)(nil).MemberGroups), uid)
+}
+
+// Membership mocks base method
+func (m *MockLdapWrap) Membership(uid string) (membership.State, []membership.Transition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Membership", uid)
+	ret0, _ := ret[0].(membership.State)
+	ret1, _ := ret[1].([]membership.Transition)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Membership indicates an expected call of Membership
+func (mr *MockLdapWrapMockRecorder) Membership(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Membership", reflect.TypeOf((*MockLdapWrap)(nil).Membership), uid)
+}
+
+// MlAddress mocks base method
+func (m *MockLdapWrap) MlAddress(uid string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MlAddress", uid)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
+// MlAddress indicates an expected call of MlAddress
+func (mr *MockLdapWrapMockRecorder) MlAddress(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MlAddress", reflect.TypeOf((*MockLdapWrap)(nil).MlAddress), uid)
+}
+
+// Passkeys mocks base method
+func (m *MockLdapWrap) Passkeys(uid string) ([]core.Passkey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Passkeys", uid)
+	ret0, _ := ret[0].([]core.Passkey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Passkeys indicates an expected call of Passkeys
+func (mr *MockLdapWrapMockRecorder) Passkeys(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Passkeys", reflect.TypeOf((*MockLdapWrap)(nil).Passkeys), uid)
+}
+
+// PasswordReset mocks base method
+func (m *MockLdapWrap) PasswordReset(nicknameOrEmail string) ([]core.PasswordResetToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PasswordReset", nicknameOrEmail)
+	ret0, _ := ret[0].([]core.PasswordResetToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // PasswordReset indicates an expected call of PasswordReset
-func (mr *MockLdapWrapMockRecorder) PasswordReset(nickname interface{}) *gomock.Call {
+func (mr *MockLdapWrapMockRecorder) PasswordReset(nicknameOrEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PasswordReset", reflect.TypeOf((*MockLdapWrap)(nil).PasswordReset), nicknameOrEmail)
+}
+
+// RegisterMember mocks base method
+func (m *MockLdapWrap) RegisterMember(user, email, mlEmail string, services []string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterMember", user, email, mlEmail, services)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegisterMember indicates an expected call of RegisterMember
+func (mr *MockLdapWrapMockRecorder) RegisterMember(user, email, mlEmail, services interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterMember", reflect.TypeOf((*MockLdapWrap)(nil).RegisterMember), user, email, mlEmail, services)
+}
+
+// RemoveGroupMember mocks base method
+func (m *MockLdapWrap) RemoveGroupMember(cn, uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveGroupMember", cn, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveGroupMember indicates an expected call of RemoveGroupMember
+func (mr *MockLdapWrapMockRecorder) RemoveGroupMember(cn, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveGroupMember", reflect.TypeOf((*MockLdapWrap)(nil).RemoveGroupMember), cn, uid)
+}
+
+// RemoveGroupOwner mocks base method
+func (m *MockLdapWrap) RemoveGroupOwner(cn, uid string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveGroupOwner", cn, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveGroupOwner indicates an expected call of RemoveGroupOwner
+func (mr *MockLdapWrapMockRecorder) RemoveGroupOwner(cn, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveGroupOwner", reflect.TypeOf((*MockLdapWrap)(nil).RemoveGroupOwner), cn, uid)
+}
+
+// RenameGroup mocks base method
+func (m *MockLdapWrap) RenameGroup(cn, newCN string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameGroup", cn, newCN)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenameGroup indicates an expected call of RenameGroup
+func (mr *MockLdapWrapMockRecorder) RenameGroup(cn, newCN interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameGroup", reflect.TypeOf((*MockLdapWrap)(nil).RenameGroup), cn, newCN)
+}
+
+// RequestEmailChange mocks base method
+func (m *MockLdapWrap) RequestEmailChange(uid, newEmail string) (string, string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestEmailChange", uid, newEmail)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(string)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// RequestEmailChange indicates an expected call of RequestEmailChange
+func (mr *MockLdapWrapMockRecorder) RequestEmailChange(uid, newEmail interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestEmailChange", reflect.TypeOf((*MockLdapWrap)(nil).RequestEmailChange), uid, newEmail)
+}
+
+// RequestService mocks base method
+func (m *MockLdapWrap) RequestService(uid, service string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestService", uid, service)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestService indicates an expected call of RequestService
+func (mr *MockLdapWrapMockRecorder) RequestService(uid, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestService", reflect.TypeOf((*MockLdapWrap)(nil).RequestService), uid, service)
+}
+
+// RevertEmailChange mocks base method
+func (m *MockLdapWrap) RevertEmailChange(token string) (string, string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevertEmailChange", token)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(string)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// RevertEmailChange indicates an expected call of RevertEmailChange
+func (mr *MockLdapWrapMockRecorder) RevertEmailChange(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevertEmailChange", reflect.TypeOf((*MockLdapWrap)(nil).RevertEmailChange), token)
+}
+
+// RevokeBadge mocks base method
+func (m *MockLdapWrap) RevokeBadge(uid, badgeID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeBadge", uid, badgeID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeBadge indicates an expected call of RevokeBadge
+func (mr *MockLdapWrapMockRecorder) RevokeBadge(uid, badgeID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeBadge", reflect.TypeOf((*MockLdapWrap)(nil).RevokeBadge), uid, badgeID)
+}
+
+// RevokePasskey mocks base method
+func (m *MockLdapWrap) RevokePasskey(uid, passkeyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePasskey", uid, passkeyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokePasskey indicates an expected call of RevokePasskey
+func (mr *MockLdapWrapMockRecorder) RevokePasskey(uid, passkeyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePasskey", reflect.TypeOf((*MockLdapWrap)(nil).RevokePasskey), uid, passkeyID)
+}
+
+// SSHKeys mocks base method
+func (m *MockLdapWrap) SSHKeys(uid string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SSHKeys", uid)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SSHKeys indicates an expected call of SSHKeys
+func (mr *MockLdapWrapMockRecorder) SSHKeys(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SSHKeys", reflect.TypeOf((*MockLdapWrap)(nil).SSHKeys), uid)
+}
+
+// ServiceRequests mocks base method
+func (m *MockLdapWrap) ServiceRequests() ([]core.ServiceRequest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ServiceRequests")
+	ret0, _ := ret[0].([]core.ServiceRequest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ServiceRequests indicates an expected call of ServiceRequests
+func (mr *MockLdapWrapMockRecorder) ServiceRequests() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ServiceRequests", reflect.TypeOf((*MockLdapWrap)(nil).ServiceRequests))
+}
+
+// Services mocks base method
+func (m *MockLdapWrap) Services(uid string) ([]string, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Services", uid)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Services indicates an expected call of Services
+func (mr *MockLdapWrapMockRecorder) Services(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Services", reflect.TypeOf((*MockLdapWrap)(nil).Services), uid)
+}
+
+// SetDoorPassword mocks base method
+func (m *MockLdapWrap) SetDoorPassword(uid, doorpass string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDoorPassword", uid, doorpass)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDoorPassword indicates an expected call of SetDoorPassword
+func (mr *MockLdapWrapMockRecorder) SetDoorPassword(uid, doorpass interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDoorPassword", reflect.TypeOf((*MockLdapWrap)(nil).SetDoorPassword), uid, doorpass)
+}
+
+// SetMlAddress mocks base method
+func (m *MockLdapWrap) SetMlAddress(uid, mlAddress string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMlAddress", uid, mlAddress)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMlAddress indicates an expected call of SetMlAddress
+func (mr *MockLdapWrapMockRecorder) SetMlAddress(uid, mlAddress interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMlAddress", reflect.TypeOf((*MockLdapWrap)(nil).SetMlAddress), uid, mlAddress)
+}
+
+// SetPassword mocks base method
+func (m *MockLdapWrap) SetPassword(token, password, doorpass string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPassword", token, password, doorpass)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPassword indicates an expected call of SetPassword
+func (mr *MockLdapWrapMockRecorder) SetPassword(token, password, doorpass interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPassword", reflect.TypeOf((*MockLdapWrap)(nil).SetPassword), token, password, doorpass)
+}
+
+// TOTP mocks base method
+func (m *MockLdapWrap) TOTP(uid string) (string, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TOTP", uid)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TOTP indicates an expected call of TOTP
+func (mr *MockLdapWrapMockRecorder) TOTP(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TOTP", reflect.TypeOf((*MockLdapWrap)(nil).TOTP), uid)
+}
+
+// UpdatePasskey mocks base method
+func (m *MockLdapWrap) UpdatePasskey(uid string, credential webauthn.Credential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasskey", uid, credential)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasskey indicates an expected call of UpdatePasskey
+func (mr *MockLdapWrapMockRecorder) UpdatePasskey(uid, credential interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasskey", reflect.TypeOf((*MockLdapWrap)(nil).UpdatePasskey), uid, credential)
+}
+
+// UseRecoveryCode mocks base method
+func (m *MockLdapWrap) UseRecoveryCode(uid, code string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", uid, code)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode
+func (mr *MockLdapWrapMockRecorder) UseRecoveryCode(uid, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockLdapWrap)(nil).UseRecoveryCode), uid, code)
+}
+
+// UseTOTP mocks base method
+func (m *MockLdapWrap) UseTOTP(uid string, counter int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTP", uid, counter)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTP indicates an expected call of UseTOTP
+func (mr *MockLdapWrapMockRecorder) UseTOTP(uid, counter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PasswordReset", reflect.TypeOf((*MockLdapWrap)(nil).PasswordReset), nickname)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTP", reflect.TypeOf((*MockLdapWrap)(nil).UseTOTP), uid, counter)
 }
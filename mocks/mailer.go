@@ -5,6 +5,8 @@
 package mocks
 
 import (
+	context "context"
+	core "github.com/b4ckspace/members/internal/core"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -32,16 +34,53 @@ func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
 	return m.recorder
 }
 
-// SendPassword mocks base method
-func (m *MockMailer) SendPassword(to, nickname, token string) error {
+// Send mocks base method
+func (m *MockMailer) Send(ctx context.Context, to, templateName string, data interface{}) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendPassword", to, nickname, token)
+	ret := m.ctrl.Call(m, "Send", ctx, to, templateName, data)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SendPassword indicates an expected call of SendPassword
-func (mr *MockMailerMockRecorder) SendPassword(to, nickname, token interface{}) *gomock.Call {
+// Send indicates an expected call of Send
+func (mr *MockMailerMockRecorder) Send(ctx, to, templateName, data interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendPassword", reflect.TypeOf((*MockMailer)(nil).SendPassword), to, nickname, token)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailer)(nil).Send), ctx, to, templateName, data)
+}
+
+// MockMailbox is a mock of Mailbox interface
+type MockMailbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailboxMockRecorder
+}
+
+// MockMailboxMockRecorder is the mock recorder for MockMailbox
+type MockMailboxMockRecorder struct {
+	mock *MockMailbox
+}
+
+// NewMockMailbox creates a new mock instance
+func NewMockMailbox(ctrl *gomock.Controller) *MockMailbox {
+	mock := &MockMailbox{ctrl: ctrl}
+	mock.recorder = &MockMailboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockMailbox) EXPECT() *MockMailboxMockRecorder {
+	return m.recorder
+}
+
+// Mails mocks base method
+func (m *MockMailbox) Mails() []core.CapturedMail {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mails")
+	ret0, _ := ret[0].([]core.CapturedMail)
+	return ret0
+}
+
+// Mails indicates an expected call of Mails
+func (mr *MockMailboxMockRecorder) Mails() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mails", reflect.TypeOf((*MockMailbox)(nil).Mails))
 }
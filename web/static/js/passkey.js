@@ -0,0 +1,90 @@
+// Runs the WebAuthn ceremonies for buttons with a data-passkey attribute. The
+// server hands out the options as JSON, binary values are base64url encoded.
+(function () {
+  function decode(value) {
+    var s = atob(value.replace(/-/g, '+').replace(/_/g, '/'));
+    return Uint8Array.from(s, function (c) { return c.charCodeAt(0); });
+  }
+
+  function encode(buffer) {
+    var s = String.fromCharCode.apply(null, new Uint8Array(buffer));
+    return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  }
+
+  function post(url, body) {
+    return fetch(url, {
+      method: 'POST',
+      credentials: 'same-origin',
+      headers: { 'Content-Type': 'application/json' },
+      body: body ? JSON.stringify(body) : null,
+    }).then(function (res) { return res.json(); });
+  }
+
+  function register(label) {
+    return post('/passkeys/register').then(function (options) {
+      options.publicKey.challenge = decode(options.publicKey.challenge);
+      options.publicKey.user.id = decode(options.publicKey.user.id);
+      (options.publicKey.excludeCredentials || []).forEach(function (c) {
+        c.id = decode(c.id);
+      });
+      return navigator.credentials.create(options);
+    }).then(function (cred) {
+      return post('/passkeys/register/finish?label=' + encodeURIComponent(label), {
+        id: cred.id,
+        rawId: encode(cred.rawId),
+        type: cred.type,
+        response: {
+          clientDataJSON: encode(cred.response.clientDataJSON),
+          attestationObject: encode(cred.response.attestationObject),
+        },
+      });
+    });
+  }
+
+  function login(next) {
+    return post('/login/passkey').then(function (options) {
+      options.publicKey.challenge = decode(options.publicKey.challenge);
+      return navigator.credentials.get(options);
+    }).then(function (cred) {
+      return post('/login/passkey/finish?next=' + encodeURIComponent(next), {
+        id: cred.id,
+        rawId: encode(cred.rawId),
+        type: cred.type,
+        response: {
+          clientDataJSON: encode(cred.response.clientDataJSON),
+          authenticatorData: encode(cred.response.authenticatorData),
+          signature: encode(cred.response.signature),
+          userHandle: cred.response.userHandle ? encode(cred.response.userHandle) : '',
+        },
+      });
+    });
+  }
+
+  function fail() {
+    var error = document.getElementById('passkey-error');
+    if (error) {
+      error.classList.remove('d-none');
+    }
+  }
+
+  document.querySelectorAll('[data-passkey]').forEach(function (button) {
+    if (!window.PublicKeyCredential) {
+      button.disabled = true;
+      return;
+    }
+    button.addEventListener('click', function () {
+      var ceremony;
+      if (button.dataset.passkey === 'register') {
+        ceremony = register(document.getElementById('passkey-label').value);
+      } else {
+        ceremony = login(button.dataset.next || '');
+      }
+      ceremony.then(function (res) {
+        if (!res.ok) {
+          return fail();
+        }
+        window.location = res.next;
+      }).catch(fail);
+    });
+  });
+})();